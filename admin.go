@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// 管理页 (admin)：修改月份列表和高亮规则
+// ==========================================
+
+func registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin", authMiddleware(handleAdmin))
+	mux.HandleFunc("POST /admin/posts", authMiddleware(handleAdminPosts))
+	mux.HandleFunc("POST /admin/rules", authMiddleware(handleAdminRules))
+	mux.HandleFunc("GET /admin/audit", authMiddleware(handleAdminAudit))
+}
+
+// 保存成功后跳回管理页时显示的提示
+var adminMessages = map[string]string{
+	"posts": "✅ 月份列表已保存并重新加载",
+	"rules": "✅ 高亮规则已保存并重新加载",
+}
+
+func handleAdmin(w http.ResponseWriter, r *http.Request) {
+	user := requireRole(w, r, RoleAdmin)
+	if user == nil {
+		return
+	}
+	renderAdmin(w, adminPageData(user, adminMessages[r.URL.Query().Get("saved")], "", nil))
+}
+
+// adminPageData 读取各社区当前的配置文本；edited 中的内容（保存失败时用户提交的文本）优先显示
+func adminPageData(user *UserSession, message, errStr string, edited map[string]string) AdminPageData {
+	data := AdminPageData{CurrentUser: user, Message: message, Error: errStr}
+	for _, c := range getCommunities() {
+		ref := communityRef(c)
+		ac := AdminCommunity{
+			Ref:            ref,
+			Name:           c.Name,
+			PostConfigFile: c.PostConfig,
+			PostConfig:     currentPostConfigText(c),
+			RulesFile:      c.HighlightRules,
+			Rules:          currentRulesText(c),
+		}
+		if text, ok := edited["posts:"+ref]; ok {
+			ac.PostConfig = text
+		}
+		if text, ok := edited["rules:"+ref]; ok {
+			ac.Rules = text
+		}
+		data.Communities = append(data.Communities, ac)
+	}
+	return data
+}
+
+// 文件不存在时显示当前生效的列表（默认社区的内置列表）
+func currentPostConfigText(c CommunityConfig) string {
+	if content, err := os.ReadFile(c.PostConfig); err == nil {
+		return string(content)
+	}
+	posts, err := loadPostConfigFile(c.PostConfig, c.ID == "")
+	if err != nil {
+		return "[]"
+	}
+	text, _ := json.MarshalIndent(posts, "", "  ")
+	return string(text)
+}
+
+// 文件不存在时显示默认规则
+func currentRulesText(c CommunityConfig) string {
+	if content, err := os.ReadFile(c.HighlightRules); err == nil {
+		return string(content)
+	}
+	text, _ := json.MarshalIndent(defaultHighlightRules(), "", "  ")
+	return string(text)
+}
+
+// 保存失败时保留用户提交的文本并显示错误
+func renderAdminError(w http.ResponseWriter, user *UserSession, err error, editedKey, content string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	renderAdmin(w, adminPageData(user, "", err.Error(), map[string]string{editedKey: content}))
+}
+
+// 保存月份列表
+func handleAdminPosts(w http.ResponseWriter, r *http.Request) {
+	user := requireRole(w, r, RoleAdmin)
+	if user == nil {
+		return
+	}
+	ref, content := r.FormValue("community"), r.FormValue("content")
+	fail := func(err error) {
+		auditRequest(r, user, AuditPosts, ref, AuditFailed, err.Error())
+		renderAdminError(w, user, err, "posts:"+ref, content)
+	}
+	c, ok := communityByRef(ref)
+	if !ok {
+		fail(fmt.Errorf("未知社区: %q", ref))
+		return
+	}
+	posts, err := parsePostConfigs([]byte(content))
+	if err != nil {
+		fail(fmt.Errorf("%s: %w", c.PostConfig, err))
+		return
+	}
+	if err := writeJSONFile(c.PostConfig, posts); err != nil {
+		fail(err)
+		return
+	}
+	if err := reloadPostList(); err != nil {
+		fail(err)
+		return
+	}
+	reqLogger(r).Info("管理员更新了月份列表", userAttrs(user), "path", c.PostConfig, "count", len(posts))
+	auditRequest(r, user, AuditPosts, c.PostConfig, AuditOK, fmt.Sprintf("%d 个月份", len(posts)))
+	http.Redirect(w, r, "/admin?saved=posts", http.StatusSeeOther)
+}
+
+// 保存高亮规则
+func handleAdminRules(w http.ResponseWriter, r *http.Request) {
+	user := requireRole(w, r, RoleAdmin)
+	if user == nil {
+		return
+	}
+	ref, content := r.FormValue("community"), r.FormValue("content")
+	fail := func(err error) {
+		auditRequest(r, user, AuditRules, ref, AuditFailed, err.Error())
+		renderAdminError(w, user, err, "rules:"+ref, content)
+	}
+	c, ok := communityByRef(ref)
+	if !ok {
+		fail(fmt.Errorf("未知社区: %q", ref))
+		return
+	}
+	rules, err := parseHighlightRules([]byte(content))
+	if err != nil {
+		fail(fmt.Errorf("%s: %w", c.HighlightRules, err))
+		return
+	}
+	if err := writeJSONFile(c.HighlightRules, rules); err != nil {
+		fail(err)
+		return
+	}
+	if err := loadHighlightRules(c.HighlightRules); err != nil {
+		fail(err)
+		return
+	}
+	reqLogger(r).Info("管理员更新了高亮规则", userAttrs(user), "path", c.HighlightRules, "count", len(rules))
+	auditRequest(r, user, AuditRules, c.HighlightRules, AuditOK, fmt.Sprintf("%d 条规则", len(rules)))
+	http.Redirect(w, r, "/admin?saved=rules", http.StatusSeeOther)
+}
+
+// parsePostConfigs 解析并检查月份列表：文件名须为 data/ 下的 .json 文件名，帖子 ID 须为数字，文件名不能重复
+func parsePostConfigs(content []byte) ([]PostConfig, error) {
+	var posts []PostConfig
+	if err := decodeStrict(content, &posts); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i, p := range posts {
+		switch {
+		case p.FileName == "" || p.PostID == "":
+			return nil, fmt.Errorf("第 %d 项缺少 file_name 或 post_id", i+1)
+		case strings.ContainsAny(p.FileName, `/\`) || strings.HasPrefix(p.FileName, ".") || !strings.HasSuffix(p.FileName, ".json"):
+			return nil, fmt.Errorf("第 %d 项 file_name %q 无效，应为类似 2025-01.json 的文件名", i+1, p.FileName)
+		case seen[p.FileName]:
+			return nil, fmt.Errorf("file_name %q 重复", p.FileName)
+		}
+		if _, err := strconv.ParseUint(p.PostID, 10, 64); err != nil {
+			return nil, fmt.Errorf("第 %d 项 post_id %q 不是有效的帖子 ID", i+1, p.PostID)
+		}
+		seen[p.FileName] = true
+	}
+	return posts, nil
+}
+
+// parseHighlightRules 解析规则并试编译，确保保存后能正常加载
+func parseHighlightRules(content []byte) ([]HighlightRule, error) {
+	var rules []HighlightRule
+	if err := decodeStrict(content, &rules); err != nil {
+		return nil, err
+	}
+	if _, err := compileHighlightRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// decodeStrict 解析 JSON，不允许未知字段（通常是拼写错误）
+func decodeStrict(content []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("JSON 格式错误: %w", err)
+	}
+	if dec.More() {
+		return errors.New("JSON 格式错误: 末尾有多余内容")
+	}
+	return nil
+}
+
+// writeJSONFile 先写临时文件再重命名，避免写到一半时被热加载读到
+func writeJSONFile(path string, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParsePostConfigs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", `[{"file_name": "2025-01.json", "post_id": "111"}, {"file_name": "2025-02.json", "post_id": "222"}]`, ""},
+		{"parent directory", `[{"file_name": "../x.json", "post_id": "111"}]`, "无效"},
+		{"subdirectory", `[{"file_name": "a/b.json", "post_id": "111"}]`, "无效"},
+		{"backslash", `[{"file_name": "a\\b.json", "post_id": "111"}]`, "无效"},
+		{"hidden file", `[{"file_name": ".json", "post_id": "111"}]`, "无效"},
+		{"not json", `[{"file_name": "2025-01.txt", "post_id": "111"}]`, "无效"},
+		{"missing post id", `[{"file_name": "2025-01.json"}]`, "缺少"},
+		{"bad post id", `[{"file_name": "2025-01.json", "post_id": "abc"}]`, "post_id"},
+		{"duplicate", `[{"file_name": "2025-01.json", "post_id": "111"}, {"file_name": "2025-01.json", "post_id": "222"}]`, "重复"},
+		{"unknown field", `[{"file": "2025-01.json", "post_id": "111"}]`, "JSON"},
+		{"trailing content", `[] []`, "多余"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := parsePostConfigs([]byte(tt.content))
+			if tt.wantErr == "" {
+				if err != nil || len(posts) != 2 {
+					t.Fatalf("parsePostConfigs = %v, %v", posts, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parsePostConfigs error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// adminPost 以 admin 身份提交管理页表单
+func adminPost(t *testing.T, mux *http.ServeMux, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	r := sessionRequest(t, "POST", path, &UserSession{UserID: "9", Username: "root"})
+	r.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminSavePosts(t *testing.T) {
+	useTestState(t, ServerConfig{Roles: RolesConfig{Admin: RoleMapping{UserIDs: []string{"9"}}}}, nil)
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux)
+
+	content := `[{"month_str": "1月", "file_name": "2025-01.json", "post_id": "111"}]`
+	w := adminPost(t, mux, "/admin/posts", url.Values{"community": {DefaultCommunityRef}, "content": {content}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin?saved=posts" {
+		t.Fatalf("POST /admin/posts = %d %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if _, err := os.Stat(PostFiles); err != nil {
+		t.Fatalf("post config not written: %v", err)
+	}
+	if posts := getPostList(); len(posts) != 1 || posts[0].FileName != "2025-01.json" || posts[0].PostID != "111" {
+		t.Errorf("post list after save = %+v", posts)
+	}
+
+	// 无效内容不写入文件，页面保留提交的文本
+	bad := `[{"file_name": "../x.json", "post_id": "111"}]`
+	w = adminPost(t, mux, "/admin/posts", url.Values{"community": {DefaultCommunityRef}, "content": {bad}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "../x.json") {
+		t.Errorf("POST invalid posts = %d: %s", w.Code, w.Body)
+	}
+	if posts := getPostList(); len(posts) != 1 || posts[0].FileName != "2025-01.json" {
+		t.Errorf("post list after rejected save = %+v", posts)
+	}
+	w = adminPost(t, mux, "/admin/posts", url.Values{"community": {"missing"}, "content": {content}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST unknown community = %d, want 400", w.Code)
+	}
+
+	entries, err := readAuditEntries(AuditFilter{Action: AuditPosts, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Result != AuditOK || entries[2].Target != PostFiles ||
+		entries[1].Result != AuditFailed || entries[0].Result != AuditFailed || entries[0].UserID != "9" {
+		t.Errorf("admin_posts entries = %+v", entries)
+	}
+}
+
+func TestAdminSaveRules(t *testing.T) {
+	useTestState(t, ServerConfig{Roles: RolesConfig{Admin: RoleMapping{UserIDs: []string{"9"}}}}, nil)
+	highlightRulesMu.Lock()
+	old, hadOld := highlightRules[HighlightRulesFile]
+	highlightRulesMu.Unlock()
+	t.Cleanup(func() {
+		highlightRulesMu.Lock()
+		defer highlightRulesMu.Unlock()
+		if hadOld {
+			highlightRules[HighlightRulesFile] = old
+		} else {
+			delete(highlightRules, HighlightRulesFile)
+		}
+	})
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux)
+
+	content := `[{"name": "q", "type": "keyword", "values": ["提问"], "category": "question"}]`
+	w := adminPost(t, mux, "/admin/rules", url.Values{"community": {DefaultCommunityRef}, "content": {content}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin?saved=rules" {
+		t.Fatalf("POST /admin/rules = %d %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	highlightRulesMu.RLock()
+	set := highlightRules[HighlightRulesFile]
+	highlightRulesMu.RUnlock()
+	if set == nil || len(set.rules) != 1 || set.rules[0].Name != "q" {
+		t.Fatalf("rules after save = %+v", set)
+	}
+
+	w = adminPost(t, mux, "/admin/rules", url.Values{"community": {DefaultCommunityRef}, "content": {`[{"name": "bad", "type": "regex", "values": ["("]}]`}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST invalid rules = %d, want 400", w.Code)
+	}
+	saved, err := os.ReadFile(HighlightRulesFile)
+	if err != nil || strings.Contains(string(saved), "bad") {
+		t.Errorf("rules file after rejected save = %q, %v", saved, err)
+	}
+}
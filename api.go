@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 只读 JSON API (/api/v1)
+// ==========================================
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 500
+)
+
+type apiUserKey struct{}
+
+// 注册 /api/v1 下的所有路由
+func registerAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/posts", apiAuthMiddleware(handleAPIPosts))
+	mux.HandleFunc("GET /api/v1/posts/{file}/messages", apiAuthMiddleware(handleAPIPostMessages))
+	mux.HandleFunc("GET /api/v1/messages/{id}", apiAuthMiddleware(handleAPIMessage))
+	mux.HandleFunc("GET /api/v1/search", apiAuthMiddleware(handleAPISearch))
+}
+
+// 中间件：API Key 或 Session 鉴权，失败时返回 JSON 错误而不是跳转登录页
+func apiAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := userFromAPIKey(r)
+		if user == nil {
+			session := getCurrentUser(r)
+			if session == nil || session.UserID == "" {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			if !hasCommunityAccess(session) {
+				writeAPIError(w, http.StatusForbidden, "no access to channel")
+				return
+			}
+			user = session
+		}
+
+		if err := ensurePostList(); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "failed to load post configs")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiUserKey{}, user)))
+	}
+}
+
+// 根据请求头中的 API Key 匹配 server_config.json 中配置的用户
+func userFromAPIKey(r *http.Request) *UserSession {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	if key == "" {
+		return nil
+	}
+	for _, k := range getServerConfig().APIKeys {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			user := &UserSession{UserID: k.UserID, Username: k.Username, Auth: AuthAPIKey}
+			for _, ref := range k.Communities {
+				if c, ok := communityByRef(ref); ok {
+					user.Communities = append(user.Communities, c.ID)
+				}
+			}
+			return user
+		}
+	}
+	return nil
+}
+
+// validateAPIKeys 检查 server_config.json 中的 API Key：每个 Key 都要显式列出可访问的社区
+func validateAPIKeys(keys []APIKey, configured []CommunityConfig) error {
+	communities := resolveCommunities(configured)
+	for i, k := range keys {
+		if k.Key == "" || k.UserID == "" {
+			return fmt.Errorf("api_keys 第 %d 项缺少 key 或 user_id", i+1)
+		}
+		if len(k.Communities) == 0 {
+			return fmt.Errorf("api_keys 第 %d 项（%s）缺少 communities，默认社区写作 %q", i+1, k.Username, DefaultCommunityRef)
+		}
+		for _, ref := range k.Communities {
+			id := strings.TrimSpace(ref)
+			if id == DefaultCommunityRef {
+				id = ""
+			}
+			if !slices.ContainsFunc(communities, func(c CommunityConfig) bool { return c.ID == id }) {
+				return fmt.Errorf("api_keys 第 %d 项（%s）的社区 %q 不存在", i+1, k.Username, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// 获取 API 中间件解析出的当前用户
+func apiUser(r *http.Request) *UserSession {
+	if user, ok := r.Context().Value(apiUserKey{}).(*UserSession); ok {
+		return user
+	}
+	return &UserSession{}
+}
+
+type apiPost struct {
+	PostConfig
+	Community string `json:"community"` // 社区 ID，默认社区为空
+	Count     int    `json:"count"`
+}
+
+func handleAPIPosts(w http.ResponseWriter, r *http.Request) {
+	var posts []apiPost
+	for _, cfg := range visiblePosts(apiUser(r)) {
+		posts = append(posts, apiPost{PostConfig: cfg, Community: communityOf(cfg.FileName).ID, Count: storedCount(cfg.FileName)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"posts": posts})
+}
+
+// 分页返回某个月份的消息，view=raw (默认) 返回原始消息，view=nodes 返回处理后的 ViewNode 树
+// cursor 为上一页最后一条的 ID，返回 ID（按 snowflake 数值比较）大于 cursor 的数据。
+// view=nodes 时按主轴节点分页：主轴节点按 ID 升序，cursor 为上一页最后一个主轴节点的 ID，
+// 每个节点连同它的回复和合并的连发消息一起返回，即使这些消息的 ID 大于下一页的 cursor
+func handleAPIPostMessages(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	cfg, ok := canViewPost(apiUser(r), file)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown post file")
+		return
+	}
+	cursor := r.URL.Query().Get("cursor")
+	limit := parseAPILimit(r.URL.Query().Get("limit"))
+	msgs := getStoredMessages(file)
+
+	resp := map[string]any{"file": file}
+	switch r.URL.Query().Get("view") {
+	case "", "raw":
+		var page []DiscordMessage
+		for _, m := range msgs {
+			if cursor != "" && discord.CompareIDs(m.ID, cursor) <= 0 {
+				continue
+			}
+			page = append(page, m)
+			if len(page) == limit {
+				break
+			}
+		}
+		resp["messages"] = page
+		resp["next_cursor"] = ""
+		if len(page) == limit {
+			resp["next_cursor"] = page[len(page)-1].ID
+		}
+	case "nodes":
+		var page []*ViewNode
+		for _, node := range buildViewNodes(msgs, apiUser(r).UserID, apiViewOptions(r, cfg)) {
+			if cursor != "" && discord.CompareIDs(node.ID, cursor) <= 0 {
+				continue
+			}
+			page = append(page, node)
+			if len(page) == limit {
+				break
+			}
+		}
+		resp["nodes"] = page
+		resp["next_cursor"] = ""
+		if len(page) == limit {
+			resp["next_cursor"] = page[len(page)-1].ID
+		}
+	default:
+		writeAPIError(w, http.StatusBadRequest, "view must be raw or nodes")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// 按 ID 查找单条消息，同时返回它在视图树中对应的节点
+func handleAPIMessage(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	for _, cfg := range visiblePosts(apiUser(r)) {
+		msgs := getStoredMessages(cfg.FileName)
+		for _, m := range msgs {
+			if m.ID != id {
+				continue
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"file":    cfg.FileName,
+				"message": m,
+				"node":    findViewNode(buildViewNodes(msgs, apiUser(r).UserID, apiViewOptions(r, cfg)), id),
+			})
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, "message not found")
+}
+
+type apiSearchResult struct {
+	File    string         `json:"file"`
+	Message DiscordMessage `json:"message"`
+}
+
+// 在所有（或指定 file 的）月份中按内容/作者名做不区分大小写的子串搜索
+func handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	onlyFile := r.URL.Query().Get("file")
+	limit := parseAPILimit(r.URL.Query().Get("limit"))
+
+	results := []apiSearchResult{}
+	for _, cfg := range visiblePosts(apiUser(r)) {
+		if onlyFile != "" && cfg.FileName != onlyFile {
+			continue
+		}
+		for _, m := range getStoredMessages(cfg.FileName) {
+			if strings.Contains(strings.ToLower(m.Content), q) || strings.Contains(strings.ToLower(m.Author.Username), q) {
+				results = append(results, apiSearchResult{File: cfg.FileName, Message: m})
+				if len(results) == limit {
+					writeJSON(w, http.StatusOK, map[string]any{"results": results, "truncated": true})
+					return
+				}
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results, "truncated": false})
+}
+
+// 在视图树中（含合并的 Parts 和回复列表）查找指定 ID 的节点
+func findViewNode(nodes []*ViewNode, id string) *ViewNode {
+	for _, n := range nodes {
+		if n.ID == id {
+			return n
+		}
+		if found := findViewNode(n.Parts, id); found != nil {
+			return found
+		}
+		if found := findViewNode(n.Replies, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// getStoredMessages 在锁内复制一份 memoryStore 中的消息，避免与刷新并发读写
+func getStoredMessages(file string) []DiscordMessage {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	return append([]DiscordMessage(nil), memoryStore[file]...)
+}
+
+// storedCount 返回 memoryStore 中某个月份的消息数
+func storedCount(file string) int {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	return len(memoryStore[file])
+}
+
+// API 的视图选项，merge=off 关闭合并，mode=tree 使用树形回复
+func apiViewOptions(r *http.Request, cfg PostConfig) ViewOptions {
+	opts := viewOptionsFor(cfg, ViewPrefs{
+		NoMerge: r.URL.Query().Get("merge") == "off",
+		Tree:    r.URL.Query().Get("mode") == "tree",
+	})
+	opts.ResolveReply = newReplyResolver(apiUser(r))
+	return opts
+}
+
+func parseAPILimit(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return apiDefaultLimit
+	}
+	if n > apiMaxLimit {
+		return apiMaxLimit
+	}
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
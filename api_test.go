@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// 按 cursor 翻页直到 next_cursor 为空，返回每页的 ID
+func walkAPIPages(t *testing.T, mux http.Handler, user *UserSession, view string) [][]string {
+	t.Helper()
+	var pages [][]string
+	cursor := ""
+	for range 10 {
+		q := url.Values{"limit": {"1"}, "view": {view}, "cursor": {cursor}}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, sessionRequest(t, "GET", "/api/v1/posts/2025-01.json/messages?"+q.Encode(), user))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Messages   []DiscordMessage `json:"messages"`
+			Nodes      []*ViewNode      `json:"nodes"`
+			NextCursor string           `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range resp.Messages {
+			ids = append(ids, m.ID)
+		}
+		for _, n := range resp.Nodes {
+			ids = append(ids, n.ID)
+			for _, r := range n.Replies {
+				ids = append(ids, r.ID)
+			}
+		}
+		if len(ids) > 0 {
+			pages = append(pages, ids)
+		}
+		if resp.NextCursor == "" {
+			return pages
+		}
+		cursor = resp.NextCursor
+	}
+	t.Fatal("pagination did not terminate")
+	return nil
+}
+
+// snowflake 长度不同时按数值比较：17 位的 ID 比 18 位的小
+func TestAPIPaginationComparesSnowflakesNumerically(t *testing.T) {
+	useTestState(t, ServerConfig{}, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	fake := useFakeGuild(t, "111")
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "alice"})
+	msgs := []DiscordMessage{
+		{ID: "99999999999999999", Author: discord.Author{ID: "1"}, Timestamp: "2025-01-01T00:00:00Z"},
+		{ID: "100000000000000000", Author: discord.Author{ID: "2"}, Timestamp: "2025-01-02T00:00:00Z"},
+		{ID: "100000000000000001", Author: discord.Author{ID: "3"}, Timestamp: "2025-01-03T00:00:00Z",
+			MsgRef: &MsgRef{MessageID: "99999999999999999"}},
+	}
+	discord.SortMessages(msgs)
+	if msgs[0].ID != "99999999999999999" {
+		t.Fatalf("SortMessages put %s first", msgs[0].ID)
+	}
+	storeMu.Lock()
+	setStoredMessages("2025-01.json", msgs)
+	storeMu.Unlock()
+
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	user := &UserSession{UserID: "1", Auth: AuthOAuth, Communities: []string{""}}
+
+	raw := walkAPIPages(t, mux, user, "raw")
+	if len(raw) != 3 || raw[0][0] != msgs[0].ID || raw[1][0] != msgs[1].ID || raw[2][0] != msgs[2].ID {
+		t.Errorf("raw pages = %v", raw)
+	}
+	// 回复随所属的主轴节点返回，不会在下一页重复出现
+	nodes := walkAPIPages(t, mux, user, "nodes")
+	if len(nodes) != 2 || len(nodes[0]) != 2 || nodes[0][1] != msgs[2].ID || nodes[1][0] != msgs[1].ID {
+		t.Errorf("node pages = %v", nodes)
+	}
+}
+
+// API Key 只能查看配置中列出的社区
+func TestAPIKeyCommunityScope(t *testing.T) {
+	cfg := ServerConfig{
+		Communities: []CommunityConfig{{ID: "other", GuildID: GuildID, ChannelID: "c-other"}},
+		APIKeys: []APIKey{
+			{Key: "k-default", UserID: "1", Username: "alice", Communities: []string{DefaultCommunityRef}},
+			{Key: "k-both", UserID: "1", Username: "alice", Communities: []string{DefaultCommunityRef, "other"}},
+			{Key: "k-other", UserID: "1", Username: "alice", Communities: []string{"other"}},
+		},
+	}
+	posts := []PostConfig{{FileName: "2025-01.json", PostID: "111"}, {FileName: "other/2025-01.json", PostID: "222"}}
+	useTestState(t, cfg, posts)
+	fake := useFakeGuild(t, "111")
+	fake.AddChannel(discord.Channel{ID: "c-other", Name: "other-gate"})
+	fake.AddChannel(discord.Channel{ID: "222", Name: "222", Type: discord.ChannelTypePublicThread, ParentID: "c-other"})
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "alice"})
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"k-default", []string{"2025-01.json"}},
+		{"k-both", []string{"2025-01.json", "other/2025-01.json"}},
+		{"k-other", []string{"other/2025-01.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/posts", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Posts []apiPost `json:"posts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range resp.Posts {
+				got = append(got, p.FileName)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("posts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/posts/other%2F2025-01.json/messages", nil)
+	r.Header.Set("X-API-Key", "k-default")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("messages outside the key's communities = %d, want 404", w.Code)
+	}
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	communities := []CommunityConfig{{ID: "other", GuildID: "g", ChannelID: "c"}}
+	tests := []struct {
+		name    string
+		key     APIKey
+		wantErr bool
+	}{
+		{"default community", APIKey{Key: "k", UserID: "1", Communities: []string{DefaultCommunityRef}}, false},
+		{"configured community", APIKey{Key: "k", UserID: "1", Communities: []string{"other"}}, false},
+		{"no communities", APIKey{Key: "k", UserID: "1"}, true},
+		{"unknown community", APIKey{Key: "k", UserID: "1", Communities: []string{"missing"}}, true},
+		{"missing key", APIKey{UserID: "1", Communities: []string{DefaultCommunityRef}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAPIKeys([]APIKey{tt.key}, communities); (err != nil) != tt.wantErr {
+				t.Errorf("validateAPIKeys = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 审计日志 (audit.log，每行一条 JSON，按大小轮转)
+// ==========================================
+
+const (
+	DefaultAuditFile     = "audit.log"
+	DefaultAuditMaxSize  = 10 // MB
+	DefaultAuditMaxFiles = 5  // 保留的轮转文件数（audit.log.1 ~ audit.log.5）
+
+	auditPageLimit = 200 // 管理页默认显示条数
+	auditPageMax   = 2000
+)
+
+// 审计动作
+const (
+	AuditLogin    = "login"
+	AuditLogout   = "logout"
+	AuditRefresh  = "refresh"  // 发起抓取最新消息
+	AuditBackfill = "backfill" // 发起回填整月
+	AuditSync     = "sync"     // 后台同步任务结束（结果与新增条数）
+	AuditCancel   = "cancel"   // 取消等待同步任务
+	AuditDenied   = "denied"   // 角色或权限不足被拒绝
+	AuditPosts    = "admin_posts"
+	AuditRules    = "admin_rules"
+)
+
+// 审计结果
+const (
+	AuditOK      = "ok"
+	AuditFailed  = "failed"
+	AuditJoined  = "joined"  // 加入了同一月份进行中的任务
+	AuditLimited = "limited" // 刷新次数超限
+)
+
+var auditMu sync.Mutex
+
+// auditConfig 返回补齐默认值的审计日志配置
+func auditConfig() AuditConfig {
+	cfg := getServerConfig().Audit
+	if cfg.File == "" {
+		cfg.File = DefaultAuditFile
+	}
+	if cfg.MaxSizeMB <= 0 {
+		cfg.MaxSizeMB = DefaultAuditMaxSize
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultAuditMaxFiles
+	}
+	return cfg
+}
+
+// recordAudit 追加一条审计记录；写入失败只打日志，不影响请求本身
+func recordAudit(e AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("审计日志序列化失败", logKeyErr, err)
+		return
+	}
+	line = append(line, '\n')
+
+	cfg := auditConfig()
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if info, err := os.Stat(cfg.File); err == nil && info.Size()+int64(len(line)) > int64(cfg.MaxSizeMB)<<20 {
+		rotateAuditFiles(cfg)
+	}
+	f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		slog.Error("打开审计日志失败", "path", cfg.File, logKeyErr, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		slog.Error("写入审计日志失败", "path", cfg.File, logKeyErr, err)
+	}
+}
+
+// auditRequest 记录由请求触发的动作，自动填入用户和客户端 IP
+func auditRequest(r *http.Request, user *UserSession, action, target, result, detail string) {
+	e := AuditEntry{Action: action, Target: target, Result: result, Detail: detail, IP: clientIP(r), RequestID: requestIDFrom(r)}
+	if user != nil {
+		e.UserID, e.Username = user.UserID, user.Username
+	}
+	recordAudit(e)
+}
+
+// 轮转：audit.log.N-1 -> audit.log.N ... audit.log -> audit.log.1，超出 MaxFiles 的最旧文件被覆盖
+func rotateAuditFiles(cfg AuditConfig) {
+	os.Remove(fmt.Sprintf("%s.%d", cfg.File, cfg.MaxFiles))
+	for i := cfg.MaxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", cfg.File, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", cfg.File, i+1)); err != nil && !os.IsNotExist(err) {
+			slog.Error("轮转审计日志失败", "path", from, logKeyErr, err)
+		}
+	}
+	if err := os.Rename(cfg.File, cfg.File+".1"); err != nil {
+		slog.Error("轮转审计日志失败", "path", cfg.File, logKeyErr, err)
+	}
+}
+
+// clientIP 返回客户端 IP；只有配置了 trust_forwarded_for（查看器部署在反向代理后）时才采用 X-Forwarded-For
+func clientIP(r *http.Request) string {
+	if auditConfig().TrustForwardedFor {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ---------------- 查询 ----------------
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	if f.User != "" && e.UserID != f.User && !strings.Contains(strings.ToLower(e.Username), strings.ToLower(f.User)) {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Target != "" && !strings.Contains(e.Target, f.Target) {
+		return false
+	}
+	if f.Result != "" && e.Result != f.Result {
+		return false
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// parseAuditFilter 从查询参数读取筛选条件，日期为 2006-01-02（until 当天包含在内）
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	q := r.URL.Query()
+	f := AuditFilter{
+		User:   strings.TrimSpace(q.Get("user")),
+		Action: q.Get("action"),
+		Target: strings.TrimSpace(q.Get("target")),
+		Result: q.Get("result"),
+		Since:  q.Get("since"),
+		Until:  q.Get("until"),
+		Limit:  auditPageLimit,
+	}
+	var err error
+	if f.Since != "" {
+		if f.since, err = time.ParseInLocation("2006-01-02", f.Since, time.Local); err != nil {
+			return f, fmt.Errorf("since 日期无效: %w", err)
+		}
+	}
+	if f.Until != "" {
+		if f.until, err = time.ParseInLocation("2006-01-02", f.Until, time.Local); err != nil {
+			return f, fmt.Errorf("until 日期无效: %w", err)
+		}
+		f.until = f.until.AddDate(0, 0, 1)
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("limit 无效: %q", s)
+		}
+		f.Limit = min(n, auditPageMax)
+	}
+	return f, nil
+}
+
+// readAuditEntries 从当前文件和轮转文件中读取符合条件的记录，最新的在前，最多 limit 条
+func readAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	cfg := auditConfig()
+	files := []string{cfg.File}
+	for i := 1; i <= cfg.MaxFiles; i++ {
+		files = append(files, fmt.Sprintf("%s.%d", cfg.File, i))
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	var out []AuditEntry
+	for _, path := range files { // 从新到旧
+		entries, err := readAuditFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range slices.Backward(entries) {
+			if f.matches(e) {
+				out = append(out, e)
+				if len(out) >= f.Limit {
+					return out, nil
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// 读取一个审计文件，跳过无法解析的行（例如写到一半时进程退出）
+func readAuditFile(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// 审计日志页（admin 角色）
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	user := requireRole(w, r, RoleAdmin)
+	if user == nil {
+		return
+	}
+	data := AuditPageData{CurrentUser: user, Actions: auditActions, Results: auditResults}
+	filter, err := parseAuditFilter(r)
+	data.Filter = filter
+	if err == nil {
+		data.Entries, err = readAuditEntries(filter)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	renderAudit(w, data)
+}
+
+// 页面筛选下拉框的选项
+var (
+	auditActions = []string{AuditLogin, AuditLogout, AuditRefresh, AuditBackfill, AuditSync, AuditCancel, AuditDenied, AuditPosts, AuditRules}
+	auditResults = []string{AuditOK, AuditFailed, AuditJoined, AuditLimited, JobDone, JobPartial, JobCancelled}
+)
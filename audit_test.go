@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillAuditLog 在审计日志末尾追加约 1MB 无法解析的行，使下一条记录触发轮转
+func fillAuditLog(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	line := strings.Repeat("-", 1023) + "\n"
+	if _, err := f.WriteString(strings.Repeat(line, 1024)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// auditTargets 返回一个审计文件中各条记录的 target，文件不存在时为 nil
+func auditTargets(t *testing.T, path string) []string {
+	t.Helper()
+	entries, err := readAuditFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, e := range entries {
+		targets = append(targets, e.Target)
+	}
+	return targets
+}
+
+func TestAuditRotation(t *testing.T) {
+	useTestState(t, ServerConfig{Audit: AuditConfig{MaxSizeMB: 1, MaxFiles: 2}}, nil)
+	recordAudit(AuditEntry{Action: AuditLogin, Target: "a"})
+	for _, target := range []string{"b", "c", "d"} {
+		fillAuditLog(t, DefaultAuditFile)
+		recordAudit(AuditEntry{Action: AuditLogin, Target: target})
+	}
+
+	// 每次轮转 audit.log -> .1 -> .2，超出 MaxFiles 的最旧文件（只含 a）被删除
+	want := map[string][]string{
+		DefaultAuditFile:        {"d"},
+		DefaultAuditFile + ".1": {"c"},
+		DefaultAuditFile + ".2": {"b"},
+		DefaultAuditFile + ".3": nil,
+	}
+	for path, targets := range want {
+		if got := auditTargets(t, path); !slices.Equal(got, targets) {
+			t.Errorf("%s targets = %q, want %q", path, got, targets)
+		}
+	}
+	entries, err := readAuditEntries(AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Target)
+	}
+	if !slices.Equal(got, []string{"d", "c", "b"}) {
+		t.Errorf("readAuditEntries targets = %q, want newest first d, c, b", got)
+	}
+}
+
+func TestAuditFilterMatches(t *testing.T) {
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	e := AuditEntry{Time: day, UserID: "42", Username: "Alice", Action: AuditRefresh, Target: "2025-03.json", Result: AuditOK}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"user=42", true},
+		{"user=ali", true},
+		{"user=4", false},
+		{"user=bob", false},
+		{"action=refresh", true},
+		{"action=login", false},
+		{"target=2025-03", true},
+		{"target=2025-04", false},
+		{"result=ok", true},
+		{"result=failed", false},
+		{"since=2025-03-10", true},
+		{"since=2025-03-11", false},
+		{"until=2025-03-10", true},
+		{"until=2025-03-09", false},
+		{"user=alice&action=refresh&since=2025-03-01&until=2025-03-31", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			f, err := parseAuditFilter(sessionRequest(t, "GET", "/admin/audit?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.matches(e); got != tt.want {
+				t.Errorf("matches(%s) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"since=2025-13-01", "until=yesterday", "limit=0", "limit=x"} {
+		if _, err := parseAuditFilter(sessionRequest(t, "GET", "/admin/audit?"+query, nil)); err == nil {
+			t.Errorf("parseAuditFilter(%s) succeeded, want error", query)
+		}
+	}
+	if f, _ := parseAuditFilter(sessionRequest(t, "GET", fmt.Sprintf("/admin/audit?limit=%d", auditPageMax+1), nil)); f.Limit != auditPageMax {
+		t.Errorf("limit = %d, want capped at %d", f.Limit, auditPageMax)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
-	"fmt"
+	"errors"
+	"log/slog"
+	"net/http"
 	"sync"
 	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
 )
 
 type PermissionCache struct {
@@ -11,6 +15,9 @@ type PermissionCache struct {
 	ExpiresAt time.Time
 }
 
+// 用户频道权限缓存的有效期
+const permCacheTTL = 2 * time.Hour
+
 var permCacheMu sync.RWMutex
 var permCache = make(map[string]*PermissionCache) // key: userID+guildID
 
@@ -21,13 +28,15 @@ func getPermissionFromCache(userID, guildID string) (map[string]bool, bool) {
 
 	key := userID + ":" + guildID
 	if cache, exists := permCache[key]; exists && time.Now().Before(cache.ExpiresAt) {
-		fmt.Printf("✅ 使用缓存权限 (user=%s)\n", userID)
+		slog.Debug("使用缓存权限", logKeyUserID, userID, "guild", guildID)
+		observeCache("permission", true)
 		return cache.Channels, true
 	}
+	observeCache("permission", false)
 	return nil, false
 }
 
-// 保存权限到缓存（2小时过期）
+// 保存权限到缓存（permCacheTTL 后过期）
 func setPermissionCache(userID, guildID string, channels map[string]bool) {
 	permCacheMu.Lock()
 	defer permCacheMu.Unlock()
@@ -35,9 +44,20 @@ func setPermissionCache(userID, guildID string, channels map[string]bool) {
 	key := userID + ":" + guildID
 	permCache[key] = &PermissionCache{
 		Channels:  channels,
-		ExpiresAt: time.Now().Add(2 * time.Hour),
+		ExpiresAt: time.Now().Add(permCacheTTL),
 	}
-	fmt.Printf("💾 缓存权限 (user=%s, ttl=5min)\n", userID)
+	slog.Debug("缓存权限", logKeyUserID, userID, "guild", guildID, "ttl", permCacheTTL)
+}
+
+// 清空所有用户的权限缓存（包括作者身份组）
+func clearPermissionCache() {
+	permCacheMu.Lock()
+	clear(permCache)
+	permCacheMu.Unlock()
+	memberRolesCacheMu.Lock()
+	clear(memberRolesCache)
+	clear(memberRolesCacheTime)
+	memberRolesCacheMu.Unlock()
 }
 
 // 缓存 guild 角色权限（1天过期）
@@ -49,10 +69,12 @@ func getGuildRolesPermsWithCache(token, guildID string) (map[string]uint64, erro
 	rolePermsCacheMu.RLock()
 	if cache, exists := rolePermsCache[guildID]; exists && time.Now().Before(rolePermsCacheTime[guildID].Add(24*time.Hour)) {
 		rolePermsCacheMu.RUnlock()
-		fmt.Printf("✅ 使用缓存 guild roles (guild=%s)\n", guildID)
+		slog.Debug("使用缓存的公会角色权限", "guild", guildID)
+		observeCache("role_perms", true)
 		return cache, nil
 	}
 	rolePermsCacheMu.RUnlock()
+	observeCache("role_perms", false)
 
 	// 调用 API 获取
 	rolePerms, err := getGuildRolesPerms(token, guildID)
@@ -64,3 +86,129 @@ func getGuildRolesPermsWithCache(token, guildID string) (map[string]uint64, erro
 	}
 	return rolePerms, err
 }
+
+// 缓存 guild 所有者（1天过期，与角色权限一致）
+var guildOwnerCacheMu sync.RWMutex
+var guildOwnerCache = make(map[string]string)
+var guildOwnerCacheTime = make(map[string]time.Time)
+
+func getGuildOwnerWithCache(token, guildID string) (string, error) {
+	guildOwnerCacheMu.RLock()
+	if owner, exists := guildOwnerCache[guildID]; exists && time.Now().Before(guildOwnerCacheTime[guildID].Add(24*time.Hour)) {
+		guildOwnerCacheMu.RUnlock()
+		observeCache("guild_owner", true)
+		return owner, nil
+	}
+	guildOwnerCacheMu.RUnlock()
+	observeCache("guild_owner", false)
+
+	owner, err := getGuildOwnerID(token, guildID)
+	if err == nil {
+		guildOwnerCacheMu.Lock()
+		guildOwnerCache[guildID] = owner
+		guildOwnerCacheTime[guildID] = time.Now()
+		guildOwnerCacheMu.Unlock()
+	}
+	return owner, err
+}
+
+// 缓存消息作者在公会中的身份组（与用户权限缓存一样 2 小时过期），供 role 高亮规则使用；已离开公会的作者记为没有身份组
+var memberRolesCacheMu sync.RWMutex
+var memberRolesCache = make(map[string][]string) // key: guildID:userID
+var memberRolesCacheTime = make(map[string]time.Time)
+
+func getMemberRolesWithCache(token, guildID, userID string) ([]string, error) {
+	key := guildID + ":" + userID
+	memberRolesCacheMu.RLock()
+	if roles, exists := memberRolesCache[key]; exists && time.Now().Before(memberRolesCacheTime[key].Add(permCacheTTL)) {
+		memberRolesCacheMu.RUnlock()
+		observeCache("member_roles", true)
+		return roles, nil
+	}
+	memberRolesCacheMu.RUnlock()
+	observeCache("member_roles", false)
+
+	roles, err := getUserRolesInGuild(token, guildID, userID)
+	var statusErr *discord.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		roles, err = []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	memberRolesCacheMu.Lock()
+	memberRolesCache[key] = roles
+	memberRolesCacheTime[key] = time.Now()
+	memberRolesCacheMu.Unlock()
+	return roles, nil
+}
+
+// 缓存帖子(子区)频道对象（1天过期）；无权访问的结果与用户有关，不缓存
+var threadCacheMu sync.RWMutex
+var threadCache = make(map[string]*DiscordChannel)
+var threadCacheTime = make(map[string]time.Time)
+
+func getThreadChannelWithCache(token, threadID string) (*DiscordChannel, error) {
+	threadCacheMu.RLock()
+	if ch, exists := threadCache[threadID]; exists && time.Now().Before(threadCacheTime[threadID].Add(24*time.Hour)) {
+		threadCacheMu.RUnlock()
+		observeCache("thread", true)
+		return ch, nil
+	}
+	threadCacheMu.RUnlock()
+	observeCache("thread", false)
+
+	ch, err := getThreadChannel(token, threadID)
+	if err == nil && ch != nil {
+		threadCacheMu.Lock()
+		threadCache[threadID] = ch
+		threadCacheTime[threadID] = time.Now()
+		threadCacheMu.Unlock()
+	}
+	return ch, err
+}
+
+// 缓存通过 Discord 接口查到的跨月份被回复消息（nil 表示原消息已不存在）
+// 与权限缓存一样设置有效期，并限制条目数，避免长时间运行后无限增长
+const (
+	replyMsgCacheTTL = 2 * time.Hour
+	replyMsgCacheMax = 5000
+)
+
+type replyMsgCacheEntry struct {
+	Message   *DiscordMessage
+	ExpiresAt time.Time
+}
+
+var replyMsgCacheMu sync.RWMutex
+var replyMsgCache = make(map[string]replyMsgCacheEntry)
+
+func getReplyMsgFromCache(msgID string) (*DiscordMessage, bool) {
+	replyMsgCacheMu.RLock()
+	defer replyMsgCacheMu.RUnlock()
+	entry, exists := replyMsgCache[msgID]
+	exists = exists && time.Now().Before(entry.ExpiresAt)
+	observeCache("reply", exists)
+	return entry.Message, exists
+}
+
+func setReplyMsgCache(msgID string, msg *DiscordMessage) {
+	replyMsgCacheMu.Lock()
+	defer replyMsgCacheMu.Unlock()
+	now := time.Now()
+	if _, exists := replyMsgCache[msgID]; !exists && len(replyMsgCache) >= replyMsgCacheMax {
+		// 先清理过期条目，仍然满了就淘汰最早过期的
+		oldest := ""
+		for id, entry := range replyMsgCache {
+			if !now.Before(entry.ExpiresAt) {
+				delete(replyMsgCache, id)
+			} else if oldest == "" || entry.ExpiresAt.Before(replyMsgCache[oldest].ExpiresAt) {
+				oldest = id
+			}
+		}
+		if len(replyMsgCache) >= replyMsgCacheMax {
+			delete(replyMsgCache, oldest)
+		}
+	}
+	replyMsgCache[msgID] = replyMsgCacheEntry{Message: msg, ExpiresAt: now.Add(replyMsgCacheTTL)}
+}
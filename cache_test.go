@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+func TestReplyMsgCacheExpires(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	setReplyMsgCache("m1", &DiscordMessage{ID: "m1"})
+	if msg, ok := getReplyMsgFromCache("m1"); !ok || msg.ID != "m1" {
+		t.Fatalf("fresh entry = %v, %v", msg, ok)
+	}
+
+	replyMsgCacheMu.Lock()
+	entry := replyMsgCache["m1"]
+	entry.ExpiresAt = time.Now().Add(-time.Second)
+	replyMsgCache["m1"] = entry
+	replyMsgCacheMu.Unlock()
+	if _, ok := getReplyMsgFromCache("m1"); ok {
+		t.Error("expired entry still returned")
+	}
+}
+
+func TestReplyMsgCacheBounded(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	for i := range replyMsgCacheMax + 10 {
+		id := strconv.Itoa(i)
+		setReplyMsgCache(id, &DiscordMessage{ID: id})
+	}
+	replyMsgCacheMu.RLock()
+	n := len(replyMsgCache)
+	replyMsgCacheMu.RUnlock()
+	if n > replyMsgCacheMax {
+		t.Errorf("cache has %d entries, want at most %d", n, replyMsgCacheMax)
+	}
+	last := strconv.Itoa(replyMsgCacheMax + 9)
+	if _, ok := getReplyMsgFromCache(last); !ok {
+		t.Errorf("newest entry %s was evicted", last)
+	}
+}
+
+// 404 说明消息不存在，可以缓存；403 只说明当前 Token 看不到，必须作为错误返回
+func TestFetchMessageByIDForbiddenIsNotMissing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/channels/403/messages":
+			http.Error(w, `{"message":"Missing Access","code":50001}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"message":"Unknown Channel","code":10003}`, http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	discord.SetAPIBase(ts.URL)
+	defer discord.SetAPIBase("")
+
+	msg, err := fetchMessageByID(ts.Client(), "Bot x", "404", "1")
+	if msg != nil || err != nil {
+		t.Errorf("404: got %v, %v; want nil, nil", msg, err)
+	}
+	_, err = fetchMessageByID(ts.Client(), "Bot x", "403", "1")
+	var statusErr *discord.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("403: err = %v, want 403 StatusError", err)
+	}
+}
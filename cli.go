@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 命令行入口 (serve / scrape / sync / export / import / verify / invite)
+// ==========================================
+
+const cliUsage = `用法: EricChatViewer [子命令] [参数]
+
+子命令:
+  serve    启动 Web 查看器（默认）
+  scrape   抓取指定频道的全部历史消息并写入文件
+  sync     增量同步 post_config.json 中某个（-all 为全部）月份到 data/ 目录，或用 -channel / -channels 同步指定频道
+  export   导出存档为 json 或 csv
+  import   将外部 JSON 文件合并进 data/ 中的存档
+  verify   检查存档文件能否被查看器正确加载
+  fake-discord  启动本地假 Discord 服务器（以存档数据为种子），用于离线测试
+  invite   生成只读访客邀请链接（需要配置 session_secret）
+  hash-password  生成访客账号的密码哈希（写入 server_config.json 的 guest_accounts）
+
+运行 "EricChatViewer <子命令> -h" 查看各子命令参数。
+`
+
+func runCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
+	}
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:])
+	case "scrape":
+		return runScrape(args[1:])
+	case "sync":
+		return runSync(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "verify":
+		return runVerify(args[1:])
+	case "fake-discord":
+		return runFakeDiscord(args[1:])
+	case "invite":
+		return runInvite(args[1:])
+	case "hash-password":
+		return runHashPassword(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+		return nil
+	}
+	fmt.Print(cliUsage)
+	return fmt.Errorf("未知子命令: %s", args[0])
+}
+
+// 抓取类子命令共用的 token / 代理 / API 地址参数
+type discordFlags struct {
+	token, proxy, apiBase *string
+	record, replay        *string
+	bot                   *bool
+}
+
+func addDiscordFlags(fs *flag.FlagSet) discordFlags {
+	return discordFlags{
+		token:   fs.String("token", "", "Discord Token（默认读取环境变量 DISCORD_TOKEN，-bot 时读取 DISCORD_BOT_TOKEN）"),
+		proxy:   fs.String("proxy", "", "代理地址（默认读取 proxy.txt）"),
+		apiBase: fs.String("api-base", "", "Discord API 地址（默认读取环境变量 DISCORD_API_BASE，测试时可指向 fake-discord）"),
+		record:  fs.String("record", "", "把所有 Discord 请求 / 响应录制到该目录（Authorization 会被替换）"),
+		replay:  fs.String("replay", "", "只从该目录中录制的 fixture 返回响应，不访问网络"),
+		bot:     fs.Bool("bot", false, "使用 Bot Token，请求时自动加上 \"Bot \" 前缀"),
+	}
+}
+
+// authorization 返回请求使用的 Authorization 值：-bot 时加上 "Bot " 前缀
+func (f discordFlags) authorization() string {
+	if *f.bot {
+		return discord.BotAuthorization(cmp.Or(*f.token, os.Getenv("DISCORD_BOT_TOKEN")))
+	}
+	return cmp.Or(*f.token, os.Getenv("DISCORD_TOKEN"))
+}
+
+// scrapeConfig 是 sync -config 读取的抓取配置文件（原 scripts/dc_api 的 config.json）
+type scrapeConfig struct {
+	ChannelID string `json:"channel_id"`
+	AuthToken string `json:"auth_token"`
+	ProxyAddr string `json:"proxy_addr"`
+	APIBase   string `json:"api_base"`
+	TokenType string `json:"token_type"` // "bot" 表示 auth_token 为 Bot Token
+}
+
+// loadScrapeConfig 读取配置文件，同目录的 <名称>.local<扩展名>（如 config.local.json）存在时覆盖其中的非空字段
+func loadScrapeConfig(path string) (scrapeConfig, error) {
+	var cfg scrapeConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s 解析失败: %w", path, err)
+	}
+
+	ext := filepath.Ext(path)
+	localPath := strings.TrimSuffix(path, ext) + ".local" + ext
+	data, err = os.ReadFile(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+	var local scrapeConfig
+	if err := json.Unmarshal(data, &local); err != nil {
+		return cfg, fmt.Errorf("%s 解析失败: %w", localPath, err)
+	}
+	cfg.ChannelID = cmp.Or(strings.TrimSpace(local.ChannelID), cfg.ChannelID)
+	cfg.AuthToken = cmp.Or(strings.TrimSpace(local.AuthToken), cfg.AuthToken)
+	cfg.ProxyAddr = cmp.Or(strings.TrimSpace(local.ProxyAddr), cfg.ProxyAddr)
+	cfg.APIBase = cmp.Or(strings.TrimSpace(local.APIBase), cfg.APIBase)
+	cfg.TokenType = cmp.Or(strings.TrimSpace(local.TokenType), cfg.TokenType)
+	return cfg, nil
+}
+
+// useConfig 用配置文件补齐命令行没有给出的 token / 代理 / API 地址（命令行参数优先）
+func (f discordFlags) useConfig(cfg scrapeConfig) {
+	if *f.token == "" && cfg.AuthToken != "" {
+		*f.token = cfg.AuthToken
+		*f.bot = *f.bot || strings.EqualFold(cfg.TokenType, "bot")
+	}
+	*f.proxy = cmp.Or(*f.proxy, cfg.ProxyAddr)
+	if os.Getenv("DISCORD_API_BASE") == "" {
+		*f.apiBase = cmp.Or(*f.apiBase, cfg.APIBase)
+	}
+}
+
+// apply 在参数解析后设置代理、API 地址和录制 / 回放模式
+func (f discordFlags) apply() error {
+	loadProxy()
+	if *f.proxy != "" {
+		ProxyURL = *f.proxy
+	}
+	loadServerConfig()
+	applyAPIBase(*f.apiBase)
+	return applyFixtureFlags(*f.record, *f.replay)
+}
+
+// applyFixtureFlags 开启录制或回放（二者只能选一个）
+func applyFixtureFlags(record, replay string) error {
+	switch {
+	case record != "" && replay != "":
+		return errors.New("-record 和 -replay 不能同时使用")
+	case record != "":
+		fmt.Printf("⏺️ 录制 Discord 请求到 %s\n", record)
+		return discord.EnableRecording(record)
+	case replay != "":
+		fmt.Printf("▶️ 从 %s 回放 Discord 响应\n", replay)
+		return discord.EnableReplay(replay)
+	}
+	return nil
+}
+
+// scrape：抓取频道全部历史
+func runScrape(args []string) error {
+	fs := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	channel := fs.String("channel", "", "频道 / 帖子 ID")
+	out := fs.String("o", "", "输出 JSON 文件，例如 data/2025-01.json")
+	df := addDiscordFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel == "" || *out == "" || df.authorization() == "" {
+		fs.Usage()
+		return errors.New("-channel、-o 和 -token 均为必填")
+	}
+	if err := df.apply(); err != nil {
+		return err
+	}
+
+	// 抓取中断时不覆盖输出文件：部分结果会丢掉已有存档中较早的消息，应改用 sync 增量补齐（可从中断处继续）
+	f := &discord.Fetcher{Client: getClient(), Token: df.authorization()}
+	msgs, err := f.FetchMessages(context.Background(), *channel, "")
+	var partial *discord.PartialError
+	if errors.As(err, &partial) {
+		return fmt.Errorf("只获取了 %d 条，未写入 %s，可改用 sync -channel %s -o %s 继续: %w", len(msgs), *out, *channel, *out, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := discord.SaveArchive(*out, msgs); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 已将 %d 条数据写入 %s\n", len(msgs), *out)
+	return nil
+}
+
+// sync：增量同步某个月份的存档（data/<file>），或某个频道到指定文件
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	file := fs.String("f", "", "post_config.json 中的 file_name，例如 2025-12.json")
+	all := fs.Bool("all", false, "同步 post_config.json 中的所有月份")
+	channel := fs.String("channel", "", "增量同步单个频道 / 帖子到 -o（不需要 post_config.json），默认读取 -config 中的 channel_id")
+	channels := fs.String("channels", "", "逗号分隔的频道 / 帖子 ID（不需要 post_config.json），存档为 data/<ID>.json，与 -all 一样并发同步")
+	out := fs.String("o", "", "-channel 时的输出文件，默认为 data/<频道ID>.json；不存在时全量抓取")
+	config := fs.String("config", "", "抓取配置文件（channel_id / auth_token / proxy_addr / api_base / token_type），命令行参数优先")
+	workers := fs.Int("workers", 2, "-all / -channels 时的并发数")
+	interval := fs.Duration("interval", time.Second, "-all / -channels 时所有并发任务共享的请求间隔")
+	rescan := fs.Duration("rescan", 0, "额外重新扫描最新消息之前的时间窗口以获取编辑，例如 24h")
+	df := addDiscordFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *config != "" {
+		cfg, err := loadScrapeConfig(*config)
+		if err != nil {
+			return fmt.Errorf("读取抓取配置失败: %w", err)
+		}
+		df.useConfig(cfg)
+		if *file == "" && !*all && *channels == "" {
+			*channel = cmp.Or(*channel, cfg.ChannelID)
+		}
+	}
+	if (*file == "" && !*all && *channel == "" && *channels == "") || df.authorization() == "" {
+		fs.Usage()
+		return errors.New("需要 -f、-all、-channel 或 -channels 之一，以及 -token")
+	}
+	if err := df.apply(); err != nil {
+		return err
+	}
+
+	if *channel != "" && *file == "" && !*all && *channels == "" {
+		return syncChannel(df.authorization(), *channel, cmp.Or(*out, filepath.Join(DataDir, *channel+".json")), *rescan)
+	}
+
+	var posts []PostConfig
+	if *file != "" || *all {
+		if err := ensurePostList(); err != nil {
+			return err
+		}
+		posts = getPostList()
+		if !*all {
+			cfg, ok := findPostConfig(*file)
+			if !ok {
+				return fmt.Errorf("%s 中没有文件 %s 的配置", PostFiles, *file)
+			}
+			posts = []PostConfig{cfg}
+		}
+	}
+	// -channels 的帖子不在月份列表中，临时按 <ID>.json 存档
+	ids := strings.FieldsFunc(*channels, func(r rune) bool { return r == ',' || r == ' ' })
+	posts = append(posts, discord.PostsFromChannelIDs(ids)...)
+	if len(posts) == 0 {
+		return errors.New("没有需要同步的帖子")
+	}
+
+	base := &discord.Fetcher{Client: getClient(), Token: df.authorization(), Limiter: discord.NewRateLimiter(*interval)}
+	// Ctrl+C 取消同步，已抓取的部分仍会写入存档
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := discord.SyncPosts(ctx, base, posts, discord.BatchOptions{
+		DataDir: DataDir,
+		Workers: *workers,
+		Rescan:  *rescan,
+		Progress: func(post PostConfig, p discord.FetchProgress) {
+			fmt.Printf("[%s] 第 %d 页，已收集 %d 条，游标 %s\n", post.FileName, p.Pages, p.Messages, p.CursorID)
+		},
+	})
+	if !printBatchSummary(os.Stdout, results) {
+		return errors.New("部分月份未能完整同步")
+	}
+	return nil
+}
+
+// printBatchSummary 输出每个帖子的结果和成功 / 部分成功 / 失败的汇总，全部完整同步时返回 true
+func printBatchSummary(w io.Writer, results []discord.BatchResult) bool {
+	fmt.Fprintln(w, "-------------------------------------------")
+	for _, r := range results {
+		switch r.Status {
+		case discord.BatchSuccess:
+			fmt.Fprintf(w, "✅ %s: 新增 %d 条，编辑 %d 条，共 %d 条 (%v)\n", r.Post.FileName, r.Result.Added, r.Result.Updated, r.Result.Total, r.Duration.Round(time.Second))
+		case discord.BatchPartial:
+			fmt.Fprintf(w, "⚠️ %s: 部分成功，新增 %d 条，共 %d 条: %v\n", r.Post.FileName, r.Result.Added, r.Result.Total, r.Err)
+		default:
+			fmt.Fprintf(w, "❌ %s: %v\n", r.Post.FileName, r.Err)
+		}
+	}
+	s := discord.SummarizeBatch(results)
+	fmt.Fprintf(w, "汇总: 成功 %d，部分成功 %d，失败 %d，共 %d\n", s.Success, s.Partial, s.Failed, s.Total())
+	return s.OK()
+}
+
+// syncChannel 增量同步单个频道到 path，中途出错时已抓到的部分仍会写入
+func syncChannel(token, channelID, path string, rescan time.Duration) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	res, err := discord.SyncArchive(getClient(), token, channelID, path, rescan)
+	var partial *discord.PartialError
+	switch {
+	case errors.As(err, &partial):
+		fmt.Printf("⚠️ 增量同步部分成功，已写入 %d 条 -> %s\n", res.Total, path)
+		return err
+	case err != nil:
+		return err
+	case res.Full:
+		fmt.Printf("✅ 输出文件不存在，已全量抓取 %d 条 -> %s\n", res.Total, path)
+	default:
+		fmt.Printf("✅ 新增 %d 条，编辑 %d 条，当前共 %d 条 -> %s\n", res.Added, res.Updated, res.Total, path)
+	}
+	return nil
+}
+
+// export：导出存档为 json 或 csv
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	file := fs.String("f", "", "存档文件名（data/ 下）或路径")
+	format := fs.String("format", "json", "导出格式: json / csv")
+	out := fs.String("o", "", "输出文件，默认输出到标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return errors.New("-f 为必填")
+	}
+
+	msgs, err := loadArchiveArg(*file)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(msgs)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "timestamp", "author_id", "author", "content", "reply_to", "attachments"})
+		for _, m := range msgs {
+			replyTo := ""
+			if m.MsgRef != nil {
+				replyTo = m.MsgRef.MessageID
+			}
+			var urls []string
+			for _, att := range m.Attachments {
+				urls = append(urls, att.URL)
+			}
+			cw.Write([]string{m.ID, m.Timestamp, m.Author.ID, m.Author.Username, m.Content, replyTo, strings.Join(urls, " ")})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("不支持的导出格式: %s", *format)
+}
+
+// import：把外部 JSON（如旧版抓取脚本的输出）合并进 data/<file>
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("i", "", "要导入的 JSON 文件")
+	file := fs.String("f", "", "目标存档文件名（写入 data/ 下）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *file == "" {
+		fs.Usage()
+		return errors.New("-i 和 -f 均为必填")
+	}
+
+	incoming, err := discord.LoadArchive(*in)
+	if err != nil {
+		return err
+	}
+	if problems := discord.VerifyArchive(incoming); len(problems) > 0 {
+		return fmt.Errorf("%s 校验失败: %s", *in, strings.Join(problems, "; "))
+	}
+
+	path := filepath.Join(DataDir, *file)
+	existing, err := discord.LoadArchive(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	merged, added := discord.MergeMessages(existing, incoming)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := discord.SaveArchive(path, merged); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 导入 %s -> %s，新增 %d 条，当前共 %d 条\n", *in, path, added, len(merged))
+	return nil
+}
+
+// verify：检查存档文件，不带参数时检查 post_config.json 中配置的所有月份
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		if err := ensurePostList(); err != nil {
+			return err
+		}
+		for _, cfg := range getPostList() {
+			files = append(files, cfg.FileName)
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		msgs, err := loadArchiveArg(file)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", file, err)
+			failed++
+			continue
+		}
+		problems := discord.VerifyArchive(msgs)
+		if len(problems) == 0 {
+			fmt.Printf("✅ %s: %d 条消息\n", file, len(msgs))
+			continue
+		}
+		failed++
+		fmt.Printf("❌ %s: %d 个问题\n", file, len(problems))
+		for _, p := range problems {
+			fmt.Printf("   - %s\n", p)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d 个存档未通过校验", failed, len(files))
+	}
+	return nil
+}
+
+// loadArchiveArg 参数既可以是路径，也可以是 data/ 下（或内嵌数据中）的文件名
+func loadArchiveArg(arg string) ([]DiscordMessage, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return discord.LoadArchive(arg)
+	}
+	return loadArchiveFile(filepath.Base(arg))
+}
+
+// fake-discord：以 post_config.json 中各月份的存档为种子启动假 Discord 服务器
+func runFakeDiscord(args []string) error {
+	fs := flag.NewFlagSet("fake-discord", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:9977", "监听地址")
+	users := fs.String("users", "fake-token:10000:fake-user", "逗号分隔的用户列表，格式 token:用户ID:用户名")
+	rateLimitEvery := fs.Int("rate-limit-every", 0, "每 N 次消息请求返回一次 429，0 为不限速")
+	clientID := fs.String("client-id", "", "OAuth2 client_id，为空时不校验")
+	clientSecret := fs.String("client-secret", "", "OAuth2 client_secret")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	srv := discord.NewFakeServer(GuildID)
+	srv.RateLimitEvery = *rateLimitEvery
+	srv.OAuthClientID, srv.OAuthClientSecret = *clientID, *clientSecret
+	// @everyone 已可查看频道；再给假用户一个成员角色，便于在覆写中按角色测试
+	memberRole := discord.Role{ID: "20000", Name: "member", Permissions: strconv.Itoa(discord.PermViewChannel | discord.PermReadMessageHistory)}
+	srv.AddRole(memberRole)
+	for _, spec := range strings.Split(*users, ",") {
+		parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("无效的用户格式: %q（应为 token:用户ID:用户名）", spec)
+		}
+		srv.AddUser(discord.FakeUser{Token: parts[0], ID: parts[1], Username: parts[2], Roles: []string{memberRole.ID}})
+	}
+
+	// 每个社区一个论坛频道 + 每个月份一个帖子；假服务器只有一个公会，其他公会的社区不加入
+	loadServerConfig()
+	for _, c := range getCommunities() {
+		if c.GuildID == srv.GuildID {
+			srv.AddChannel(discord.Channel{ID: c.ChannelID, Name: c.Name, Type: 15})
+		}
+	}
+	if err := ensurePostList(); err != nil {
+		return err
+	}
+	for _, cfg := range getPostList() {
+		community := communityOf(cfg.FileName)
+		if community.GuildID != srv.GuildID {
+			continue
+		}
+		srv.AddChannel(discord.Channel{ID: cfg.PostID, Name: cfg.Title, ParentID: community.ChannelID, Type: 11})
+		msgs, err := loadArchiveFile(cfg.FileName)
+		if err != nil {
+			continue
+		}
+		srv.SeedMessages(cfg.PostID, msgs)
+	}
+
+	base := "http://" + *addr
+	fmt.Println("-------------------------------------------")
+	fmt.Printf("🧪 假 Discord 服务器已启动 (%s)\n", srv)
+	fmt.Printf("👉 API 地址: %s（serve / sync 的 -api-base 参数或 DISCORD_API_BASE）\n", srv.APIBase(base))
+	fmt.Printf("👉 Gateway: %s（server_config.json 的 live.gateway_url）\n", srv.GatewayURL(base))
+	fmt.Printf("👉 OAuth2 授权页: %s/oauth2/authorize（?user=<用户ID> 选择登录的用户）\n", srv.APIBase(base))
+	fmt.Println("-------------------------------------------")
+	return http.ListenAndServe(*addr, srv)
+}
+
+// invite：生成只读访客邀请链接
+func runInvite(args []string) error {
+	fs := flag.NewFlagSet("invite", flag.ContinueOnError)
+	name := fs.String("name", "", "访客名称（显示在页面和日志中）")
+	ttl := fs.Duration("ttl", DefaultInviteTTL, "链接有效期")
+	communities := fs.String("communities", "", "可查看的社区 ID，逗号分隔，默认社区写作 default；为空表示全部社区")
+	base := fs.String("base", "http://localhost:"+Port, "查看器的访问地址")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *ttl <= 0 {
+		fs.Usage()
+		return errors.New("-name 必填，-ttl 必须大于 0")
+	}
+	if err := loadServerConfig(); err != nil {
+		return err
+	}
+	var refs []string
+	if *communities != "" {
+		refs = strings.Split(*communities, ",")
+	}
+	ids, err := resolveGuestCommunities(refs)
+	if err != nil {
+		return err
+	}
+	token, err := newInviteToken(*name, ids, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🎟️ 访客 [%s] 的只读邀请链接（有效期至 %s）:\n%s/invite?t=%s\n",
+		*name, time.Now().Add(*ttl).Format("2006-01-02 15:04"), strings.TrimRight(*base, "/"), url.QueryEscape(token))
+	return nil
+}
+
+// hash-password：为访客账号生成密码哈希
+func runHashPassword(args []string) error {
+	fs := flag.NewFlagSet("hash-password", flag.ContinueOnError)
+	password := fs.String("p", "", "密码（为空时从标准输入读取一行）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pw := *password
+	if pw == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("请通过 -p 或标准输入提供密码")
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	}
+	if pw == "" {
+		return errors.New("密码不能为空")
+	}
+	hash, err := hashPassword(pw)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
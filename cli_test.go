@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// sync -config 读取抓取配置（config.local.json 覆盖），增量同步单个频道到 -o
+func TestSyncChannelFromConfig(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	t.Setenv("DISCORD_TOKEN", "")
+	t.Setenv("DISCORD_API_BASE", "")
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: "local-token", ID: "1", Username: "alice"})
+	fake.AddChannel(discord.Channel{ID: "111"})
+	fake.SeedMessages("111", testMessages("1000001", "1000002", "1000003"))
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	defer discord.SetAPIBase("")
+
+	writeFile(t, "config.json", `{"channel_id": "111", "auth_token": "stale-token", "api_base": "`+fake.APIBase(ts.URL)+`"}`)
+	writeFile(t, "config.local.json", `{"auth_token": "local-token"}`)
+
+	out := filepath.Join("archives", "111.json")
+	if err := runSync([]string{"-config", "config.json", "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := discord.LoadArchive(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Errorf("synced %d messages, want 3", len(msgs))
+	}
+
+	// 再次同步只抓取新消息
+	fake.SeedMessages("111", testMessages("1000004"))
+	if err := runSync([]string{"-config", "config.json", "-o", out}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ = discord.LoadArchive(out); len(msgs) != 4 {
+		t.Errorf("after incremental sync: %d messages, want 4", len(msgs))
+	}
+}
+
+func TestSyncRequiresTarget(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	if err := runSync([]string{"-token", "x"}); err == nil {
+		t.Error("sync without -f, -all or -channel succeeded")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sync -channels 不读取 post_config.json，每个频道存为 data/<ID>.json
+func TestSyncChannelList(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	t.Setenv("DISCORD_API_BASE", "")
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: "t", ID: "1", Username: "alice"})
+	fake.SeedMessages("111", testMessages("1000001", "1000002"))
+	fake.SeedMessages("222", testMessages("2000001"))
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	defer discord.SetAPIBase("")
+
+	err := runSync([]string{"-channels", "111, 222,", "-token", "t", "-interval", "1ms", "-api-base", fake.APIBase(ts.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]int{"111": 2, "222": 1} {
+		if got := loadTestArchive(t, id+".json"); len(got) != want {
+			t.Errorf("%s.json has %d messages, want %d", id, len(got), want)
+		}
+	}
+
+	if err := runSync([]string{"-channels", ",", "-token", "t"}); err == nil {
+		t.Error("empty channel list succeeded")
+	}
+}
+
+// scrape 中途失败时不覆盖已有的输出文件，并返回错误（非零退出）
+func TestScrapeKeepsOutputOnPartialFetch(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	t.Setenv("DISCORD_API_BASE", "")
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: "t", ID: "1", Username: "alice"})
+	var ids []string
+	for i := range 150 {
+		ids = append(ids, strconv.Itoa(1000001+i))
+	}
+	fake.SeedMessages("111", testMessages(ids...))
+	// 第一页之后的翻页请求都失败
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("before") != "" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	defer discord.SetAPIBase("")
+
+	out := "111.json"
+	if err := discord.SaveArchive(out, testMessages("900001", "900002")); err != nil {
+		t.Fatal(err)
+	}
+	err := runScrape([]string{"-channel", "111", "-o", out, "-token", "t", "-api-base", fake.APIBase(ts.URL)})
+	var partial *discord.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("scrape error = %v, want *discord.PartialError", err)
+	}
+	if msgs, err := discord.LoadArchive(out); err != nil || len(msgs) != 2 || msgs[0].ID != "900001" {
+		t.Errorf("output after partial scrape = %d messages, %v; want the old archive", len(msgs), err)
+	}
+}
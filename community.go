@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ==========================================
+// 多社区 (Communities)
+// ==========================================
+
+// 默认社区即原来的单社区部署：常量 GuildID / ChannelID、post_config.json、highlight_rules.json 和 data/ 目录
+const DefaultCommunityName = "新手答疑"
+
+func defaultCommunity() CommunityConfig {
+	return CommunityConfig{
+		Name:           DefaultCommunityName,
+		GuildID:        GuildID,
+		ChannelID:      ChannelID,
+		PostConfig:     PostFiles,
+		HighlightRules: HighlightRulesFile,
+	}
+}
+
+// getCommunities 返回所有社区，默认社区排在第一个
+func getCommunities() []CommunityConfig {
+	return resolveCommunities(getServerConfig().Communities)
+}
+
+// resolveCommunities 合并默认社区并补齐默认值；id 为空的条目用于修改默认社区
+func resolveCommunities(configured []CommunityConfig) []CommunityConfig {
+	def := defaultCommunity()
+	list := []CommunityConfig{def}
+	for _, c := range configured {
+		if c.ID == "" {
+			if c.Name != "" {
+				list[0].Name = c.Name
+			}
+			if c.GuildID != "" {
+				list[0].GuildID = c.GuildID
+			}
+			if c.ChannelID != "" {
+				list[0].ChannelID = c.ChannelID
+			}
+			if c.PostConfig != "" {
+				list[0].PostConfig = c.PostConfig
+			}
+			if c.HighlightRules != "" {
+				list[0].HighlightRules = c.HighlightRules
+			}
+			continue
+		}
+		if c.Name == "" {
+			c.Name = c.ID
+		}
+		if c.PostConfig == "" {
+			c.PostConfig = "post_config." + c.ID + ".json"
+		}
+		if c.HighlightRules == "" {
+			c.HighlightRules = "highlight_rules." + c.ID + ".json"
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+// validateCommunities 检查 server_config.json 中的社区配置
+func validateCommunities(configured []CommunityConfig) error {
+	seen := make(map[string]bool)
+	for _, c := range configured {
+		if c.ID == "" {
+			continue
+		}
+		if strings.ContainsAny(c.ID, `/\:. `) {
+			return fmt.Errorf("社区 id %q 只能包含字母、数字、- 和 _", c.ID)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("社区 id %q 重复", c.ID)
+		}
+		seen[c.ID] = true
+		if c.GuildID == "" || c.ChannelID == "" {
+			return fmt.Errorf("社区 %q 缺少 guild_id 或 channel_id", c.ID)
+		}
+	}
+	return nil
+}
+
+// postKey 返回月份在整个部署中唯一的文件名：默认社区保持原样，其他社区加上 "<id>/" 前缀（即 data/<id>/ 下的存档）
+func postKey(c CommunityConfig, file string) string {
+	if c.ID == "" {
+		return file
+	}
+	return c.ID + "/" + file
+}
+
+// communityOf 根据月份文件名找到所属社区，找不到时返回默认社区
+func communityOf(file string) CommunityConfig {
+	id, _, found := strings.Cut(file, "/")
+	communities := getCommunities()
+	if found {
+		for _, c := range communities {
+			if c.ID == id {
+				return c
+			}
+		}
+	}
+	return communities[0]
+}
+
+// communityByRef 按 ID 查找社区，"default" 表示默认社区（ID 为空）
+func communityByRef(ref string) (CommunityConfig, bool) {
+	id := strings.TrimSpace(ref)
+	if id == DefaultCommunityRef {
+		id = ""
+	}
+	for _, c := range getCommunities() {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return CommunityConfig{}, false
+}
+
+// communityRef 与 communityByRef 相反，默认社区返回 "default"
+func communityRef(c CommunityConfig) string {
+	if c.ID == "" {
+		return DefaultCommunityRef
+	}
+	return c.ID
+}
+
+// loadCommunityPosts 读取某个社区的月份列表并加上文件名前缀
+func loadCommunityPosts(c CommunityConfig) ([]PostConfig, error) {
+	posts, err := loadPostConfigFile(c.PostConfig, c.ID == "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].FileName = postKey(c, posts[i].FileName)
+	}
+	return posts, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+)
+
+// 两个额外社区：art 使用默认文件名，music 指定了月份列表文件
+var testCommunities = []CommunityConfig{
+	{ID: "art", GuildID: "g-art", ChannelID: "c-art"},
+	{ID: "music", Name: "音乐", GuildID: "g-music", ChannelID: "c-music", PostConfig: "music_posts.json"},
+}
+
+func TestLoadCommunityPosts(t *testing.T) {
+	useTestState(t, ServerConfig{Communities: testCommunities}, nil)
+	writeFile(t, "post_config.art.json", `[{"file_name": "2025-01.json", "post_id": "201"}]`)
+	writeFile(t, "music_posts.json", `[{"file_name": "2025-01.json", "post_id": "301"}, {"file_name": "2025-02.json", "post_id": "302"}]`)
+
+	communities := getCommunities()
+	if len(communities) != 3 || communities[0].ID != "" || communities[1].ID != "art" || communities[2].ID != "music" {
+		t.Fatalf("communities = %+v, want default first then art, music", communities)
+	}
+	if c := communities[1]; c.Name != "art" || c.PostConfig != "post_config.art.json" || c.HighlightRules != "highlight_rules.art.json" {
+		t.Errorf("art defaults = %+v", c)
+	}
+
+	posts, err := fetchPostConfigurations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtin, err := loadPostConfigFile(PostFiles, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builtin) == 0 {
+		t.Fatal("default community has no built-in month list")
+	}
+	if len(posts) != len(builtin)+3 {
+		t.Fatalf("got %d months, want %d built-in + 3", len(posts), len(builtin))
+	}
+	want := map[string]string{"art/2025-01.json": "201", "music/2025-01.json": "301", "music/2025-02.json": "302", builtin[0].FileName: builtin[0].PostID}
+	for _, p := range posts {
+		if id, ok := want[p.FileName]; ok {
+			if p.PostID != id {
+				t.Errorf("%s post_id = %s, want %s", p.FileName, p.PostID, id)
+			}
+			delete(want, p.FileName)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing months: %v", want)
+	}
+
+	// 其他社区的月份列表不存在时报错，而不是使用默认社区的内置列表
+	useTestState(t, ServerConfig{Communities: testCommunities[:1]}, nil)
+	if _, err := fetchPostConfigurations(); err == nil {
+		t.Error("missing post_config.art.json did not fail")
+	}
+}
+
+func TestCommunityOf(t *testing.T) {
+	useTestState(t, ServerConfig{Communities: testCommunities}, nil)
+	tests := []struct {
+		file, want string
+	}{
+		{"2025-01.json", ""},
+		{"art/2025-01.json", "art"},
+		{"music/2025-02.json", "music"},
+		{"unknown/2025-01.json", ""},
+	}
+	for _, tt := range tests {
+		if c := communityOf(tt.file); c.ID != tt.want {
+			t.Errorf("communityOf(%q) = %q, want %q", tt.file, c.ID, tt.want)
+		}
+	}
+	if c := communityOf("music/2025-02.json"); c.GuildID != "g-music" || c.ChannelID != "c-music" {
+		t.Errorf("communityOf(music) = %+v", c)
+	}
+}
+
+func TestCommunityByRef(t *testing.T) {
+	useTestState(t, ServerConfig{Communities: append([]CommunityConfig{{Name: "答疑"}}, testCommunities...)}, nil)
+	tests := []struct {
+		ref, wantID string
+		wantOK      bool
+	}{
+		{DefaultCommunityRef, "", true},
+		{" art ", "art", true},
+		{"music", "music", true},
+		{"", "", true},
+		{"unknown", "", false},
+	}
+	for _, tt := range tests {
+		c, ok := communityByRef(tt.ref)
+		if ok != tt.wantOK || c.ID != tt.wantID {
+			t.Errorf("communityByRef(%q) = %q, %v, want %q, %v", tt.ref, c.ID, ok, tt.wantID, tt.wantOK)
+		}
+	}
+	// id 为空的条目只修改默认社区的名称，其余沿用默认值
+	if c, _ := communityByRef(DefaultCommunityRef); c.Name != "答疑" || c.GuildID != GuildID || c.PostConfig != PostFiles {
+		t.Errorf("default community = %+v", c)
+	}
+	if got := communityRef(getCommunities()[0]); got != DefaultCommunityRef {
+		t.Errorf("communityRef(default) = %q", got)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
 )
 
 var (
@@ -20,20 +24,41 @@ var (
 const (
 	CookieName    = "discord_session"
 	PostFiles     = "post_config.json"
+	DataDir       = "data"
 	LimitFile     = "refresh.log"
 	WindowSeconds = 24 * 3600
 	MaxRefreshes  = 300
 	Port          = "9966"
+	PrefsCookie   = "view_prefs"
 	GuildID       = "1159839373001498718" // 可选，特定判断公会ID
 	ChannelID     = "1325014797057785867" // 可选，特定判断频道ID （新手答疑）
+
+	DefaultMergeWindow  = 5 * time.Minute
+	DefaultTreeMaxDepth = 6
 )
 
-// fetchPostConfigurations 从外部文件获取 PostConfig 列表
+// fetchPostConfigurations 从各社区的配置文件获取 PostConfig 列表（其他社区的文件名带 "<id>/" 前缀）
 func fetchPostConfigurations() ([]PostConfig, error) {
-	fmt.Println("fetchPostConfigurations: (从外部文件", PostFiles, "获取频道配置列表)")
+	var all []PostConfig
+	for _, c := range getCommunities() {
+		posts, err := loadCommunityPosts(c)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, posts...)
+	}
+	return all, nil
+}
+
+// loadPostConfigFile 读取一个月份列表文件；builtin 为 true 时文件不存在则使用内置列表（默认社区）
+func loadPostConfigFile(path string, builtin bool) ([]PostConfig, error) {
+	slog.Debug("读取月份列表", "path", path)
 
 	var configs []PostConfig
-	fileContent, err := os.ReadFile(PostFiles)
+	fileContent, err := os.ReadFile(path)
+	if err != nil && !builtin {
+		return nil, fmt.Errorf("读取配置文件 %s 失败: %w", path, err)
+	}
 	if err != nil {
 		configs = []PostConfig{
 			// 2025年下半年
@@ -50,14 +75,156 @@ func fetchPostConfigurations() ([]PostConfig, error) {
 			{MonthStr: "2月", Title: "2025年2月", SubTitle: "百万Eric_王老板", FileName: "2025-02.json", PostID: "1336592565876559872"},
 			{MonthStr: "1月", Title: "2025年1月", SubTitle: "百万Eric_王老板", FileName: "2025-01.json", PostID: "1325716407458992199"},
 		}
-		fmt.Printf("✅ %s 获取默认 %d 个频道配置\n", PostFiles, len(configs))
+		slog.Info("月份列表文件不存在，使用内置列表", "path", path, "count", len(configs))
 		return configs, nil
 	}
 
 	if err := json.Unmarshal(fileContent, &configs); err != nil {
-		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", PostFiles, err)
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
 	}
 
-	fmt.Printf("✅ 成功从文件 %s 获取 %d 个频道配置\n", PostFiles, len(configs))
+	slog.Info("已读取月份列表", "path", path, "count", len(configs))
 	return configs, nil
 }
+
+// ==========================================
+// 服务端配置 (server_config.json，可选)
+// ==========================================
+
+const ServerConfigFile = "server_config.json"
+
+var (
+	serverConfigMu sync.RWMutex
+	serverConfig   ServerConfig
+)
+
+// loadServerConfig 读取可选的服务端配置文件，文件不存在时使用零值
+func loadServerConfig() error {
+	var cfg ServerConfig
+	fileContent, err := os.ReadFile(ServerConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Info("未找到服务端配置文件，使用默认配置", "path", ServerConfigFile)
+			return nil
+		}
+		return fmt.Errorf("读取配置文件 %s 失败: %w", ServerConfigFile, err)
+	}
+	if err := json.Unmarshal(fileContent, &cfg); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", ServerConfigFile, err)
+	}
+	if err := validateCommunities(cfg.Communities); err != nil {
+		return fmt.Errorf("配置文件 %s 有误: %w", ServerConfigFile, err)
+	}
+	if err := validateGuestAccounts(cfg.GuestAccounts); err != nil {
+		return fmt.Errorf("配置文件 %s 有误: %w", ServerConfigFile, err)
+	}
+	if err := validateAPIKeys(cfg.APIKeys, cfg.Communities); err != nil {
+		return fmt.Errorf("配置文件 %s 有误: %w", ServerConfigFile, err)
+	}
+	if err := validateRoles(cfg.Roles); err != nil {
+		return fmt.Errorf("配置文件 %s 有误: %w", ServerConfigFile, err)
+	}
+	if err := validateLogConfig(cfg.Log); err != nil {
+		return fmt.Errorf("配置文件 %s 有误: %w", ServerConfigFile, err)
+	}
+	// OAuth 会话不带 Token，访客不是成员，两者可查看的频道和帖子都只能用 bot_token 计算
+	if cfg.BotToken == "" && os.Getenv("DISCORD_BOT_TOKEN") == "" {
+		if cfg.OAuth.ClientID != "" {
+			return fmt.Errorf("配置文件 %s 有误: 开启 OAuth 登录需要配置 bot_token（或环境变量 DISCORD_BOT_TOKEN）", ServerConfigFile)
+		}
+		if len(cfg.GuestAccounts) > 0 {
+			return fmt.Errorf("配置文件 %s 有误: 访客账号需要配置 bot_token（或环境变量 DISCORD_BOT_TOKEN）", ServerConfigFile)
+		}
+	}
+
+	serverConfigMu.Lock()
+	serverConfig = cfg
+	serverConfigMu.Unlock()
+	slog.Info("已加载服务端配置", "path", ServerConfigFile, "api_keys", len(cfg.APIKeys))
+	return nil
+}
+
+// getServerConfig 返回当前服务端配置的副本
+func getServerConfig() ServerConfig {
+	serverConfigMu.RLock()
+	defer serverConfigMu.RUnlock()
+	return serverConfig
+}
+
+// getBotAuthorization 返回服务端 Bot Token 的 Authorization 值（环境变量 DISCORD_BOT_TOKEN 优先），未配置时为空
+func getBotAuthorization() string {
+	token := os.Getenv("DISCORD_BOT_TOKEN")
+	if token == "" {
+		token = getServerConfig().BotToken
+	}
+	return discord.BotAuthorization(token)
+}
+
+// ensurePostList 确保 dynamicPostList 已加载（首次访问时从配置文件获取）
+func ensurePostList() error {
+	dynamicPostListMu.Lock()
+	defer dynamicPostListMu.Unlock()
+	if len(dynamicPostList) > 0 {
+		return nil
+	}
+	configs, err := fetchPostConfigurations()
+	if err != nil {
+		return err
+	}
+	dynamicPostList = configs
+	return nil
+}
+
+// reloadPostList 重新读取所有社区的月份列表（管理页修改后调用）
+func reloadPostList() error {
+	configs, err := fetchPostConfigurations()
+	if err != nil {
+		return err
+	}
+	dynamicPostListMu.Lock()
+	dynamicPostList = configs
+	dynamicPostListMu.Unlock()
+	clearPermissionCache() // 缓存的可见帖子不包含新增的月份
+	return nil
+}
+
+// findPostConfig 按文件名查找帖子配置
+func findPostConfig(file string) (PostConfig, bool) {
+	for _, cfg := range getPostList() {
+		if cfg.FileName == file {
+			return cfg, true
+		}
+	}
+	return PostConfig{}, false
+}
+
+// getPostList 返回 dynamicPostList 的快照
+func getPostList() []PostConfig {
+	dynamicPostListMu.RLock()
+	defer dynamicPostListMu.RUnlock()
+	return append([]PostConfig(nil), dynamicPostList...)
+}
+
+// getMergeWindow 返回服务端配置的消息合并窗口
+func getMergeWindow() time.Duration {
+	minutes := getServerConfig().MergeWindowMinutes
+	switch {
+	case minutes < 0:
+		return 0
+	case minutes == 0:
+		return DefaultMergeWindow
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// getTreeMaxDepth 返回树形回复的最大深度，0 表示不限制
+func getTreeMaxDepth() int {
+	depth := getServerConfig().TreeMaxDepth
+	switch {
+	case depth < 0:
+		return 0
+	case depth == 0:
+		return DefaultTreeMaxDepth
+	}
+	return depth
+}
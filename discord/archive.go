@@ -0,0 +1,292 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// 存档文件 (data/*.json) 读写与合并
+// ==========================================
+
+// ParseArchive 解析存档 JSON 并按 ID 升序排序
+func ParseArchive(data []byte) ([]Message, error) {
+	var msgs []Message
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, err
+	}
+	SortMessages(msgs)
+	return msgs, nil
+}
+
+// LoadArchive 读取存档文件
+func LoadArchive(path string) ([]Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := ParseArchive(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析存档 %s 失败: %w", path, err)
+	}
+	return msgs, nil
+}
+
+// SaveArchive 按 ID 升序写出存档文件：先写入同目录临时文件再重命名，避免中断时留下半个文件
+func SaveArchive(path string, msgs []Message) error {
+	SortMessages(msgs)
+	data, err := json.MarshalIndent(msgs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后这里是空操作
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MergeMessages 把新抓取的消息合并进已有存档（与查看器刷新逻辑一致）：
+// 已存在的消息只用新数据覆盖 Attachments（刷新过期的图片 URL），新 ID 追加；返回升序结果和新增条数
+func MergeMessages(existing, fresh []Message) ([]Message, int) {
+	merged, added, _ := mergeMessages(existing, fresh, false)
+	return merged, added
+}
+
+// MergeMessagesWithEdits 与 MergeMessages 相同，但已存在的消息整条替换为新数据（只用于 sync -rescan 重新扫描编辑过的消息）
+// 额外返回内容被修改的条数
+func MergeMessagesWithEdits(existing, fresh []Message) ([]Message, int, int) {
+	return mergeMessages(existing, fresh, true)
+}
+
+func mergeMessages(existing, fresh []Message, replace bool) ([]Message, int, int) {
+	freshMap := make(map[string]Message, len(fresh))
+	for _, m := range fresh {
+		freshMap[m.ID] = m
+	}
+
+	merged := make([]Message, 0, len(existing)+len(fresh))
+	seen := make(map[string]bool, len(existing))
+	updated := 0
+	for _, old := range existing {
+		if seen[old.ID] {
+			continue
+		}
+		seen[old.ID] = true
+		if f, ok := freshMap[old.ID]; ok {
+			if replace {
+				if f.Content != old.Content || f.EditedAt != old.EditedAt {
+					updated++
+				}
+				old = f
+			} else {
+				old.Attachments = f.Attachments
+			}
+		}
+		merged = append(merged, old)
+	}
+
+	added := 0
+	for _, m := range fresh {
+		if !seen[m.ID] {
+			seen[m.ID] = true
+			merged = append(merged, m)
+			added++
+		}
+	}
+
+	SortMessages(merged)
+	return merged, added, updated
+}
+
+// SyncResult 是一次增量同步的统计
+type SyncResult struct {
+	Total   int // 同步后共多少条
+	Added   int // 新增条数
+	Updated int // 重新扫描时发现被编辑的条数
+	Full    bool
+	Resumed bool // 继续了上次中断的全量抓取
+}
+
+// 全量抓取中断时，在存档旁的 <文件名>.resume 记录已抓到的最旧消息 ID，下次同步从这里继续向过去抓取
+func resumePath(path string) string {
+	return path + ".resume"
+}
+
+func loadResumeCursor(path string) (string, error) {
+	data, err := os.ReadFile(resumePath(path))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+func saveResumeCursor(path string, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return os.WriteFile(resumePath(path), []byte(msgs[0].ID+"\n"), 0644)
+}
+
+// SyncArchive 增量同步存档文件：读取已有存档，只抓取最新一条之后的消息；
+// rescan > 0 时额外重新抓取最新消息之前 rescan 时间内的消息以获取编辑；
+// 存档不存在时抓取全部历史。合并按 ID 去重后原子写回
+func SyncArchive(client *http.Client, token, chanID, path string, rescan time.Duration) (SyncResult, error) {
+	f := &Fetcher{Client: client, Token: token}
+	return f.SyncArchive(context.Background(), chanID, path, rescan)
+}
+
+// SyncArchive 同包级 SyncArchive；抓取中途出错时仍写回已获取的部分，并返回 *PartialError。
+// 全量抓取从新到旧翻页，中断时存档里只有较新的消息，因此同时记录中断位置，下次先把更早的消息补齐再做增量。
+// 合并与查看器刷新一致，已有消息只更新 Attachments；只有 rescan 时整条替换，否则重新扫描拿不到编辑后的内容
+func (f *Fetcher) SyncArchive(ctx context.Context, chanID, path string, rescan time.Duration) (SyncResult, error) {
+	existing, err := LoadArchive(path)
+	if err != nil && !os.IsNotExist(err) {
+		return SyncResult{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return SyncResult{}, err
+	}
+
+	resume, err := loadResumeCursor(path)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	if resume != "" && len(existing) > 0 {
+		older, fetchErr := f.FetchMessagesBefore(ctx, chanID, resume)
+		var partial *PartialError
+		if fetchErr != nil && !errors.As(fetchErr, &partial) {
+			return SyncResult{}, fetchErr
+		}
+		merged, added := MergeMessages(existing, older)
+		if err := SaveArchive(path, merged); err != nil {
+			return SyncResult{}, err
+		}
+		if fetchErr != nil {
+			// 仍未到达频道起点，记录新的中断位置，这次不做增量
+			if err := saveResumeCursor(path, merged); err != nil {
+				return SyncResult{}, err
+			}
+			return SyncResult{Total: len(merged), Added: added, Full: true, Resumed: true}, fetchErr
+		}
+		if err := os.Remove(resumePath(path)); err != nil {
+			return SyncResult{}, err
+		}
+		result, err := f.syncNewer(ctx, chanID, path, merged, rescan)
+		result.Added += added
+		result.Resumed = true
+		return result, err
+	}
+	return f.syncNewer(ctx, chanID, path, existing, rescan)
+}
+
+// syncNewer 抓取 existing 最新一条之后的消息（existing 为空时抓取全部历史）并写回
+func (f *Fetcher) syncNewer(ctx context.Context, chanID, path string, existing []Message, rescan time.Duration) (SyncResult, error) {
+	sinceID := ""
+	if len(existing) > 0 {
+		sinceID = existing[len(existing)-1].ID
+		if rescan > 0 {
+			if newest, ok := SnowflakeTime(sinceID); ok {
+				sinceID = SnowflakeFromTime(newest.Add(-rescan))
+			}
+		}
+	}
+
+	fresh, fetchErr := f.FetchMessages(ctx, chanID, sinceID)
+	var partial *PartialError
+	if fetchErr != nil && !errors.As(fetchErr, &partial) {
+		return SyncResult{}, fetchErr
+	}
+
+	var merged []Message
+	var added, updated int
+	if rescan > 0 {
+		merged, added, updated = MergeMessagesWithEdits(existing, fresh)
+	} else {
+		merged, added = MergeMessages(existing, fresh)
+	}
+	if err := SaveArchive(path, merged); err != nil {
+		return SyncResult{}, err
+	}
+	if sinceID == "" {
+		// 全量抓取中断时记录位置；完整抓取后清掉存档被删除前留下的旧记录
+		var err error
+		if fetchErr != nil {
+			err = saveResumeCursor(path, merged)
+		} else if err = os.Remove(resumePath(path)); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			return SyncResult{}, err
+		}
+	}
+	return SyncResult{Total: len(merged), Added: added, Updated: updated, Full: sinceID == ""}, fetchErr
+}
+
+// Discord snowflake 的纪元 (2015-01-01T00:00:00Z)，单位毫秒
+const discordEpochMs = 1420070400000
+
+// SnowflakeTime 从 snowflake ID 中解析创建时间
+func SnowflakeTime(id string) (time.Time, bool) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(n>>22) + discordEpochMs).UTC(), true
+}
+
+// SnowflakeFromTime 构造该时间点对应的最小 snowflake，可用作 after/before 分页参数
+func SnowflakeFromTime(t time.Time) string {
+	ms := t.UnixMilli() - discordEpochMs
+	if ms < 0 {
+		ms = 0
+	}
+	return strconv.FormatUint(uint64(ms)<<22, 10)
+}
+
+// VerifyArchive 检查存档能否被查看器正确加载，返回发现的问题（为空表示通过）
+func VerifyArchive(msgs []Message) []string {
+	var problems []string
+	ids := make(map[string]bool, len(msgs))
+	for i, m := range msgs {
+		if m.ID == "" {
+			problems = append(problems, fmt.Sprintf("第 %d 条消息缺少 id", i))
+			continue
+		}
+		if ids[m.ID] {
+			problems = append(problems, fmt.Sprintf("消息 %s 重复", m.ID))
+		}
+		ids[m.ID] = true
+		if _, err := time.Parse(time.RFC3339, m.Timestamp); err != nil {
+			problems = append(problems, fmt.Sprintf("消息 %s 时间格式无效: %q", m.ID, m.Timestamp))
+		}
+		if m.Author.ID == "" {
+			problems = append(problems, fmt.Sprintf("消息 %s 缺少作者 ID", m.ID))
+		}
+	}
+	return problems
+}
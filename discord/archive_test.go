@@ -0,0 +1,95 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func seedIDs(from, to int) []Message {
+	var msgs []Message
+	for i := from; i <= to; i++ {
+		msgs = append(msgs, Message{ID: strconv.Itoa(1000000 + i), Content: "m"})
+	}
+	return msgs
+}
+
+// 全量抓取中断后，下次同步先从中断处继续向过去补齐，再抓取新消息
+func TestSyncArchiveResumesInterruptedFullFetch(t *testing.T) {
+	s := NewFakeServer("100")
+	s.AddUser(FakeUser{Token: "t", ID: "1", Username: "alice"})
+	s.SeedMessages("111", seedIDs(1, 250))
+	var failBefore atomic.Bool
+	failBefore.Store(true)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failBefore.Load() && r.URL.Query().Get("before") != "" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	SetAPIBase(s.APIBase(ts.URL))
+	defer SetAPIBase("")
+
+	path := filepath.Join(t.TempDir(), "a.json")
+	f := &Fetcher{Client: NewHTTPClient(""), Token: "t", Limiter: NewRateLimiter(0)}
+	res, err := f.SyncArchive(context.Background(), "111", path, 0)
+	var partial *PartialError
+	if !errors.As(err, &partial) || !res.Full || res.Total != 100 {
+		t.Fatalf("first sync = %+v, %v", res, err)
+	}
+	if cursor, _ := os.ReadFile(resumePath(path)); strings.TrimSpace(string(cursor)) != "1000151" {
+		t.Fatalf("resume cursor = %q", cursor)
+	}
+
+	failBefore.Store(false)
+	s.SeedMessages("111", seedIDs(251, 252))
+	res, err = f.SyncArchive(context.Background(), "111", path, 0)
+	if err != nil || !res.Resumed || res.Total != 252 || res.Added != 152 {
+		t.Fatalf("second sync = %+v, %v", res, err)
+	}
+	msgs, err := LoadArchive(path)
+	if err != nil || len(msgs) != 252 || msgs[0].ID != "1000001" || msgs[251].ID != "1000252" {
+		t.Errorf("archive = %d messages, %v", len(msgs), err)
+	}
+	if _, err := os.Stat(resumePath(path)); !os.IsNotExist(err) {
+		t.Errorf("resume cursor left behind: %v", err)
+	}
+}
+
+// 不带 rescan 时与查看器刷新一致，已有消息只更新附件；rescan 时整条替换以获取编辑
+func TestSyncArchiveMergeSemantics(t *testing.T) {
+	s := NewFakeServer("100")
+	s.AddUser(FakeUser{Token: "t", ID: "1", Username: "alice"})
+	startFakeServer(t, s)
+	path := filepath.Join(t.TempDir(), "a.json")
+	old := []Message{{ID: "1000001", Content: "old", Attachments: []Attachment{{URL: "expired"}}}}
+	if err := SaveArchive(path, old); err != nil {
+		t.Fatal(err)
+	}
+	s.SeedMessages("111", []Message{{ID: "1000001", Content: "edited", EditedAt: "2025-01-01T00:00:00Z", Attachments: []Attachment{{URL: "fresh"}}}})
+
+	got, _ := MergeMessages(old, []Message{{ID: "1000001", Content: "edited", Attachments: []Attachment{{URL: "fresh"}}}})
+	if got[0].Content != "old" || got[0].Attachments[0].URL != "fresh" {
+		t.Errorf("MergeMessages = %+v", got[0])
+	}
+
+	f := &Fetcher{Client: NewHTTPClient(""), Token: "t", Limiter: NewRateLimiter(0)}
+	res, err := f.SyncArchive(context.Background(), "111", path, 24*time.Hour)
+	if err != nil || res.Updated != 1 {
+		t.Fatalf("rescan = %+v, %v", res, err)
+	}
+	msgs, _ := LoadArchive(path)
+	if len(msgs) != 1 || msgs[0].Content != "edited" {
+		t.Errorf("archive after rescan = %+v", msgs)
+	}
+}
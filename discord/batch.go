@@ -0,0 +1,153 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 批量同步 (post_config.json 中的所有月份)
+// ==========================================
+
+// PostConfig 是 post_config.json 中的一项：一个月份对应一个帖子(频道)和一个存档文件
+type PostConfig struct {
+	MonthStr string `json:"month_str"`
+	Title    string `json:"title"`
+	SubTitle string `json:"sub_title"`
+	FileName string `json:"file_name"`
+	PostID   string `json:"post_id"`
+}
+
+// LoadPostConfigs 读取 post_config.json
+func LoadPostConfigs(path string) ([]PostConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var posts []PostConfig
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return posts, nil
+}
+
+// PostsFromChannelIDs 把频道 ID 列表转换为 PostConfig，存档文件名为 <ID>.json
+func PostsFromChannelIDs(ids []string) []PostConfig {
+	var posts []PostConfig
+	for _, id := range ids {
+		if id != "" {
+			posts = append(posts, PostConfig{Title: id, FileName: id + ".json", PostID: id})
+		}
+	}
+	return posts
+}
+
+// BatchOptions 控制批量同步
+type BatchOptions struct {
+	DataDir  string        // 存档目录，文件写入 DataDir/<FileName>
+	Workers  int           // 并发数，<=0 时为 1
+	Rescan   time.Duration // 同 SyncArchive 的 rescan
+	Progress func(post PostConfig, p FetchProgress)
+}
+
+// BatchStatus 是单个帖子的同步结果分类
+type BatchStatus string
+
+const (
+	BatchSuccess BatchStatus = "success"
+	BatchPartial BatchStatus = "partial"
+	BatchFailed  BatchStatus = "failed"
+)
+
+// BatchResult 是单个帖子的同步结果
+type BatchResult struct {
+	Post     PostConfig
+	Status   BatchStatus
+	Result   SyncResult
+	Err      error
+	Duration time.Duration
+}
+
+// SyncPosts 用有限并发的 worker 池同步所有帖子，所有 worker 共享 base 的客户端、token 和限速器；
+// 返回结果顺序与 posts 相同
+func SyncPosts(ctx context.Context, base *Fetcher, posts []PostConfig, opts BatchOptions) []BatchResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(posts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				post := posts[i]
+				f := *base
+				if opts.Progress != nil {
+					f.Progress = func(p FetchProgress) { opts.Progress(post, p) }
+				}
+
+				start := time.Now()
+				res, err := f.SyncArchive(ctx, post.PostID, filepath.Join(opts.DataDir, post.FileName), opts.Rescan)
+				status := BatchSuccess
+				var partial *PartialError
+				switch {
+				case errors.As(err, &partial):
+					status = BatchPartial
+				case err != nil:
+					status = BatchFailed
+				}
+				results[i] = BatchResult{Post: post, Status: status, Result: res, Err: err, Duration: time.Since(start)}
+			}
+		}()
+	}
+	for i := range posts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// BatchSummary 是一次批量同步的汇总
+type BatchSummary struct {
+	Success, Partial, Failed int
+	Added, Updated           int // 所有帖子（含部分成功）新增 / 编辑的条数
+}
+
+// Total 返回帖子总数
+func (s BatchSummary) Total() int {
+	return s.Success + s.Partial + s.Failed
+}
+
+// OK 是否所有帖子都完整同步
+func (s BatchSummary) OK() bool {
+	return s.Partial == 0 && s.Failed == 0
+}
+
+// SummarizeBatch 统计成功 / 部分成功 / 失败的帖子数和新增条数，输出格式由调用方决定
+func SummarizeBatch(results []BatchResult) BatchSummary {
+	var s BatchSummary
+	for _, r := range results {
+		switch r.Status {
+		case BatchSuccess:
+			s.Success++
+		case BatchPartial:
+			s.Partial++
+		default:
+			s.Failed++
+		}
+		s.Added += r.Result.Added
+		s.Updated += r.Result.Updated
+	}
+	return s
+}
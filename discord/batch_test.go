@@ -0,0 +1,75 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummarizeBatch(t *testing.T) {
+	results := []BatchResult{
+		{Status: BatchSuccess, Result: SyncResult{Added: 3, Updated: 1}},
+		{Status: BatchSuccess},
+		{Status: BatchPartial, Result: SyncResult{Added: 2}, Err: &PartialError{Err: errors.New("boom")}},
+		{Status: BatchFailed, Err: errors.New("403")},
+	}
+	got := SummarizeBatch(results)
+	want := BatchSummary{Success: 2, Partial: 1, Failed: 1, Added: 5, Updated: 1}
+	if got != want {
+		t.Errorf("SummarizeBatch = %+v, want %+v", got, want)
+	}
+	if got.Total() != 4 || got.OK() {
+		t.Errorf("Total = %d, OK = %v", got.Total(), got.OK())
+	}
+	if s := SummarizeBatch(results[:2]); !s.OK() {
+		t.Errorf("all success not OK: %+v", s)
+	}
+}
+
+func TestSyncPostsAgainstFakeServer(t *testing.T) {
+	s := NewFakeServer("100")
+	s.AddUser(FakeUser{Token: "t", ID: "1", Username: "alice"})
+	s.SeedMessages("111", []Message{{ID: "1000001"}, {ID: "1000002"}})
+	startFakeServer(t, s)
+
+	dir := t.TempDir()
+	posts := []PostConfig{{FileName: "a.json", PostID: "111"}, {FileName: "b.json", PostID: "999"}}
+	base := &Fetcher{Client: NewHTTPClient(""), Token: "t", Limiter: NewRateLimiter(time.Millisecond)}
+	results := SyncPosts(context.Background(), base, posts, BatchOptions{DataDir: dir, Workers: 2})
+
+	if results[0].Status != BatchSuccess || results[0].Result.Added != 2 {
+		t.Errorf("a.json = %+v", results[0])
+	}
+	if results[1].Status != BatchFailed {
+		t.Errorf("unknown channel = %+v, want failed", results[1])
+	}
+	if got := SummarizeBatch(results); got.Success != 1 || got.Failed != 1 || got.Added != 2 {
+		t.Errorf("summary = %+v", got)
+	}
+	if msgs, err := LoadArchive(filepath.Join(dir, "a.json")); err != nil || len(msgs) != 2 {
+		t.Errorf("archive = %d messages, %v", len(msgs), err)
+	}
+}
+
+func TestCompareIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "1", 0},
+		{"2", "10", -1},
+		{"99999999999999999", "100000000000000000", -1},
+		{"1445638241280856124", "1445638241280856123", 1},
+		{"", "1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareIDs(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareIDs(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
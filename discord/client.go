@@ -0,0 +1,359 @@
+package discord
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// Discord API 客户端
+// ==========================================
+
+const (
+	DefaultAPIBase = "https://discord.com/api/v9"
+	UserAgent      = "DiscordArchiveViewer (CustomApp, 1.0)"
+	botPrefix      = "Bot "
+
+	maxRateLimitRetries = 5
+)
+
+// APIBase 是所有 REST 请求的前缀，可通过 SetAPIBase 指向本地假服务器（见 FakeServer）
+var APIBase = DefaultAPIBase
+
+// SetAPIBase 修改 API 前缀，传入空字符串时恢复默认值；需在发出任何请求前调用
+func SetAPIBase(base string) {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	if base == "" {
+		base = DefaultAPIBase
+	}
+	APIBase = base
+}
+
+// StatusError 表示 Discord 返回了非 200 状态码
+type StatusError struct {
+	StatusCode int
+	URL        string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-200 status code %d from %s: %s", e.StatusCode, e.URL, e.Body)
+}
+
+// NewHTTPClient 创建 HTTP 客户端，proxyURL 为空时直连；开启录制 / 回放时会包装 Transport（见 fixture.go）
+func NewHTTPClient(proxyURL string) *http.Client {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(u)}
+		}
+	}
+	wrapFixtureTransport(client)
+	return client
+}
+
+// BotAuthorization 把 Bot Token 转换为 Authorization 头的值，已带 "Bot " 前缀时原样返回
+func BotAuthorization(token string) string {
+	token = strings.TrimSpace(token)
+	if token == "" || IsBotAuthorization(token) {
+		return token
+	}
+	return botPrefix + token
+}
+
+// IsBotAuthorization 判断 Authorization 值是否为 Bot Token
+func IsBotAuthorization(auth string) bool {
+	return strings.HasPrefix(auth, botPrefix)
+}
+
+// Fetcher 封装一次抓取所需的客户端与 token；多个 Fetcher 可共享同一个 Limiter 统一限速
+type Fetcher struct {
+	Client   *http.Client
+	Token    string              // Authorization 头的完整值：用户 Token 原样传入，Bot Token 需经 BotAuthorization 转换
+	Limiter  *RateLimiter        // 可选，为 nil 时每页之间固定等待 200ms
+	Progress func(FetchProgress) // 可选，每抓取一页回调一次
+	Logger   *slog.Logger        // 可选，为 nil 时使用 slog.Default()
+}
+
+func (f *Fetcher) logger() *slog.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+	return slog.Default()
+}
+
+// FetchProgress 是抓取过程中的进度
+type FetchProgress struct {
+	Pages    int    `json:"pages"`     // 已抓取页数
+	Messages int    `json:"messages"`  // 已收集的消息数（去重后）
+	CursorID string `json:"cursor_id"` // 当前分页游标（全量时为最旧 ID，增量时为最新 ID）
+}
+
+// PartialError 表示抓取中途出错，返回的消息只是已收集的部分
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("抓取中断，仅获取部分消息: %v", e.Err)
+}
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// FetchBatch 执行单个 Discord API 请求来获取消息批次，遇到 429 时按 retry_after 等待后重试
+func FetchBatch(client *http.Client, token, chanID, query string) ([]Message, error) {
+	f := &Fetcher{Client: client, Token: token}
+	return f.FetchBatch(context.Background(), chanID, query)
+}
+
+// FetchBatch 执行单个 Discord API 请求来获取消息批次，遇到 429 时按 retry_after 等待后重试；ctx 取消时立即返回
+func (f *Fetcher) FetchBatch(ctx context.Context, chanID, query string) ([]Message, error) {
+	discordUrl := fmt.Sprintf("%s/channels/%s/messages?%s", APIBase, chanID, query)
+	for attempt := 0; ; attempt++ {
+		if f.Limiter != nil {
+			if err := f.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", discordUrl, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request for %s: %w", discordUrl, err)
+		}
+
+		req.Header.Set("Authorization", f.Token)
+		req.Header.Set("User-Agent", UserAgent)
+
+		resp, err := f.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request to %s: %w", discordUrl, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			wait := retryAfter(resp)
+			resp.Body.Close()
+			f.logger().Warn("Discord 限流，稍后重试", "wait", wait, "channel", chanID, "attempt", attempt+1)
+			if f.Limiter != nil {
+				f.Limiter.Pause(wait) // 共享限速器上的其他抓取任务一起等待
+			} else if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body) // 读取响应体以获取更多错误信息
+			resp.Body.Close()
+			return nil, &StatusError{StatusCode: resp.StatusCode, URL: discordUrl, Body: string(bodyBytes)}
+		}
+
+		var msgs []Message
+		err = json.NewDecoder(resp.Body).Decode(&msgs)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode messages from %s: %w", discordUrl, err)
+		}
+		return msgs, nil
+	}
+}
+
+// 解析 429 响应中的 retry_after（秒），解析失败时默认等待 5 秒
+func retryAfter(resp *http.Response) time.Duration {
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.RetryAfter > 0 {
+		return time.Duration(body.RetryAfter * float64(time.Second))
+	}
+	return 5 * time.Second
+}
+
+// FetchMessages 抓取频道消息：sinceID 为空时从最新向过去抓取全部历史，否则抓取 sinceID 之后的消息
+// 返回按 ID 升序（从旧到新）排序的消息；中途出错时记录日志并返回已收集的部分
+func FetchMessages(client *http.Client, token, chanID, sinceID string) ([]Message, error) {
+	f := &Fetcher{Client: client, Token: token}
+	msgs, err := f.FetchMessages(context.Background(), chanID, sinceID)
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		slog.Warn("抓取中断，使用已收集的消息", "channel", chanID, "count", len(msgs), "err", err)
+		return msgs, nil
+	}
+	return msgs, err
+}
+
+// FetchMessages 与包级 FetchMessages 相同，但中途出错时返回已收集的消息和 *PartialError；
+// ctx 被取消时返回已收集的消息和包装了 ctx.Err() 的 *PartialError
+func (f *Fetcher) FetchMessages(ctx context.Context, chanID, sinceID string) ([]Message, error) {
+	return f.fetchMessages(ctx, chanID, sinceID, "")
+}
+
+// FetchMessagesBefore 从 beforeID（不含）开始向过去抓取到频道起点，用于继续中断的全量抓取；
+// 出错时的返回值与 FetchMessages 相同
+func (f *Fetcher) FetchMessagesBefore(ctx context.Context, chanID, beforeID string) ([]Message, error) {
+	return f.fetchMessages(ctx, chanID, "", beforeID)
+}
+
+// sinceID 为空时向过去抓取（beforeID 为空则从最新消息开始），否则抓取 sinceID 之后的消息
+func (f *Fetcher) fetchMessages(ctx context.Context, chanID, sinceID, beforeID string) ([]Message, error) {
+	messageMap := make(map[string]Message) // 用于去重
+	pages := 0
+	var partialErr error
+
+	// 收集一页消息并汇报进度
+	collect := func(batch []Message, cursor string) {
+		for _, msg := range batch {
+			messageMap[msg.ID] = msg
+		}
+		pages++
+		if f.Progress != nil {
+			f.Progress(FetchProgress{Pages: pages, Messages: len(messageMap), CursorID: cursor})
+		}
+	}
+	// 每页之间的等待：有共享限速器时由限速器控制
+	pause := func() error {
+		if f.Limiter == nil {
+			return sleepContext(ctx, 200*time.Millisecond) // 尊重 Discord API 速率限制
+		}
+		return ctx.Err()
+	}
+
+	if sinceID == "" {
+		// 情况1: 抓取所有消息 (从最新的开始，逐步向过去抓取)
+		// 首先抓取第一批最新消息（继续中断的抓取时为 beforeID 之前的一批）
+		query := "limit=100"
+		if beforeID != "" {
+			query += "&before=" + beforeID
+		}
+		initialBatch, err := f.FetchBatch(ctx, chanID, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch initial batch of messages: %w", err)
+		}
+		if len(initialBatch) == 0 {
+			return []Message{}, nil // 频道中没有消息
+		}
+
+		// 循环向过去抓取 (使用 'before' 参数)
+		currentOldestID, _ := findMinMaxID(initialBatch)
+		collect(initialBatch, currentOldestID)
+		for {
+			query = "limit=100&before=" + currentOldestID
+			batch, err := f.FetchBatch(ctx, chanID, query)
+			if err != nil {
+				partialErr = fmt.Errorf("error fetching messages before %s: %w", currentOldestID, err)
+				break // 遇到错误，停止并返回已收集的消息
+			}
+			if len(batch) == 0 {
+				break // 没有更旧的消息了
+			}
+
+			newOldestID, _ := findMinMaxID(batch)
+			collect(batch, newOldestID)
+
+			// 如果最旧的消息ID没有变化，说明已经到达频道的起点
+			if newOldestID == currentOldestID {
+				break
+			}
+			currentOldestID = newOldestID
+			if err := pause(); err != nil {
+				partialErr = err
+				break
+			}
+		}
+
+	} else {
+		// 情况2: 抓取比 sinceID 更新的消息 (增量更新)
+		// 从 sinceID 之后开始抓取 (使用 'after' 参数)
+		currentNewestID := sinceID
+		for {
+			query := "limit=100&after=" + currentNewestID
+			batch, err := f.FetchBatch(ctx, chanID, query)
+			if err != nil {
+				partialErr = fmt.Errorf("error fetching messages after %s: %w", currentNewestID, err)
+				break // 遇到错误，停止并返回已收集的消息
+			}
+			if len(batch) == 0 {
+				break // 没有更新的消息了
+			}
+
+			_, newestIDinBatch := findMinMaxID(batch)
+			collect(batch, newestIDinBatch)
+
+			// 如果最新消息ID没有变化，说明已经抓取到最新的消息
+			if newestIDinBatch == currentNewestID {
+				break
+			}
+			currentNewestID = newestIDinBatch
+			if err := pause(); err != nil {
+				partialErr = err
+				break
+			}
+		}
+	}
+
+	// 将 map 中的消息转换为切片
+	result := make([]Message, 0, len(messageMap))
+	for _, msg := range messageMap {
+		result = append(result, msg)
+	}
+
+	// 按 ID 升序排序 (从旧到新)
+	SortMessages(result)
+	if partialErr != nil {
+		return result, &PartialError{Err: partialErr}
+	}
+	return result, nil
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// 在一个消息批次中找到最小和最大的 ID
+func findMinMaxID(msgs []Message) (string, string) {
+	if len(msgs) == 0 {
+		return "", ""
+	}
+	minID := msgs[0].ID
+	maxID := msgs[0].ID
+	for _, msg := range msgs {
+		if CompareIDs(msg.ID, minID) < 0 { // Discord snowflake ID 是时间有序的
+			minID = msg.ID
+		}
+		if CompareIDs(msg.ID, maxID) > 0 {
+			maxID = msg.ID
+		}
+	}
+	return minID, maxID
+}
+
+// SortMessages 按 ID 升序排序 (从旧到新)
+func SortMessages(msgs []Message) {
+	sort.Slice(msgs, func(i, j int) bool { return CompareIDs(msgs[i].ID, msgs[j].ID) < 0 })
+}
+
+// CompareIDs 按数值比较两个 snowflake ID（不同长度的 ID 不能直接按字符串比较），返回 -1 / 0 / 1
+func CompareIDs(a, b string) int {
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+	return strings.Compare(a, b)
+}
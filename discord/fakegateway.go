@@ -0,0 +1,129 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// 本地假 Gateway，用于离线测试实时模式
+// ==========================================
+
+// FakeGateway 是一个最小的 Discord Gateway 实现：发送 HELLO、回应 IDENTIFY / RESUME / 心跳，
+// 并把 Dispatch 的事件推送给所有已连接的客户端。可直接挂到 httptest.Server 上
+type FakeGateway struct {
+	HeartbeatInterval int // 毫秒，0 时为 45000
+
+	mu         sync.Mutex
+	conns      map[*websocket.Conn]*sync.Mutex
+	identifies []string // 收到的 IDENTIFY / RESUME token，测试可用来检查是否重连
+	seq        atomic.Int64
+	upgrader   websocket.Upgrader
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{conns: make(map[*websocket.Conn]*sync.Mutex)}
+}
+
+// URL 把 httptest 服务的 http:// 地址转换为 Gateway 可连接的 ws:// 地址
+func (fg *FakeGateway) URL(serverURL string) string {
+	return "ws" + strings.TrimPrefix(serverURL, "http") + "/?v=9&encoding=json"
+}
+
+func (fg *FakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := fg.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	writeMu := &sync.Mutex{}
+	write := func(p gatewayPayload) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(p)
+	}
+
+	interval := fg.HeartbeatInterval
+	if interval <= 0 {
+		interval = 45000
+	}
+	hello, _ := json.Marshal(map[string]int{"heartbeat_interval": interval})
+	if err := write(gatewayPayload{Op: opHello, D: hello}); err != nil {
+		return
+	}
+
+	for {
+		var p gatewayPayload
+		if err := conn.ReadJSON(&p); err != nil {
+			fg.mu.Lock()
+			delete(fg.conns, conn)
+			fg.mu.Unlock()
+			return
+		}
+		switch p.Op {
+		case opHeartbeat:
+			write(gatewayPayload{Op: opHeartbeatACK})
+		case opIdentify, opResume:
+			var auth struct {
+				Token string `json:"token"`
+			}
+			json.Unmarshal(p.D, &auth)
+			fg.mu.Lock()
+			fg.identifies = append(fg.identifies, auth.Token)
+			fg.conns[conn] = writeMu
+			fg.mu.Unlock()
+
+			if p.Op == opIdentify {
+				ready, _ := json.Marshal(map[string]string{"session_id": "fake-session"})
+				fg.dispatch(conn, writeMu, "READY", ready)
+			} else {
+				fg.dispatch(conn, writeMu, "RESUMED", json.RawMessage("{}"))
+			}
+		}
+	}
+}
+
+// Dispatch 向所有已完成 IDENTIFY 的连接推送一个事件，data 会被序列化为 JSON
+func (fg *FakeGateway) Dispatch(eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	for conn, writeMu := range fg.conns {
+		fg.dispatch(conn, writeMu, eventType, raw)
+	}
+	return nil
+}
+
+// Reconnect 要求所有客户端重连（op 7）
+func (fg *FakeGateway) Reconnect() {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	for conn, writeMu := range fg.conns {
+		writeMu.Lock()
+		conn.WriteJSON(gatewayPayload{Op: opReconnect})
+		writeMu.Unlock()
+	}
+}
+
+// Identifies 返回收到的 IDENTIFY / RESUME 中的 token 列表
+func (fg *FakeGateway) Identifies() []string {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	return append([]string(nil), fg.identifies...)
+}
+
+func (fg *FakeGateway) dispatch(conn *websocket.Conn, writeMu *sync.Mutex, eventType string, raw json.RawMessage) {
+	s := fg.seq.Add(1)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	conn.WriteJSON(gatewayPayload{Op: opDispatch, T: eventType, S: &s, D: raw})
+}
@@ -0,0 +1,109 @@
+package discord
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ==========================================
+// 假服务器上的 OAuth2 授权码流程
+// ==========================================
+
+// handleAuthorize 模拟 Discord 授权页：不显示确认页面，直接带着授权码跳回 redirect_uri。
+// 通过 ?user=<用户 ID> 选择登录的用户，默认为第一个非 Bot 用户
+func (s *FakeServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" {
+		fakeError(w, http.StatusBadRequest, "unsupported response_type")
+		return
+	}
+	if s.OAuthClientID != "" && q.Get("client_id") != s.OAuthClientID {
+		fakeError(w, http.StatusBadRequest, "Invalid client_id")
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		fakeError(w, http.StatusBadRequest, "Invalid redirect_uri")
+		return
+	}
+
+	s.mu.Lock()
+	idx := slices.IndexFunc(s.users, func(u FakeUser) bool {
+		if id := q.Get("user"); id != "" {
+			return u.ID == id
+		}
+		return !IsBotAuthorization(u.Token)
+	})
+	var code string
+	if idx >= 0 {
+		s.oauthSeq++
+		code = fmt.Sprintf("fake-code-%d", s.oauthSeq)
+		s.oauthCodes[code] = s.users[idx].ID
+	}
+	s.mu.Unlock()
+
+	params := redirect.Query()
+	if idx < 0 {
+		params.Set("error", "access_denied")
+	} else {
+		params.Set("code", code)
+	}
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleToken 用授权码换取访问令牌，授权码只能使用一次
+func (s *FakeServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		fakeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		fakeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if s.OAuthClientID != "" && (clientID != s.OAuthClientID || secret != s.OAuthClientSecret) {
+		fakeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	userID, ok := s.oauthCodes[code]
+	delete(s.oauthCodes, code)
+	var access string
+	if ok {
+		s.oauthSeq++
+		access = fmt.Sprintf("fake-access-%d", s.oauthSeq)
+		s.oauthTokens["Bearer "+access] = userID
+	}
+	s.mu.Unlock()
+	if !ok {
+		fakeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	fakeJSON(w, http.StatusOK, OAuthToken{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    604800,
+		RefreshToken: strings.Replace(access, "access", "refresh", 1),
+		Scope:        OAuthScopes,
+	})
+}
+
+// handleMyMember 对应 /users/@me/guilds/{guild}/member（guilds.members.read）
+func (s *FakeServer) handleMyMember(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if r.PathValue("guild") != s.GuildID || u.Guest {
+		fakeError(w, http.StatusNotFound, "Unknown Guild")
+		return
+	}
+	fakeJSON(w, http.StatusOK, memberJSON(u))
+}
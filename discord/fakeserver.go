@@ -0,0 +1,375 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ==========================================
+// 本地假 Discord 服务器，用于离线测试
+// ==========================================
+
+const fakeAPIPrefix = "/api/v9"
+
+// FakeUser 是假服务器中的用户，请求时以 Token 作为 Authorization
+type FakeUser struct {
+	Token    string
+	ID       string
+	Username string
+	Avatar   string
+	Roles    []string // 在公会中拥有的角色 ID（@everyone 不必列出）
+	Guest    bool     // 不是公会成员，只能登录，查询成员信息时返回 404
+}
+
+// FakeServer 模拟查看器用到的 Discord REST 接口：users/@me、guilds、members、roles、channels 和
+// 带 before / after / around 分页的 messages，并可按频率返回 429；/gateway 上挂载 FakeGateway。
+// REST 前缀为 <服务地址>/api/v9，可直接作为 SetAPIBase 的参数；OAuth2 授权 / 换取令牌见 fakeoauth.go
+type FakeServer struct {
+	GuildID        string
+	GuildName      string
+	OwnerID        string
+	RateLimitEvery int     // 每 N 次 messages 请求返回一次 429，0 为不限速
+	RetryAfter     float64 // 429 响应中的 retry_after（秒），0 时为 0.05
+	Gateway        *FakeGateway
+
+	// OAuth2 应用凭据，为空时不校验（见 fakeoauth.go）
+	OAuthClientID     string
+	OAuthClientSecret string
+
+	mu       sync.Mutex
+	users    []FakeUser
+	roles    []Role
+	channels []Channel
+	messages map[string][]Message // channelID -> 按 ID 升序
+	members  map[string][]string  // 子区 ID -> 子区成员的用户 ID
+	requests int                  // 已收到的 messages 请求数
+	mux      *http.ServeMux
+
+	oauthCodes  map[string]string // 授权码 -> 用户 ID
+	oauthTokens map[string]string // "Bearer <access_token>" -> 用户 ID
+	oauthSeq    int
+}
+
+// NewFakeServer 创建只有一个公会的假服务器，自带 @everyone 角色（可查看频道和历史消息）
+func NewFakeServer(guildID string) *FakeServer {
+	s := &FakeServer{
+		GuildID:   guildID,
+		GuildName: "Fake Guild",
+		Gateway:   NewFakeGateway(),
+		roles:     []Role{{ID: guildID, Name: "@everyone", Permissions: strconv.Itoa(PermViewChannel | PermReadMessageHistory)}},
+		messages:  make(map[string][]Message),
+		members:   make(map[string][]string),
+		mux:       http.NewServeMux(),
+
+		oauthCodes:  make(map[string]string),
+		oauthTokens: make(map[string]string),
+	}
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/users/@me", s.auth(s.handleMe))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/users/@me/guilds", s.auth(s.handleMyGuilds))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/guilds/{guild}", s.auth(s.handleGuild))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/guilds/{guild}/roles", s.auth(s.handleRoles))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/guilds/{guild}/channels", s.auth(s.handleGuildChannels))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/guilds/{guild}/members/{user}", s.auth(s.handleMember))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/channels/{channel}", s.auth(s.handleChannel))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/channels/{channel}/messages", s.auth(s.handleMessages))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/channels/{channel}/thread-members/{user}", s.auth(s.handleThreadMember))
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/users/@me/guilds/{guild}/member", s.auth(s.handleMyMember))
+	s.mux.HandleFunc("GET /oauth2/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("GET "+fakeAPIPrefix+"/oauth2/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("POST "+fakeAPIPrefix+"/oauth2/token", s.handleToken)
+	s.mux.Handle("/gateway", s.Gateway)
+	return s
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// APIBase 返回该服务器的 REST 前缀，serverURL 为 httptest.Server.URL 或监听地址
+func (s *FakeServer) APIBase(serverURL string) string {
+	return strings.TrimRight(serverURL, "/") + fakeAPIPrefix
+}
+
+// GatewayURL 返回该服务器上假 Gateway 的 ws:// 地址
+func (s *FakeServer) GatewayURL(serverURL string) string {
+	return "ws" + strings.TrimPrefix(strings.TrimRight(serverURL, "/"), "http") + "/gateway?v=9&encoding=json"
+}
+
+func (s *FakeServer) AddUser(u FakeUser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, u)
+}
+
+func (s *FakeServer) AddRole(r Role) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles = append(s.roles, r)
+}
+
+// AddChannel 添加频道，GuildID 为空时使用服务器的公会
+func (s *FakeServer) AddChannel(ch Channel) {
+	if ch.GuildID == "" {
+		ch.GuildID = s.GuildID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels = append(s.channels, ch)
+}
+
+// AddThreadMember 把用户加入子区（私密子区只有成员可见）
+func (s *FakeServer) AddThreadMember(threadID, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.members[threadID] = append(s.members[threadID], userID)
+}
+
+// SeedMessages 向频道追加消息（按 ID 去重），频道不存在时自动创建一个文字频道
+func (s *FakeServer) SeedMessages(channelID string, msgs []Message) {
+	s.mu.Lock()
+	if !slices.ContainsFunc(s.channels, func(ch Channel) bool { return ch.ID == channelID }) {
+		s.channels = append(s.channels, Channel{ID: channelID, Name: channelID, GuildID: s.GuildID})
+	}
+	merged, _ := MergeMessages(s.messages[channelID], msgs)
+	slices.SortFunc(merged, func(a, b Message) int { return CompareIDs(a.ID, b.ID) }) // 分页用二分查找，需按数值排序
+	s.messages[channelID] = merged
+	s.mu.Unlock()
+}
+
+// SeedArchive 把存档文件中的消息加入频道
+func (s *FakeServer) SeedArchive(channelID, path string) error {
+	msgs, err := LoadArchive(path)
+	if err != nil {
+		return err
+	}
+	s.SeedMessages(channelID, msgs)
+	return nil
+}
+
+// Requests 返回已收到的 messages 请求数（含 429）
+func (s *FakeServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ---------------- handlers ----------------
+
+func (s *FakeServer) auth(next func(http.ResponseWriter, *http.Request, FakeUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		s.mu.Lock()
+		idx := slices.IndexFunc(s.users, func(u FakeUser) bool { return u.Token != "" && u.Token == token })
+		if id, ok := s.oauthTokens[token]; ok && idx < 0 {
+			idx = slices.IndexFunc(s.users, func(u FakeUser) bool { return u.ID == id })
+		}
+		var user FakeUser
+		if idx >= 0 {
+			user = s.users[idx]
+		}
+		s.mu.Unlock()
+		if idx < 0 {
+			fakeError(w, http.StatusUnauthorized, "401: Unauthorized")
+			return
+		}
+		next(w, r, user)
+	}
+}
+
+func (s *FakeServer) handleMe(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	fakeJSON(w, http.StatusOK, map[string]string{"id": u.ID, "username": u.Username, "avatar": u.Avatar})
+}
+
+func (s *FakeServer) handleMyGuilds(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if u.Guest {
+		fakeJSON(w, http.StatusOK, []map[string]any{})
+		return
+	}
+	fakeJSON(w, http.StatusOK, []map[string]any{{"id": s.GuildID, "name": s.GuildName, "owner": u.ID == s.OwnerID}})
+}
+
+func (s *FakeServer) handleGuild(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if !s.checkGuild(w, r) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fakeJSON(w, http.StatusOK, map[string]any{"id": s.GuildID, "name": s.GuildName, "owner_id": s.OwnerID, "roles": s.roles})
+}
+
+func (s *FakeServer) handleRoles(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if !s.checkGuild(w, r) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fakeJSON(w, http.StatusOK, s.roles)
+}
+
+// 公会频道列表不包含帖子 / 子区（与 Discord 一致）
+func (s *FakeServer) handleGuildChannels(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if !s.checkGuild(w, r) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chs := []Channel{}
+	for _, ch := range s.channels {
+		if !IsThread(ch.Type) {
+			chs = append(chs, ch)
+		}
+	}
+	fakeJSON(w, http.StatusOK, chs)
+}
+
+func (s *FakeServer) handleMember(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	if !s.checkGuild(w, r) {
+		return
+	}
+	s.mu.Lock()
+	idx := slices.IndexFunc(s.users, func(m FakeUser) bool { return m.ID == r.PathValue("user") })
+	var member FakeUser
+	if idx >= 0 {
+		member = s.users[idx]
+	}
+	s.mu.Unlock()
+	if idx < 0 || member.Guest {
+		fakeError(w, http.StatusNotFound, "Unknown Member")
+		return
+	}
+	fakeJSON(w, http.StatusOK, memberJSON(member))
+}
+
+func memberJSON(u FakeUser) map[string]any {
+	roles := u.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return map[string]any{
+		"user":  map[string]string{"id": u.ID, "username": u.Username, "avatar": u.Avatar},
+		"roles": roles,
+	}
+}
+
+func (s *FakeServer) handleChannel(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	ch, ok := s.findChannel(r.PathValue("channel"))
+	if !ok {
+		fakeError(w, http.StatusNotFound, "Unknown Channel")
+		return
+	}
+	fakeJSON(w, http.StatusOK, ch)
+}
+
+func (s *FakeServer) handleThreadMember(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	threadID, userID := r.PathValue("channel"), r.PathValue("user")
+	s.mu.Lock()
+	ok := slices.Contains(s.members[threadID], userID)
+	s.mu.Unlock()
+	if !ok {
+		fakeError(w, http.StatusNotFound, "Unknown Member")
+		return
+	}
+	fakeJSON(w, http.StatusOK, map[string]string{"id": threadID, "user_id": userID})
+}
+
+// messages：limit 默认 50、最大 100，结果按 ID 降序（与 Discord 一致）
+func (s *FakeServer) handleMessages(w http.ResponseWriter, r *http.Request, u FakeUser) {
+	channelID := r.PathValue("channel")
+	s.mu.Lock()
+	s.requests++
+	limited := s.RateLimitEvery > 0 && s.requests%s.RateLimitEvery == 0
+	all := s.messages[channelID]
+	s.mu.Unlock()
+
+	if limited {
+		retry := s.RetryAfter
+		if retry <= 0 {
+			retry = 0.05
+		}
+		fakeJSON(w, http.StatusTooManyRequests, map[string]any{"message": "You are being rate limited.", "retry_after": retry, "global": false})
+		return
+	}
+	if _, ok := s.findChannel(channelID); !ok {
+		fakeError(w, http.StatusNotFound, "Unknown Channel")
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, 100)
+
+	var page []Message
+	switch {
+	case q.Get("after") != "":
+		after := q.Get("after")
+		i, _ := slices.BinarySearchFunc(all, after, func(m Message, id string) int { return CompareIDs(m.ID, id) })
+		if i < len(all) && all[i].ID == after {
+			i++
+		}
+		page = all[i:min(i+limit, len(all))]
+	case q.Get("around") != "":
+		i, _ := slices.BinarySearchFunc(all, q.Get("around"), func(m Message, id string) int { return CompareIDs(m.ID, id) })
+		start := max(0, i-limit/2)
+		page = all[start:min(start+limit, len(all))]
+	default:
+		end := len(all)
+		if before := q.Get("before"); before != "" {
+			end, _ = slices.BinarySearchFunc(all, before, func(m Message, id string) int { return CompareIDs(m.ID, id) })
+		}
+		page = all[max(0, end-limit):end]
+	}
+
+	out := slices.Clone(page)
+	slices.Reverse(out)
+	if out == nil {
+		out = []Message{}
+	}
+	fakeJSON(w, http.StatusOK, out)
+}
+
+func (s *FakeServer) checkGuild(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("guild") != s.GuildID {
+		fakeError(w, http.StatusNotFound, "Unknown Guild")
+		return false
+	}
+	return true
+}
+
+func (s *FakeServer) findChannel(id string) (Channel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.channels, func(ch Channel) bool { return ch.ID == id })
+	if idx < 0 {
+		return Channel{}, false
+	}
+	return s.channels[idx], true
+}
+
+func fakeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fakeError(w http.ResponseWriter, status int, msg string) {
+	fakeJSON(w, status, map[string]any{"message": msg, "code": 0})
+}
+
+// String 便于在日志中打印假服务器概况
+func (s *FakeServer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, msgs := range s.messages {
+		total += len(msgs)
+	}
+	return fmt.Sprintf("guild=%s users=%d channels=%d messages=%d", s.GuildID, len(s.users), len(s.channels), total)
+}
@@ -0,0 +1,328 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ==========================================
+// HTTP 录制 / 回放 (Fixtures)
+// ==========================================
+
+// 录制时会被替换的请求 / 响应头，避免把 Token 写进 fixture
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// 录制时会被替换的请求 / 响应体字段（OAuth2 换取令牌的表单和响应）
+var redactedFields = []string{"code", "client_secret", "access_token", "refresh_token", "token"}
+
+const redacted = "REDACTED"
+
+// Fixture 是一次录制下来的请求与响应；URL 只保存路径和查询参数，回放时与 API 地址无关
+type Fixture struct {
+	Seq             int         `json:"seq"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	Body            string      `json:"body"`
+}
+
+var (
+	fixtureMu       sync.Mutex
+	fixtureRecorder *RecordingTransport
+	fixtureReplayer *ReplayTransport
+)
+
+// EnableRecording 之后 NewHTTPClient 创建的客户端会把每个请求 / 响应写入 dir
+func EnableRecording(dir string) error {
+	rec, err := NewRecordingTransport(nil, dir)
+	if err != nil {
+		return err
+	}
+	fixtureMu.Lock()
+	fixtureRecorder, fixtureReplayer = rec, nil
+	fixtureMu.Unlock()
+	return nil
+}
+
+// EnableReplay 之后 NewHTTPClient 创建的客户端只从 dir 中的 fixture 返回响应，不访问网络
+func EnableReplay(dir string) error {
+	rep, err := NewReplayTransport(dir)
+	if err != nil {
+		return err
+	}
+	fixtureMu.Lock()
+	fixtureRecorder, fixtureReplayer = nil, rep
+	fixtureMu.Unlock()
+	return nil
+}
+
+// 按当前录制 / 回放模式包装客户端的 Transport
+func wrapFixtureTransport(client *http.Client) {
+	fixtureMu.Lock()
+	rec, rep := fixtureRecorder, fixtureReplayer
+	fixtureMu.Unlock()
+	switch {
+	case rep != nil:
+		client.Transport = rep
+	case rec != nil:
+		client.Transport = rec.withBase(client.Transport)
+	}
+}
+
+// ---------------- 录制 ----------------
+
+// RecordingTransport 把经过的请求 / 响应按顺序写成 <seq>-<method>-<path>.json
+type RecordingTransport struct {
+	Base http.RoundTripper // 为 nil 时使用 http.DefaultTransport
+	dir  string
+	seq  *atomic.Int64 // 多个客户端共享同一序号
+}
+
+// NewRecordingTransport 创建录制器；目录中已有的 fixture 会被保留，新的序号接在后面
+func NewRecordingTransport(base http.RoundTripper, dir string) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	seq := &atomic.Int64{}
+	seq.Store(int64(len(existing)))
+	return &RecordingTransport{Base: base, dir: dir, seq: seq}, nil
+}
+
+func (t *RecordingTransport) withBase(base http.RoundTripper) *RecordingTransport {
+	return &RecordingTransport{Base: base, dir: t.dir, seq: t.seq}
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	fx := Fixture{
+		Seq:             int(t.seq.Add(1)),
+		Method:          req.Method,
+		URL:             fixtureURL(req),
+		RequestHeaders:  redactHeaders(req.Header),
+		RequestBody:     redactBody(reqBody),
+		Status:          resp.StatusCode,
+		ResponseHeaders: redactHeaders(resp.Header),
+		Body:            redactBody(body),
+	}
+	if err := writeFixture(t.dir, fx); err != nil {
+		return nil, fmt.Errorf("录制 fixture 失败: %w", err)
+	}
+	return resp, nil
+}
+
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, redacted)
+		}
+	}
+	return out
+}
+
+// redactBody 替换 JSON 对象或表单中的敏感字段，其他内容原样保留
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		if redactJSON(v) {
+			if out, err := json.Marshal(v); err == nil {
+				return string(out)
+			}
+		}
+		return string(body)
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil {
+		changed := false
+		for _, name := range redactedFields {
+			if form.Has(name) {
+				form.Set(name, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			return form.Encode()
+		}
+	}
+	return string(body)
+}
+
+// 递归替换 JSON 中的敏感字段，返回是否有替换
+func redactJSON(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if slices.Contains(redactedFields, k) {
+				if _, isString := child.(string); isString {
+					v[k] = redacted
+					changed = true
+					continue
+				}
+			}
+			changed = redactJSON(child) || changed
+		}
+	case []any:
+		for _, child := range v {
+			changed = redactJSON(child) || changed
+		}
+	}
+	return changed
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+func writeFixture(dir string, fx Fixture) error {
+	path, _, _ := strings.Cut(fx.URL, "?")
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(path, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, fmt.Sprintf("%04d-%s-%s.json", fx.Seq, fx.Method, name)), data, 0644)
+}
+
+// 只保留 API 前缀之后的路径和查询参数，例如 /channels/1/messages?limit=100
+func fixtureURL(req *http.Request) string {
+	u := req.URL.RequestURI()
+	if base := strings.TrimRight(APIBase, "/"); base != "" {
+		if i := strings.Index(base, "://"); i >= 0 {
+			if j := strings.Index(base[i+3:], "/"); j >= 0 {
+				u = strings.TrimPrefix(u, base[i+3+j:])
+			}
+		}
+	}
+	return u
+}
+
+// ---------------- 回放 ----------------
+
+// ReplayTransport 按 方法 + URL 匹配 fixture；同一请求出现多次时按录制顺序依次返回，用完后重复最后一个
+type ReplayTransport struct {
+	mu       sync.Mutex
+	fixtures map[string][]Fixture
+}
+
+// NewReplayTransport 读取目录中的所有 fixture
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("目录 %s 中没有 fixture", dir)
+	}
+	var all []Fixture
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var fx Fixture
+		if err := json.Unmarshal(data, &fx); err != nil {
+			return nil, fmt.Errorf("解析 fixture %s 失败: %w", f, err)
+		}
+		all = append(all, fx)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Seq < all[j].Seq })
+
+	t := &ReplayTransport{fixtures: make(map[string][]Fixture)}
+	for _, fx := range all {
+		key := fx.Method + " " + fx.URL
+		t.fixtures[key] = append(t.fixtures[key], fx)
+	}
+	return t, nil
+}
+
+// NewReplayClient 创建只从 fixture 目录返回响应的客户端，便于在测试中使用
+func NewReplayClient(dir string) (*http.Client, error) {
+	t, err := NewReplayTransport(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + fixtureURL(req)
+
+	t.mu.Lock()
+	queue := t.fixtures[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("回放模式下没有匹配的 fixture: %s", key)
+	}
+	fx := queue[0]
+	if len(queue) > 1 {
+		t.fixtures[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	header := fx.ResponseHeaders.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fx.Status, http.StatusText(fx.Status)),
+		StatusCode:    fx.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fx.Body)),
+		ContentLength: int64(len(fx.Body)),
+		Request:       req,
+	}, nil
+}
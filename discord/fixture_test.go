@@ -0,0 +1,110 @@
+package discord
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 使用假服务器并把 APIBase 指向它，测试结束后恢复
+func startFakeServer(t *testing.T, s *FakeServer) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	SetAPIBase(s.APIBase(ts.URL))
+	t.Cleanup(func() { SetAPIBase("") })
+	return ts
+}
+
+func TestRecordingRedactsOAuthTokens(t *testing.T) {
+	s := NewFakeServer("100")
+	s.OAuthClientID, s.OAuthClientSecret = "client-1", "secret-xyz"
+	s.AddUser(FakeUser{Token: "user-token-abc", ID: "1", Username: "alice"})
+	startFakeServer(t, s)
+
+	// 走一遍授权码流程拿到 code
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	cfg := OAuthConfig{ClientID: "client-1", ClientSecret: "secret-xyz", RedirectURL: "http://viewer.test/oauth/callback"}
+	resp, err := noRedirect.Get(cfg.AuthCodeURL("state-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := loc.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", loc)
+	}
+
+	dir := t.TempDir()
+	rec, err := NewRecordingTransport(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+	tok, err := cfg.Exchange(client, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetCurrentUser(client, tok.Authorization()); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d fixtures, want 2", len(files))
+	}
+	secrets := []string{code, tok.AccessToken, tok.RefreshToken, "secret-xyz"}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q:\n%s", filepath.Base(f), secret, data)
+			}
+		}
+	}
+
+	// 回放时令牌被替换，但仍是可解析的响应
+	replay, err := NewReplayClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cfg.Exchange(replay, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != redacted || got.RefreshToken != redacted {
+		t.Errorf("replayed token = %+v, want redacted", got)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"form", "code=abc&grant_type=authorization_code", "code=REDACTED&grant_type=authorization_code"},
+		{"json token", `{"access_token":"a","scope":"identify"}`, `{"access_token":"REDACTED","scope":"identify"}`},
+		{"nested json", `[{"x":{"refresh_token":"r"}}]`, `[{"x":{"refresh_token":"REDACTED"}}]`},
+		{"numeric error code kept verbatim", `{"code": 50001, "message": "Missing Access"}`, `{"code": 50001, "message": "Missing Access"}`},
+		{"messages kept verbatim", `[{"id":"1","content":"hi"}]`, `[{"id":"1","content":"hi"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// Discord Gateway (websocket) 实时消息
+// ==========================================
+
+const (
+	DefaultGatewayURL = "wss://gateway.discord.gg/?v=9&encoding=json"
+
+	// Gateway opcode
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+
+	// GUILDS | GUILD_MESSAGES | MESSAGE_CONTENT
+	gatewayIntents = 1<<0 | 1<<9 | 1<<15
+
+	maxGatewayBackoff = time.Minute
+)
+
+// 查看器关心的消息事件类型
+const (
+	EventMessageCreate = "MESSAGE_CREATE"
+	EventMessageUpdate = "MESSAGE_UPDATE"
+	EventMessageDelete = "MESSAGE_DELETE"
+)
+
+// GatewayEvent 是一条消息相关的 Gateway 事件；删除事件只有 ChannelID 和 Message.ID
+type GatewayEvent struct {
+	Type      string
+	ChannelID string
+	Message   Message
+}
+
+// Gateway 连接 Discord Gateway 并把消息事件交给 Handler；断线后自动重连并尽量 RESUME
+type Gateway struct {
+	URL     string               // 为空时使用 DefaultGatewayURL，测试时可指向本地假 Gateway
+	Token   string               // 与 REST 相同的 Authorization 值，IDENTIFY 时会去掉 "Bot " 前缀
+	Proxy   string               // 可选代理
+	Handler func(GatewayEvent)   // 只会收到 MESSAGE_CREATE / UPDATE / DELETE
+	Status  func(connected bool) // 可选，连接状态变化时回调
+
+	sessionID string
+	resumeURL string
+	seq       atomic.Int64 // 心跳协程并发读取
+}
+
+type gatewayPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// Run 保持连接直到 ctx 取消；每次断线按指数退避重连
+func (g *Gateway) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		connected, err := g.runOnce(ctx)
+		if g.Status != nil {
+			g.Status(false)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = time.Second
+		}
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		slog.Warn("Gateway 连接断开，稍后重连", "err", err, "wait", wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, maxGatewayBackoff)
+	}
+}
+
+// runOnce 建立一次连接并处理消息直到断线；connected 表示本次是否成功完成了 READY / RESUMED
+func (g *Gateway) runOnce(ctx context.Context) (connected bool, err error) {
+	target := g.URL
+	if target == "" {
+		target = DefaultGatewayURL
+	}
+	resuming := g.sessionID != ""
+	if resuming && g.resumeURL != "" {
+		target = withGatewayQuery(g.resumeURL, target)
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: 30 * time.Second, Proxy: http.ProxyFromEnvironment}
+	if g.Proxy != "" {
+		if u, err := url.Parse(g.Proxy); err == nil {
+			dialer.Proxy = http.ProxyURL(u)
+		}
+	}
+	conn, _, err := dialer.DialContext(ctx, target, http.Header{"User-Agent": {UserAgent}})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// ctx 取消时关闭连接，让阻塞的 ReadJSON 返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var writeMu sync.Mutex
+	send := func(op int, d any) error {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(gatewayPayload{Op: op, D: raw})
+	}
+
+	// 第一条必须是 HELLO
+	var hello gatewayPayload
+	if err := conn.ReadJSON(&hello); err != nil {
+		return false, err
+	}
+	if hello.Op != opHello {
+		return false, fmt.Errorf("expected HELLO, got op %d", hello.Op)
+	}
+	var helloData struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.D, &helloData); err != nil || helloData.HeartbeatInterval <= 0 {
+		return false, fmt.Errorf("invalid HELLO payload: %s", hello.D)
+	}
+
+	if resuming {
+		err = send(opResume, map[string]any{"token": identifyToken(g.Token), "session_id": g.sessionID, "seq": g.seq.Load()})
+	} else {
+		err = send(opIdentify, map[string]any{
+			"token":   identifyToken(g.Token),
+			"intents": gatewayIntents,
+			"properties": map[string]string{
+				"os":      "linux",
+				"browser": "DiscordArchiveViewer",
+				"device":  "DiscordArchiveViewer",
+			},
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// 心跳：未收到上一次心跳的 ACK 时视为僵死连接，主动断开
+	var ackMu sync.Mutex
+	acked := true
+	go func() {
+		interval := time.Duration(helloData.HeartbeatInterval) * time.Millisecond
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(interval))))
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			ackMu.Lock()
+			ok := acked
+			acked = false
+			ackMu.Unlock()
+			if !ok {
+				conn.Close()
+				return
+			}
+			if err := send(opHeartbeat, g.seq.Load()); err != nil {
+				return
+			}
+			t.Reset(interval)
+		}
+	}()
+
+	for {
+		var p gatewayPayload
+		if err := conn.ReadJSON(&p); err != nil {
+			return connected, err
+		}
+		if p.S != nil {
+			g.seq.Store(*p.S)
+		}
+
+		switch p.Op {
+		case opHeartbeat:
+			send(opHeartbeat, g.seq.Load())
+		case opHeartbeatACK:
+			ackMu.Lock()
+			acked = true
+			ackMu.Unlock()
+		case opReconnect:
+			return connected, errors.New("server requested reconnect")
+		case opInvalidSession:
+			var resumable bool
+			json.Unmarshal(p.D, &resumable)
+			if !resumable {
+				g.sessionID, g.resumeURL = "", ""
+				g.seq.Store(0)
+			}
+			return connected, errors.New("invalid session")
+		case opDispatch:
+			switch p.T {
+			case "READY":
+				var ready struct {
+					SessionID        string `json:"session_id"`
+					ResumeGatewayURL string `json:"resume_gateway_url"`
+				}
+				json.Unmarshal(p.D, &ready)
+				g.sessionID, g.resumeURL = ready.SessionID, ready.ResumeGatewayURL
+				connected = true
+				if g.Status != nil {
+					g.Status(true)
+				}
+			case "RESUMED":
+				connected = true
+				if g.Status != nil {
+					g.Status(true)
+				}
+			case EventMessageCreate, EventMessageUpdate, EventMessageDelete:
+				var data struct {
+					Message
+					ChannelID string `json:"channel_id"`
+				}
+				if err := json.Unmarshal(p.D, &data); err != nil {
+					slog.Warn("Gateway 事件解析失败", "event", p.T, "err", err)
+					continue
+				}
+				if g.Handler != nil {
+					g.Handler(GatewayEvent{Type: p.T, ChannelID: data.ChannelID, Message: data.Message})
+				}
+			}
+		}
+	}
+}
+
+// Gateway 的 IDENTIFY / RESUME 使用不带 "Bot " 前缀的原始 Token
+func identifyToken(auth string) string {
+	return strings.TrimPrefix(auth, botPrefix)
+}
+
+// resume_gateway_url 不带查询参数，沿用原 URL 的 v / encoding
+func withGatewayQuery(resumeURL, original string) string {
+	u, err := url.Parse(resumeURL)
+	if err != nil {
+		return original
+	}
+	if o, err := url.Parse(original); err == nil && u.RawQuery == "" {
+		u.RawQuery = o.RawQuery
+	}
+	return u.String()
+}
+
+// ApplyGatewayEvent 把一条消息事件应用到按 ID 升序的消息列表，返回新列表及是否有变化；
+// 会原地修改 msgs，调用方需自行复制。MESSAGE_UPDATE 可能只带部分字段，缺失的作者等信息保留原值
+func ApplyGatewayEvent(msgs []Message, ev GatewayEvent) ([]Message, bool) {
+	idx := -1
+	for i := range msgs {
+		if msgs[i].ID == ev.Message.ID {
+			idx = i
+			break
+		}
+	}
+
+	switch ev.Type {
+	case EventMessageCreate:
+		if idx >= 0 {
+			return msgs, false
+		}
+		msgs = append(msgs, ev.Message)
+		SortMessages(msgs)
+		return msgs, true
+	case EventMessageUpdate:
+		if idx < 0 {
+			return msgs, false
+		}
+		old := &msgs[idx]
+		upd := ev.Message
+		if upd.Author.ID == "" {
+			if upd.EditedAt != "" {
+				old.Content = upd.Content
+				old.EditedAt = upd.EditedAt
+			}
+			if upd.Attachments != nil {
+				old.Attachments = upd.Attachments
+			}
+			return msgs, true
+		}
+		msgs[idx] = upd
+		return msgs, true
+	case EventMessageDelete:
+		if idx < 0 {
+			return msgs, false
+		}
+		return append(msgs[:idx:idx], msgs[idx+1:]...), true
+	}
+	return msgs, false
+}
@@ -0,0 +1,61 @@
+package discord
+
+// ==========================================
+// Discord 原始数据模型 (查看器与抓取脚本共用)
+// ==========================================
+
+type Message struct {
+	ID          string       `json:"id"`
+	Content     string       `json:"content"`
+	Timestamp   string       `json:"timestamp"`
+	EditedAt    string       `json:"edited_timestamp,omitempty"`
+	Author      Author       `json:"author"`
+	Attachments []Attachment `json:"attachments"`
+	MsgRef      *MsgRef      `json:"message_reference,omitempty"`
+}
+
+type Author struct {
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+	ID       string `json:"id"`
+}
+
+type Attachment struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+}
+
+type MsgRef struct {
+	MessageID string `json:"message_id"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+type Member struct {
+	Roles []string `json:"roles"`
+}
+
+// Channel 是 Discord 频道对象（帖子 / 子区的 ParentID 为所在频道）
+type Channel struct {
+	ID                   string                `json:"id"`
+	Name                 string                `json:"name"`
+	GuildID              string                `json:"guild_id"`
+	ParentID             string                `json:"parent_id,omitempty"`
+	Type                 int                   `json:"type"`
+	Position             int                   `json:"position"`
+	PermissionOverwrites []PermissionOverwrite `json:"permission_overwrites"`
+}
+
+type PermissionOverwrite struct {
+	ID    string `json:"id"`
+	Type  int    `json:"type"` // 0 = role, 1 = member
+	Allow string `json:"allow"`
+	Deny  string `json:"deny"`
+}
+
+// Role 是公会角色，Permissions 为十进制字符串形式的权限位
+type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Permissions string `json:"permissions"`
+	Position    int    `json:"position"`
+}
@@ -0,0 +1,157 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ==========================================
+// OAuth2 授权码登录
+// ==========================================
+
+const (
+	DefaultAuthorizeURL = "https://discord.com/oauth2/authorize"
+
+	// 登录需要的权限：用户信息、所在公会、在公会中的成员信息（角色）
+	OAuthScopes = "identify guilds guilds.members.read"
+)
+
+// OAuthConfig 是 Discord 应用的 OAuth2 配置；AuthorizeURL / TokenURL 为空时根据 APIBase 推导
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthorizeURL string
+	TokenURL     string
+}
+
+// OAuthToken 是授权码换取到的令牌
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// Authorization 返回请求头中使用的值，例如 "Bearer xxx"
+func (t *OAuthToken) Authorization() string {
+	typ := t.TokenType
+	if typ == "" {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+func (c OAuthConfig) authorizeURL() string {
+	if c.AuthorizeURL != "" {
+		return c.AuthorizeURL
+	}
+	if APIBase == DefaultAPIBase {
+		return DefaultAuthorizeURL
+	}
+	return APIBase + "/oauth2/authorize"
+}
+
+func (c OAuthConfig) tokenURL() string {
+	if c.TokenURL != "" {
+		return c.TokenURL
+	}
+	return APIBase + "/oauth2/token"
+}
+
+// AuthCodeURL 返回跳转到 Discord 授权页的地址，state 用于防止 CSRF
+func (c OAuthConfig) AuthCodeURL(state string) string {
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.ClientID},
+		"scope":         {OAuthScopes},
+		"redirect_uri":  {c.RedirectURL},
+		"state":         {state},
+		"prompt":        {"none"},
+	}
+	return c.authorizeURL() + "?" + q.Encode()
+}
+
+// Exchange 用授权码换取访问令牌
+func (c OAuthConfig) Exchange(client *http.Client, code string) (*OAuthToken, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.RedirectURL},
+	}
+	req, err := http.NewRequest("POST", c.tokenURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: c.tokenURL(), Body: string(body)}
+	}
+
+	var tok OAuthToken
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("oauth token response has no access_token")
+	}
+	return &tok, nil
+}
+
+// OAuthUser 是 /users/@me 返回的用户信息
+type OAuthUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+}
+
+// GetCurrentUser 获取令牌对应的用户
+func GetCurrentUser(client *http.Client, auth string) (*OAuthUser, error) {
+	var u OAuthUser
+	if err := getJSON(client, auth, APIBase+"/users/@me", &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetCurrentUserGuildMember 获取当前用户在公会中的成员信息（需要 guilds.members.read），不是成员时返回 404 的 *StatusError
+func GetCurrentUserGuildMember(client *http.Client, auth, guildID string) (*Member, error) {
+	var m Member
+	if err := getJSON(client, auth, fmt.Sprintf("%s/users/@me/guilds/%s/member", APIBase, guildID), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func getJSON(client *http.Client, auth, u string, v any) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode, URL: u, Body: string(body)}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,155 @@
+package discord
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ==========================================
+// 权限计算（与 Discord 官方算法一致）
+// https://discord.com/developers/docs/topics/permissions
+// ==========================================
+
+const (
+	PermAdministrator      = 0x8
+	PermViewChannel        = 0x400
+	PermReadMessageHistory = 0x10000
+	PermManageThreads      = 1 << 34
+
+	PermAll = ^uint64(0) // 管理员 / 公会所有者拥有全部权限
+
+	OverwriteRole   = 0
+	OverwriteMember = 1
+
+	ChannelTypeAnnouncementThread = 10
+	ChannelTypePublicThread       = 11
+	ChannelTypePrivateThread      = 12
+)
+
+// IsThread 频道类型是否为帖子 / 子区
+func IsThread(t int) bool {
+	return t == ChannelTypeAnnouncementThread || t == ChannelTypePublicThread || t == ChannelTypePrivateThread
+}
+
+// PermissionSubject 是计算权限所需的成员与公会信息
+type PermissionSubject struct {
+	GuildID   string // @everyone 角色的 ID 与公会 ID 相同
+	OwnerID   string // 公会所有者
+	UserID    string
+	Roles     []string          // 成员拥有的角色（不含 @everyone）
+	RolePerms map[string]uint64 // 公会所有角色的权限，包括 @everyone
+}
+
+// ParsePermissions 解析十进制字符串形式的权限位，空字符串为 0
+func ParsePermissions(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid permissions %q: %w", s, err)
+	}
+	return v, nil
+}
+
+// BasePermissions 计算公会级权限：所有者拥有全部权限；否则为 @everyone 与成员各角色权限的并集，含 ADMINISTRATOR 时拥有全部权限
+func BasePermissions(sub PermissionSubject) uint64 {
+	if sub.OwnerID != "" && sub.UserID == sub.OwnerID {
+		return PermAll
+	}
+	perms := sub.RolePerms[sub.GuildID]
+	for _, id := range sub.Roles {
+		perms |= sub.RolePerms[id]
+	}
+	if perms&PermAdministrator != 0 {
+		return PermAll
+	}
+	return perms
+}
+
+// ChannelPermissions 在公会级权限上依次应用频道的覆写：
+// @everyone 覆写 -> 成员所有角色覆写（allow / deny 各自取并集后一次应用）-> 成员个人覆写。
+// 覆写中的非法权限值会返回错误，此时结果不可信
+func ChannelPermissions(base uint64, ch Channel, sub PermissionSubject) (uint64, error) {
+	if base&PermAdministrator != 0 {
+		return PermAll, nil
+	}
+	perms := base
+
+	var everyone, member *PermissionOverwrite
+	var roleAllow, roleDeny uint64
+	for i, ow := range ch.PermissionOverwrites {
+		switch {
+		case ow.Type == OverwriteRole && ow.ID == sub.GuildID:
+			everyone = &ch.PermissionOverwrites[i]
+		case ow.Type == OverwriteMember && ow.ID == sub.UserID:
+			member = &ch.PermissionOverwrites[i]
+		case ow.Type == OverwriteRole && hasRole(sub.Roles, ow.ID):
+			allow, deny, err := parseOverwrite(ow)
+			if err != nil {
+				return 0, err
+			}
+			roleAllow |= allow
+			roleDeny |= deny
+		}
+	}
+
+	if everyone != nil {
+		allow, deny, err := parseOverwrite(*everyone)
+		if err != nil {
+			return 0, err
+		}
+		perms = perms&^deny | allow
+	}
+	perms = perms&^roleDeny | roleAllow
+	if member != nil {
+		allow, deny, err := parseOverwrite(*member)
+		if err != nil {
+			return 0, err
+		}
+		perms = perms&^deny | allow
+	}
+	return perms, nil
+}
+
+// ThreadPermissions 计算子区权限：子区没有自己的覆写，继承父频道的权限；
+// 私密子区还要求是子区成员，或在父频道拥有 MANAGE_THREADS
+func ThreadPermissions(parent uint64, thread Channel, isMember bool) uint64 {
+	if !CanView(parent) {
+		return 0
+	}
+	if thread.Type == ChannelTypePrivateThread && !isMember && parent&PermManageThreads == 0 {
+		return 0
+	}
+	return parent
+}
+
+// CanView 是否拥有查看频道权限
+func CanView(perms uint64) bool {
+	return perms&PermViewChannel != 0
+}
+
+// CanReadHistory 是否能阅读频道的历史消息：需要同时拥有 VIEW_CHANNEL 和 READ_MESSAGE_HISTORY，
+// 只有 VIEW_CHANNEL 时在 Discord 中只能看到进入频道之后的新消息，不能查看存档
+func CanReadHistory(perms uint64) bool {
+	return CanView(perms) && perms&PermReadMessageHistory != 0
+}
+
+func parseOverwrite(ow PermissionOverwrite) (allow, deny uint64, err error) {
+	if allow, err = ParsePermissions(ow.Allow); err != nil {
+		return 0, 0, fmt.Errorf("overwrite %s: %w", ow.ID, err)
+	}
+	if deny, err = ParsePermissions(ow.Deny); err != nil {
+		return 0, 0, fmt.Errorf("overwrite %s: %w", ow.ID, err)
+	}
+	return allow, deny, nil
+}
+
+func hasRole(roles []string, id string) bool {
+	for _, r := range roles {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package discord
+
+import (
+	"strconv"
+	"testing"
+)
+
+const (
+	testGuild   = "100"
+	testOwner   = "1"
+	testUser    = "2"
+	testRoleA   = "201"
+	testRoleB   = "202"
+	testRoleAdm = "203"
+
+	permView = PermViewChannel | PermReadMessageHistory
+)
+
+func perm(p uint64) string { return strconv.FormatUint(p, 10) }
+
+func testSubject(roles ...string) PermissionSubject {
+	return PermissionSubject{
+		GuildID: testGuild,
+		OwnerID: testOwner,
+		UserID:  testUser,
+		Roles:   roles,
+		RolePerms: map[string]uint64{
+			testGuild:   permView, // @everyone
+			testRoleA:   0,
+			testRoleB:   PermManageThreads,
+			testRoleAdm: PermAdministrator,
+		},
+	}
+}
+
+func TestBasePermissions(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  func() PermissionSubject
+		want uint64
+	}{
+		{"guild owner gets everything", func() PermissionSubject {
+			s := testSubject()
+			s.UserID = testOwner
+			return s
+		}, PermAll},
+		{"administrator role gets everything", func() PermissionSubject { return testSubject(testRoleAdm) }, PermAll},
+		{"@everyone included without explicit role", func() PermissionSubject { return testSubject() }, permView},
+		{"roles OR'd with @everyone", func() PermissionSubject { return testSubject(testRoleA, testRoleB) }, permView | PermManageThreads},
+		{"unknown role ignored", func() PermissionSubject { return testSubject("999") }, permView},
+		{"no @everyone perms", func() PermissionSubject {
+			s := testSubject(testRoleB)
+			s.RolePerms[testGuild] = 0
+			return s
+		}, PermManageThreads},
+		{"empty owner never matches", func() PermissionSubject {
+			s := testSubject()
+			s.OwnerID, s.UserID = "", ""
+			return s
+		}, permView},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BasePermissions(tt.sub()); got != tt.want {
+				t.Errorf("BasePermissions = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelPermissions(t *testing.T) {
+	ow := func(id string, typ int, allow, deny uint64) PermissionOverwrite {
+		return PermissionOverwrite{ID: id, Type: typ, Allow: perm(allow), Deny: perm(deny)}
+	}
+	tests := []struct {
+		name       string
+		base       uint64
+		roles      []string
+		overwrites []PermissionOverwrite
+		want       uint64
+		wantErr    bool
+	}{
+		{name: "no overwrites keeps base", base: permView, want: permView},
+		{name: "administrator bypasses overwrites", base: PermAdministrator,
+			overwrites: []PermissionOverwrite{ow(testGuild, OverwriteRole, 0, permView)}, want: PermAll},
+		{name: "@everyone deny", base: permView,
+			overwrites: []PermissionOverwrite{ow(testGuild, OverwriteRole, 0, PermViewChannel)}, want: PermReadMessageHistory},
+		{name: "@everyone allow", base: 0,
+			overwrites: []PermissionOverwrite{ow(testGuild, OverwriteRole, permView, 0)}, want: permView},
+		{name: "role allow beats @everyone deny", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{
+				ow(testGuild, OverwriteRole, 0, PermViewChannel),
+				ow(testRoleA, OverwriteRole, PermViewChannel, 0),
+			}, want: permView},
+		{name: "role overwrites OR'd: allow from one role wins over deny from another", base: permView, roles: []string{testRoleA, testRoleB},
+			overwrites: []PermissionOverwrite{
+				ow(testRoleA, OverwriteRole, PermViewChannel, 0),
+				ow(testRoleB, OverwriteRole, 0, PermViewChannel),
+			}, want: permView},
+		{name: "role overwrites OR'd regardless of order", base: permView, roles: []string{testRoleA, testRoleB},
+			overwrites: []PermissionOverwrite{
+				ow(testRoleB, OverwriteRole, 0, PermViewChannel),
+				ow(testRoleA, OverwriteRole, PermViewChannel, 0),
+			}, want: permView},
+		{name: "overwrite of role the user lacks ignored", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{ow(testRoleB, OverwriteRole, 0, PermViewChannel)}, want: permView},
+		{name: "member deny applied after role allow", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{
+				ow(testUser, OverwriteMember, 0, PermViewChannel),
+				ow(testRoleA, OverwriteRole, PermViewChannel, 0),
+			}, want: PermReadMessageHistory},
+		{name: "member allow applied after role deny", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{
+				ow(testRoleA, OverwriteRole, 0, permView),
+				ow(testUser, OverwriteMember, PermViewChannel, 0),
+			}, want: PermViewChannel},
+		{name: "other member's overwrite ignored", base: permView,
+			overwrites: []PermissionOverwrite{ow("3", OverwriteMember, 0, permView)}, want: permView},
+		{name: "member type with role ID is not a role overwrite", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{ow(testRoleA, OverwriteMember, 0, permView)}, want: permView},
+		{name: "invalid overwrite value", base: permView, roles: []string{testRoleA},
+			overwrites: []PermissionOverwrite{{ID: testRoleA, Type: OverwriteRole, Allow: "abc"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := testSubject(tt.roles...)
+			got, err := ChannelPermissions(tt.base, Channel{ID: "300", PermissionOverwrites: tt.overwrites}, sub)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ChannelPermissions = %#x, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ChannelPermissions = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanReadHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		perms    uint64
+		view     bool
+		readable bool
+	}{
+		{"view and history", permView, true, true},
+		{"view only", PermViewChannel, true, false},
+		{"history only", PermReadMessageHistory, false, false},
+		{"none", 0, false, false},
+		{"all", PermAll, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanView(tt.perms); got != tt.view {
+				t.Errorf("CanView = %v, want %v", got, tt.view)
+			}
+			if got := CanReadHistory(tt.perms); got != tt.readable {
+				t.Errorf("CanReadHistory = %v, want %v", got, tt.readable)
+			}
+		})
+	}
+}
+
+func TestThreadPermissions(t *testing.T) {
+	public := Channel{ID: "400", ParentID: "300", Type: ChannelTypePublicThread}
+	private := Channel{ID: "401", ParentID: "300", Type: ChannelTypePrivateThread}
+	tests := []struct {
+		name     string
+		parent   uint64
+		thread   Channel
+		isMember bool
+		want     uint64
+	}{
+		{"public thread inherits parent", permView, public, false, permView},
+		{"public thread inherits missing history", PermViewChannel, public, false, PermViewChannel},
+		{"parent not viewable", PermReadMessageHistory, public, true, 0},
+		{"private thread requires membership", permView, private, false, 0},
+		{"private thread member", permView, private, true, permView},
+		{"private thread with MANAGE_THREADS", permView | PermManageThreads, private, false, permView | PermManageThreads},
+		{"private thread member but parent hidden", 0, private, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ThreadPermissions(tt.parent, tt.thread, tt.isMember); got != tt.want {
+				t.Errorf("ThreadPermissions = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+// 从公会角色到子区的完整计算：子区没有自己的覆写，按父频道覆写后的权限判断
+func TestThreadInheritsParentOverwrites(t *testing.T) {
+	parent := Channel{ID: "300", PermissionOverwrites: []PermissionOverwrite{
+		{ID: testGuild, Type: OverwriteRole, Deny: perm(PermViewChannel)},
+		{ID: testRoleA, Type: OverwriteRole, Allow: perm(PermViewChannel)},
+	}}
+	thread := Channel{ID: "400", ParentID: parent.ID, Type: ChannelTypePublicThread}
+	tests := []struct {
+		name  string
+		roles []string
+		want  bool
+	}{
+		{"member with allowed role", []string{testRoleA}, true},
+		{"member without role", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := testSubject(tt.roles...)
+			p, err := ChannelPermissions(BasePermissions(sub), parent, sub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := CanReadHistory(ThreadPermissions(p, thread, false)); got != tt.want {
+				t.Errorf("readable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
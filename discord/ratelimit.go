@@ -0,0 +1,49 @@
+package discord
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter 是多个抓取任务共享的简单限速器：相邻两次请求之间至少间隔 interval，
+// 收到 429 时可整体暂停
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Wait 阻塞直到可以发出下一次请求，ctx 取消时返回 ctx.Err()
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(slot))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Pause 在 d 时间内不再放行任何请求
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+	l.mu.Unlock()
+}
@@ -1,3 +1,5 @@
 module github.com/ColorRabbit/CycleStudies
 
 go 1.25.6
+
+require github.com/gorilla/websocket v1.5.3
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 只读访客 (邀请链接 / 本地账号)
+// ==========================================
+
+const (
+	DefaultCommunityRef = "default" // 在访客配置中指代默认社区（其 ID 为空）
+
+	passwordHashScheme = "pbkdf2-sha256"
+	passwordHashIter   = 600000
+	passwordSaltLen    = 16
+	passwordKeyLen     = 32
+
+	DefaultInviteTTL = 7 * 24 * time.Hour
+)
+
+// hashPassword 生成 pbkdf2-sha256$<迭代次数>$<salt>$<hash> 格式的密码哈希
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIter, passwordKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIter,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword 校验密码是否与哈希一致
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// resolveGuestCommunities 把配置中的社区引用（"default" 表示默认社区）转换为社区 ID，为空表示全部社区
+func resolveGuestCommunities(refs []string) ([]string, error) {
+	if len(refs) == 0 {
+		var all []string
+		for _, c := range getCommunities() {
+			all = append(all, c.ID)
+		}
+		return all, nil
+	}
+	var ids []string
+	for _, ref := range refs {
+		c, ok := communityByRef(ref)
+		if !ok {
+			return nil, fmt.Errorf("未知社区: %q", ref)
+		}
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// ---------------- 本地账号 ----------------
+
+func guestAccountsEnabled() bool {
+	return len(getServerConfig().GuestAccounts) > 0
+}
+
+// validateGuestAccounts 检查 server_config.json 中的访客账号
+func validateGuestAccounts(accounts []GuestAccount) error {
+	seen := make(map[string]bool)
+	for _, a := range accounts {
+		if a.Username == "" {
+			return errors.New("访客账号缺少 username")
+		}
+		if seen[a.Username] {
+			return fmt.Errorf("访客账号 %q 重复", a.Username)
+		}
+		seen[a.Username] = true
+		if !strings.HasPrefix(a.PasswordHash, passwordHashScheme+"$") {
+			return fmt.Errorf("访客账号 %q 的 password_hash 无效，请用 hash-password 子命令生成", a.Username)
+		}
+		if _, err := guestAccountExpiry(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findGuestAccount(username string) (GuestAccount, bool) {
+	for _, a := range getServerConfig().GuestAccounts {
+		if a.Username != "" && a.Username == username {
+			return a, true
+		}
+	}
+	return GuestAccount{}, false
+}
+
+// 账号的过期时间（当天结束），未设置时为零值
+func guestAccountExpiry(a GuestAccount) (time.Time, error) {
+	if a.ExpiresAt == "" {
+		return time.Time{}, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", a.ExpiresAt, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("访客账号 %s 的 expires_at 无效: %w", a.Username, err)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// 用户名不存在时用来校验的哈希，使响应时间与密码错误时一致，不暴露哪些用户名存在
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
+
+// guestAccountLogin 校验本地访客账号并创建会话
+func guestAccountLogin(username, password string) (*UserSession, error) {
+	a, ok := findGuestAccount(username)
+	if !ok {
+		checkPassword(dummyPasswordHash(), password)
+		return nil, errors.New("用户名或密码错误")
+	}
+	if !checkPassword(a.PasswordHash, password) {
+		return nil, errors.New("用户名或密码错误")
+	}
+	expiry, err := guestAccountExpiry(a)
+	if err != nil {
+		return nil, err
+	}
+	if !expiry.IsZero() && time.Now().After(expiry) {
+		return nil, errors.New("账号已过期")
+	}
+	communities, err := resolveGuestCommunities(a.Communities)
+	if err != nil {
+		return nil, err
+	}
+	user := &UserSession{
+		UserID:      "account:" + a.Username,
+		Username:    a.Username,
+		Avatar:      getAvatar("", ""),
+		Auth:        AuthGuest,
+		Communities: communities,
+	}
+	if !expiry.IsZero() {
+		user.Expires = expiry.Unix()
+	}
+	return user, nil
+}
+
+// guestSessionValid 本地账号的会话在账号被删除后立即失效（邀请链接只能等过期或更换 session_secret）
+func guestSessionValid(user *UserSession) bool {
+	name, ok := strings.CutPrefix(user.UserID, "account:")
+	if !ok {
+		return true
+	}
+	_, exists := findGuestAccount(name)
+	return exists
+}
+
+// ---------------- 邀请链接 ----------------
+
+// newInviteToken 生成带签名的只读邀请，本身就是一个访客会话
+func newInviteToken(name string, communities []string, ttl time.Duration) (string, error) {
+	if getServerConfig().SessionSecret == "" {
+		return "", errors.New("生成邀请链接需要在 server_config.json 中配置 session_secret，否则重启后链接失效")
+	}
+	if getBotAuthorization() == "" {
+		return "", errors.New("访客按 @everyone 的权限查看帖子，需要配置 bot_token")
+	}
+	return encodeSession(&UserSession{
+		UserID:      "invite:" + name,
+		Username:    name,
+		Avatar:      getAvatar("", ""),
+		Auth:        AuthGuest,
+		Communities: communities,
+		Expires:     time.Now().Add(ttl).Unix(),
+	})
+}
+
+// 打开邀请链接：校验签名和有效期后写入会话 Cookie
+func handleInvite(w http.ResponseWriter, r *http.Request) {
+	user, err := decodeSession(r.URL.Query().Get("t"))
+	if err != nil || user.Auth != AuthGuest {
+		auditRequest(r, nil, AuditLogin, "", AuditFailed, "invite: 邀请链接无效或已过期")
+		renderLogin(w, "邀请链接无效或已过期")
+		return
+	}
+	if err := setSessionCookie(w, user); err != nil {
+		renderLogin(w, "创建会话失败")
+		return
+	}
+	auditRequest(r, user, AuditLogin, "", AuditOK, "invite")
+	reqLogger(r).Info("登录成功", userAttrs(user), "method", "invite", "expires", time.Unix(user.Expires, 0))
+	if err := ensurePostList(); err != nil {
+		renderLogin(w, "获取频道配置失败")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func isGuest(user *UserSession) bool {
+	return user != nil && user.Auth == AuthGuest
+}
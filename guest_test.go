@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// testPasswordHash 用较少的迭代次数生成哈希，避免测试变慢；格式与 hashPassword 相同
+func testPasswordHash(t *testing.T, password string) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, 1000, passwordKeyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, 1000,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func openInvite(t *testing.T, token string) (*httptest.ResponseRecorder, *UserSession) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleInvite(w, httptest.NewRequest("GET", "/invite?t="+url.QueryEscape(token), nil))
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CookieName && c.Value != "" {
+			return w, getCurrentUser(requestWithCookie(c.Value))
+		}
+	}
+	return w, nil
+}
+
+func TestInviteLinks(t *testing.T) {
+	useTestState(t, ServerConfig{SessionSecret: "s3cret", BotToken: testBotToken}, nil)
+
+	token, err := newInviteToken("mentor", []string{""}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, user := openInvite(t, token)
+	if w.Code != http.StatusSeeOther || user == nil || user.Auth != AuthGuest || !slices.Equal(user.Communities, []string{""}) {
+		t.Fatalf("valid invite: %d %+v", w.Code, user)
+	}
+
+	// 改写社区后签名不再匹配
+	payload, sig, _ := strings.Cut(token, ".")
+	forged, _ := encodeSession(&UserSession{UserID: "invite:mentor", Auth: AuthGuest, Communities: []string{"", "study2"}})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	expired, err := newInviteToken("mentor", []string{""}, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, _ := encodeSession(&UserSession{UserID: "1", Auth: AuthOAuth})
+	bad := map[string]string{
+		"tampered payload":   forgedPayload + "." + sig,
+		"tampered signature": payload + "." + sig[1:],
+		"expired":            expired,
+		"not a guest":        member,
+	}
+	for name, tok := range bad {
+		if w, user := openInvite(t, tok); user != nil || !strings.Contains(w.Body.String(), "邀请链接无效或已过期") {
+			t.Errorf("%s: status %d, user %+v", name, w.Code, user)
+		}
+	}
+
+	serverConfigMu.Lock()
+	serverConfig.SessionSecret = ""
+	serverConfigMu.Unlock()
+	if _, err := newInviteToken("mentor", nil, time.Hour); err == nil {
+		t.Error("invite created without session_secret")
+	}
+}
+
+func TestGuestAccountLogin(t *testing.T) {
+	cfg := ServerConfig{BotToken: testBotToken, GuestAccounts: []GuestAccount{
+		{Username: "mentor", PasswordHash: testPasswordHash(t, "pw")},
+		{Username: "old", PasswordHash: testPasswordHash(t, "pw"), ExpiresAt: "2020-01-01"},
+	}}
+	useTestState(t, cfg, nil)
+
+	for _, tt := range []struct{ user, password, wantErr string }{
+		{"mentor", "wrong", "用户名或密码错误"},
+		{"nobody", "pw", "用户名或密码错误"},
+		{"old", "pw", "账号已过期"},
+	} {
+		if _, err := guestAccountLogin(tt.user, tt.password); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s/%s: err = %v, want %q", tt.user, tt.password, err, tt.wantErr)
+		}
+	}
+
+	user, err := guestAccountLogin("mentor", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := encodeSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getCurrentUser(requestWithCookie(value)); got == nil || got.UserID != "account:mentor" {
+		t.Fatalf("session = %+v", got)
+	}
+
+	// 删除账号后已登录的会话立即失效
+	serverConfigMu.Lock()
+	serverConfig.GuestAccounts = serverConfig.GuestAccounts[1:]
+	serverConfigMu.Unlock()
+	if got := getCurrentUser(requestWithCookie(value)); got != nil {
+		t.Errorf("deleted account still signed in: %+v", got)
+	}
+}
+
+func TestGuestRestrictedToInvitedCommunities(t *testing.T) {
+	cfg := ServerConfig{Communities: []CommunityConfig{{ID: "study2", GuildID: GuildID, ChannelID: "130"}}}
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}, {FileName: "study2/2025-01.json", PostID: "131"}})
+	fake := useFakeGuild(t, "111")
+	fake.AddChannel(discord.Channel{ID: "130", Name: "gate2"})
+	fake.AddChannel(discord.Channel{ID: "131", Type: discord.ChannelTypePublicThread, ParentID: "130"})
+
+	for _, tt := range []struct {
+		communities []string
+		want        []string
+	}{
+		{[]string{""}, []string{"2025-01.json"}},
+		{[]string{"study2"}, []string{"study2/2025-01.json"}},
+		{[]string{"", "study2"}, []string{"2025-01.json", "study2/2025-01.json"}},
+		{nil, nil},
+	} {
+		user := &UserSession{UserID: "invite:x", Auth: AuthGuest, Communities: tt.communities}
+		var got []string
+		for _, p := range visiblePosts(user) {
+			got = append(got, p.FileName)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("communities %q: visible = %v, want %v", tt.communities, got, tt.want)
+		}
+	}
+}
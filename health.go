@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 健康检查 (/healthz) 与就绪检查 (/readyz)
+// ==========================================
+
+const (
+	HealthOK      = "ok"
+	HealthFail    = "fail"
+	HealthSkipped = "skipped" // 未开启的检查，不影响就绪
+
+	discordProbeTimeout = 5 * time.Second
+	discordProbeTTL     = 30 * time.Second // 探测结果的缓存时间，避免频繁轮询 /readyz 时反复访问 Discord
+)
+
+var processStartedAt = time.Now()
+
+// 启动时的加载结果，由 initService 记录
+var (
+	startupMu      sync.Mutex
+	startupDone    bool
+	configLoadErr  error
+	archiveLoadErr = make(map[string]error) // 文件名 -> 加载失败原因（文件不存在的不记录）
+)
+
+var (
+	discordProbeMu   sync.Mutex
+	discordProbeLast HealthCheck
+	discordProbeAt   time.Time
+)
+
+func recordConfigLoad(err error) {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	configLoadErr = err
+}
+
+func recordArchiveLoad(fileName string, err error) {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		archiveLoadErr[fileName] = err
+	} else {
+		delete(archiveLoadErr, fileName)
+	}
+}
+
+func markStartupDone() {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	startupDone = true
+}
+
+// 进程存活即返回 200
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         HealthOK,
+		"started_at":     processStartedAt,
+		"uptime_seconds": int(time.Since(processStartedAt).Seconds()),
+	})
+}
+
+// 所有检查通过（或被跳过）时返回 200，否则 503；每个子系统的结果都在 checks 中
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := ReadyStatus{
+		Status: HealthOK,
+		Checks: map[string]HealthCheck{
+			"config":   checkConfig(),
+			"data_dir": checkDataDir(),
+			"archives": checkArchives(),
+			"discord":  checkDiscord(r.Context()),
+		},
+	}
+	code := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status == HealthFail {
+			resp.Status = HealthFail
+			code = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, resp)
+}
+
+// 服务端配置与月份列表是否已加载
+func checkConfig() HealthCheck {
+	startupMu.Lock()
+	err := configLoadErr
+	startupMu.Unlock()
+	if err != nil {
+		return HealthCheck{Status: HealthFail, Error: err.Error()}
+	}
+	if err := ensurePostList(); err != nil {
+		return HealthCheck{Status: HealthFail, Error: "读取月份列表失败: " + err.Error()}
+	}
+	return HealthCheck{Status: HealthOK, Details: map[string]any{"posts": len(getPostList()), "communities": len(getCommunities())}}
+}
+
+// 数据目录是否可写（同步结果和实时模式都写入这里）
+func checkDataDir() HealthCheck {
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
+		return HealthCheck{Status: HealthFail, Error: err.Error()}
+	}
+	f, err := os.CreateTemp(DataDir, ".readyz-*")
+	if err != nil {
+		return HealthCheck{Status: HealthFail, Error: err.Error()}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return HealthCheck{Status: HealthOK, Details: map[string]any{"path": DataDir}}
+}
+
+// 存档是否已加载：加载失败（文件损坏等）的月份会使检查失败，尚未同步过的月份只列出不算失败
+func checkArchives() HealthCheck {
+	startupMu.Lock()
+	done := startupDone
+	failed := make(map[string]string)
+	for file, err := range archiveLoadErr {
+		failed[file] = err.Error()
+	}
+	startupMu.Unlock()
+	if !done {
+		return HealthCheck{Status: HealthFail, Error: "存档尚未加载完成"}
+	}
+
+	loaded, messages := 0, 0
+	var missing []string
+	storeMu.Lock()
+	for _, cfg := range getPostList() {
+		if msgs, ok := memoryStore[cfg.FileName]; ok {
+			loaded++
+			messages += len(msgs)
+			delete(failed, cfg.FileName) // 启动时损坏，之后已重新同步
+		} else if _, bad := failed[cfg.FileName]; !bad {
+			missing = append(missing, cfg.FileName)
+		}
+	}
+	storeMu.Unlock()
+
+	check := HealthCheck{Status: HealthOK, Details: map[string]any{"loaded": loaded, "messages": messages}}
+	if len(missing) > 0 {
+		check.Details["missing"] = missing
+	}
+	if len(failed) > 0 {
+		check.Status = HealthFail
+		check.Details["failed"] = failed
+		check.Error = "部分存档无法读取"
+	}
+	return check
+}
+
+// 通过配置的代理访问 Discord 的 /gateway（无需 Token），health.discord_probe 未开启时跳过
+func checkDiscord(ctx context.Context) HealthCheck {
+	if !getServerConfig().Health.DiscordProbe {
+		return HealthCheck{Status: HealthSkipped}
+	}
+	discordProbeMu.Lock()
+	defer discordProbeMu.Unlock()
+	if time.Since(discordProbeAt) < discordProbeTTL {
+		return discordProbeLast
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discordProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	check := HealthCheck{Status: HealthOK, Details: map[string]any{"proxy": ProxyURL != ""}}
+	req, err := http.NewRequestWithContext(ctx, "GET", discord.APIBase+"/gateway", nil)
+	if err == nil {
+		req.Header.Set("User-Agent", discord.UserAgent)
+		var resp *http.Response
+		if resp, err = getClient().Do(req); err == nil {
+			resp.Body.Close()
+			check.Details["status_code"] = resp.StatusCode
+			if resp.StatusCode >= 500 {
+				check.Status, check.Error = HealthFail, resp.Status
+			}
+		}
+	}
+	if err != nil {
+		check.Status, check.Error = HealthFail, err.Error()
+	}
+	check.Details["latency_ms"] = time.Since(start).Milliseconds()
+	discordProbeLast, discordProbeAt = check, time.Now()
+	return check
+}
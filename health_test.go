@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// 重置启动时记录的加载结果与 Discord 探测缓存
+func resetReadiness(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		startupMu.Lock()
+		startupDone, configLoadErr = false, nil
+		clear(archiveLoadErr)
+		startupMu.Unlock()
+		discordProbeMu.Lock()
+		discordProbeLast, discordProbeAt = HealthCheck{}, time.Time{}
+		discordProbeMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func getReadyz(t *testing.T) (int, ReadyStatus) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	var resp ReadyStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, resp
+}
+
+func TestReadyzAggregatesChecks(t *testing.T) {
+	gateway := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(gateway)
+	}))
+	defer ts.Close()
+	discord.SetAPIBase(ts.URL)
+	defer discord.SetAPIBase("")
+
+	useTestState(t, ServerConfig{Health: HealthConfig{DiscordProbe: true}}, []PostConfig{
+		{FileName: "2025-01.json", PostID: "111"},
+		{FileName: "2025-02.json", PostID: "222"},
+	})
+	resetReadiness(t)
+
+	// 存档加载完成前不就绪
+	if code, resp := getReadyz(t); code != http.StatusServiceUnavailable || resp.Checks["archives"].Status != HealthFail {
+		t.Fatalf("before startup: %d %+v", code, resp)
+	}
+
+	storeMu.Lock()
+	setStoredMessages("2025-01.json", testMessages("1", "2"))
+	storeMu.Unlock()
+	_, err := loadArchiveFile("2025-02.json") // 尚未同步过的月份
+	recordArchiveLoad("2025-02.json", err)
+	markStartupDone()
+	code, resp := getReadyz(t)
+	if code != http.StatusOK || resp.Status != HealthOK {
+		t.Fatalf("ready: %d %+v", code, resp)
+	}
+	for _, name := range []string{"config", "data_dir", "archives", "discord"} {
+		if resp.Checks[name].Status != HealthOK {
+			t.Errorf("check %s = %+v", name, resp.Checks[name])
+		}
+	}
+	if missing := resp.Checks["archives"].Details["missing"]; fmt.Sprint(missing) != "[2025-02.json]" {
+		t.Errorf("missing = %v", missing)
+	}
+
+	// 任一子系统失败时整体返回 503，其余检查照常给出
+	recordArchiveLoad("2025-02.json", errors.New("unexpected end of JSON input"))
+	if code, resp := getReadyz(t); code != http.StatusServiceUnavailable || resp.Status != HealthFail ||
+		resp.Checks["archives"].Status != HealthFail || resp.Checks["config"].Status != HealthOK {
+		t.Errorf("corrupt archive: %d %+v", code, resp)
+	}
+	recordArchiveLoad("2025-02.json", nil)
+
+	recordConfigLoad(errors.New("bad server_config.json"))
+	if code, resp := getReadyz(t); code != http.StatusServiceUnavailable || resp.Checks["config"].Status != HealthFail {
+		t.Errorf("config error: %d %+v", code, resp)
+	}
+	recordConfigLoad(nil)
+
+	gateway = http.StatusBadGateway
+	discordProbeMu.Lock()
+	discordProbeAt = time.Time{}
+	discordProbeMu.Unlock()
+	if code, resp := getReadyz(t); code != http.StatusServiceUnavailable || resp.Checks["discord"].Status != HealthFail {
+		t.Errorf("discord down: %d %+v", code, resp)
+	}
+}
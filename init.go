@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
-	"sort"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
 )
 
 //go:embed data/*.json
@@ -24,36 +27,41 @@ var ProxyURL = ""
 var memoryStore = make(map[string][]DiscordMessage)
 var storeMu sync.Mutex
 
-// ==========================================
-// 权限检查 - 从 Discord API 获取用户可访问的频道
-// ==========================================
+// 消息 ID -> 所在月份和下标，跨月份回复查找用；与 memoryStore 一起由 storeMu 保护，只通过 setStoredMessages 修改
+type storedMessageRef struct {
+	file  string
+	index int
+}
 
-const VIEW_CHANNEL uint64 = 0x400
+var messageIndex = make(map[string]storedMessageRef)
 
-// toMask: 把 string permissions 转成 uint64（你文件中若已有此函数可删除重复）
-func toMask(s string) uint64 {
-	if s == "" {
-		return 0
+// setStoredMessages 替换某个月份的消息并更新消息索引，调用方须持有 storeMu
+func setStoredMessages(file string, msgs []DiscordMessage) {
+	for _, m := range memoryStore[file] {
+		if messageIndex[m.ID].file == file {
+			delete(messageIndex, m.ID)
+		}
 	}
-	v, err := strconv.ParseUint(s, 10, 64)
-	if err != nil {
-		return 0
+	memoryStore[file] = msgs
+	for i, m := range msgs {
+		messageIndex[m.ID] = storedMessageRef{file: file, index: i}
 	}
-	return v
 }
 
-// applyOverwrite: 按 Discord 规则把 allow/deny 应用到当前 perms 上
-func applyOverwrite(perms uint64, allowStr, denyStr string) uint64 {
-	allow := toMask(allowStr)
-	deny := toMask(denyStr)
-	perms = (perms & ^deny) | allow
-	return perms
-}
+// 有变化、尚未写回磁盘的存档（同步任务和实时模式写入）
+const archiveFlushInterval = 5 * time.Second // 定期写回磁盘的间隔
+
+var dirtyArchivesMu sync.Mutex
+var dirtyArchives = make(map[string]bool)
+
+// ==========================================
+// 权限检查 - 从 Discord API 获取用户可访问的频道
+// ==========================================
 
 // 获取用户在 guild 中的角色列表
 func getUserRolesInGuild(token, guildID, userID string) ([]string, error) {
 	client := getClient()
-	url := fmt.Sprintf("https://discord.com/api/v9/guilds/%s/members/%s", guildID, userID)
+	url := fmt.Sprintf("%s/guilds/%s/members/%s", discord.APIBase, guildID, userID)
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Authorization", token)
 
@@ -64,7 +72,7 @@ func getUserRolesInGuild(token, guildID, userID string) ([]string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("get member failed: %d", resp.StatusCode)
+		return nil, &discord.StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 
 	var member struct {
@@ -79,7 +87,7 @@ func getUserRolesInGuild(token, guildID, userID string) ([]string, error) {
 // 获取 guild 中所有角色及其 permissions，返回 map[roleID]perm
 func getGuildRolesPerms(token, guildID string) (map[string]uint64, error) {
 	client := getClient()
-	url := fmt.Sprintf("https://discord.com/api/v9/guilds/%s/roles", guildID)
+	url := fmt.Sprintf("%s/guilds/%s/roles", discord.APIBase, guildID)
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Authorization", token)
 
@@ -103,69 +111,46 @@ func getGuildRolesPerms(token, guildID string) (map[string]uint64, error) {
 
 	m := make(map[string]uint64, len(roles))
 	for _, r := range roles {
-		m[r.ID] = toMask(r.Permissions)
+		perms, err := discord.ParsePermissions(r.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", r.ID, err)
+		}
+		m[r.ID] = perms
 	}
 	return m, nil
 }
 
-// 计算 basePerm（用户角色并集）
-func computeBasePerm(userRoles []string, rolePerms map[string]uint64) uint64 {
-	var base uint64 = 0
-	for _, rid := range userRoles {
-		if p, ok := rolePerms[rid]; ok {
-			base |= p
-		}
-	}
-	return base
-}
+// 获取公会所有者 ID（所有者拥有全部权限）
+func getGuildOwnerID(token, guildID string) (string, error) {
+	client := getClient()
+	url := fmt.Sprintf("%s/guilds/%s", discord.APIBase, guildID)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", token)
 
-// 按顺序应用 @everyone -> roles -> member 的 overwrites，返回最终是否有 VIEW_CHANNEL
-func channelReadableByUser(ch DiscordChannel, userRoles []string, perms uint64, guildID, userID string) bool {
-	// 1) 应用 @everyone 覆写（type==0 且 id==guildID）
-	for _, ow := range ch.PermissionOverwrites {
-		if ow.Type == 0 && ow.ID == guildID {
-			perms = applyOverwrite(perms, ow.Allow, ow.Deny)
-			//fmt.Printf("  应用 @everyone 覆写 allow=%s deny=%s -> perms=%064b\n", ow.Allow, ow.Deny, perms)
-			break
-		}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close()
 
-	// 2) 按用户角色逐个应用 role overwrites（type==0 且 id==roleID）
-	for _, roleID := range userRoles {
-		for _, ow := range ch.PermissionOverwrites {
-			if ow.Type == 0 && ow.ID == roleID {
-				perms = applyOverwrite(perms, ow.Allow, ow.Deny)
-				//fmt.Printf("  应用 role(%s) 覆写 allow=%s deny=%s -> perms=%064b\n", roleID, ow.Allow, ow.Deny, perms)
-				break
-			}
-		}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("get guild failed: %d", resp.StatusCode)
 	}
 
-	// 3) 最后应用 member 覆写（type==1 且 id==userID）
-	for _, ow := range ch.PermissionOverwrites {
-		if ow.Type == 1 && ow.ID == userID {
-			perms = applyOverwrite(perms, ow.Allow, ow.Deny)
-			//fmt.Printf("  应用 member(%s) 覆写 allow=%s deny=%s -> perms=%064b\n", userID, ow.Allow, ow.Deny, perms)
-			break
-		}
+	var guild struct {
+		OwnerID string `json:"owner_id"`
 	}
-
-	// 4) 判断 VIEW_CHANNEL
-	has := (perms & VIEW_CHANNEL) != 0
-	if has {
-		fmt.Printf("  ✅ 最终权限: %s\n", ch.Name)
-		// fmt.Printf("  ✅ 最终权限: 有 VIEW_CHANNEL (perms=%064b)\n", perms)
-	} else {
-		// fmt.Printf("  ❌ 最终权限: 无 VIEW_CHANNEL (perms=%064b)\n", perms)
+	if err := json.NewDecoder(resp.Body).Decode(&guild); err != nil {
+		return "", err
 	}
-	return has
+	return guild.OwnerID, nil
 }
 
-// 获取某个公会中用户可读的频道集合（传入 userID）
-// 这里使用 channelReadableByUser（复杂计算，不调用 /permissions/@me）
-func getUserAccessibleChannels(token, guildID, userID string) (map[string]bool, error) {
+// 获取某个公会中用户在每个频道的完整权限位（传入 userID）
+// 本地按 Discord 规则计算（见 discord/permissions.go），不调用 /permissions/@me
+func getUserChannelPermissions(token, guildID, userID string) (map[string]uint64, error) {
 	client := getClient()
-	discordUrl := fmt.Sprintf("https://discord.com/api/v9/guilds/%s/channels", guildID)
+	discordUrl := fmt.Sprintf("%s/guilds/%s/channels", discord.APIBase, guildID)
 	req, _ := http.NewRequest("GET", discordUrl, nil)
 	req.Header.Set("Authorization", token)
 	resp, err := client.Do(req)
@@ -174,58 +159,177 @@ func getUserAccessibleChannels(token, guildID, userID string) (map[string]bool,
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		// body, _ := io.ReadAll(resp.Body)
-		// fmt.Printf("DBG channels body on error: %s\n", string(body))
 		return nil, fmt.Errorf("failed to fetch channels, status: %d", resp.StatusCode)
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	// 可选择打印完整 body 供调试（production 可注释）
-	// fmt.Println("DBG channels body:", string(body))
-
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 	var channels []DiscordChannel
 	if err := json.Unmarshal(body, &channels); err != nil {
+		return nil, fmt.Errorf("failed to decode channels: %w", err)
 	}
 
-	// 获取用户角色与 guild 角色权限映射
-	userRoles, err := getUserRolesInGuild(token, guildID, userID)
+	// 获取用户角色、guild 角色权限映射和所有者（按 @everyone 计算时没有其他身份组）
+	var userRoles []string
+	if userID != everyoneSubject {
+		if userRoles, err = getUserRolesInGuild(token, guildID, userID); err != nil {
+			// 无法拿到 member 信息时，保守处理为不可读，并打印原因
+			slog.Warn("获取成员身份组失败", "guild", guildID, logKeyUserID, userID, logKeyErr, err)
+			return nil, err
+		}
+	}
+	rolePerms, err := getGuildRolesPermsWithCache(token, guildID)
 	if err != nil {
-		// 无法拿到 member 信息时，保守处理为不可读，并打印原因
-		fmt.Printf("⚠️ getUserRolesInGuild failed: %v\n", err)
+		slog.Warn("获取公会角色权限失败", "guild", guildID, logKeyErr, err)
 		return nil, err
 	}
-	rolePerms, err := getGuildRolesPermsWithCache(token, guildID)
+	ownerID, err := getGuildOwnerWithCache(token, guildID)
 	if err != nil {
-		fmt.Printf("⚠️ getGuildRolesPermsWithCache failed: %v\n", err)
+		slog.Warn("获取公会所有者失败", "guild", guildID, logKeyErr, err)
 		return nil, err
 	}
 
-	basePerm := computeBasePerm(userRoles, rolePerms)
-	perms := basePerm
+	sub := discord.PermissionSubject{GuildID: guildID, OwnerID: ownerID, UserID: userID, Roles: userRoles, RolePerms: rolePerms}
+	base := discord.BasePermissions(sub)
 
-	accessible := make(map[string]bool)
+	perms := make(map[string]uint64)
 	for _, ch := range channels {
 		// 只处理当前目标 guild 的频道
-		if ch.GuildID != guildID {
+		if ch.GuildID != "" && ch.GuildID != guildID {
 			continue
 		}
-		//fmt.Printf("🔐 计算 user %s, channel %s:%s in guild %s\n", userID, ch.ID, ch.Name, guildID)
-		if channelReadableByUser(ch, userRoles, perms, guildID, userID) {
-			accessible[ch.ID] = true
+		p, err := discord.ChannelPermissions(base, ch, sub)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", ch.ID, err)
+		}
+		perms[ch.ID] = p
+	}
+	return perms, nil
+}
+
+// 获取某个公会中用户可读（VIEW_CHANNEL + READ_MESSAGE_HISTORY）的频道集合
+func getUserAccessibleChannels(token, guildID, userID string) (map[string]bool, error) {
+	perms, err := getUserChannelPermissions(token, guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessible := make(map[string]bool)
+	for id, p := range perms {
+		if discord.CanReadHistory(p) {
+			accessible[id] = true
+		}
+	}
+
+	// 每个月份是一个帖子(子区)，不在频道列表中，按父频道权限 + 私密子区成员身份单独计算
+	if err := ensurePostList(); err != nil {
+		return nil, err
+	}
+	for _, cfg := range getPostList() {
+		if communityOf(cfg.FileName).GuildID != guildID {
+			continue
+		}
+		ok, err := threadReadableByUser(token, cfg.PostID, userID, perms)
+		if err != nil {
+			slog.Warn("帖子权限计算失败", logKeyFile, cfg.FileName, logKeyPost, cfg.PostID, logKeyUserID, userID, logKeyErr, err)
+			continue
+		}
+		if ok {
+			accessible[cfg.PostID] = true
 		}
 	}
 	return accessible, nil
 }
 
-// getUserAllAccessibleChannels: 遍历用户加入的 guild（如果你只关注特定 GuildID 上的频道，可优化为只处理 GuildID）
-func getUserAllAccessibleChannels(token, userID string) (map[string]bool, error) {
-	// 先查看缓存
-	if cached, found := getPermissionFromCache(userID, GuildID); found {
-		return cached, nil
+// threadReadableByUser 判断用户能否查看帖子(子区)；channelPerms 为用户在公会各频道的权限
+func threadReadableByUser(token, threadID, userID string, channelPerms map[string]uint64) (bool, error) {
+	thread, err := getThreadChannelWithCache(token, threadID)
+	if err != nil || thread == nil {
+		return false, err
+	}
+	if !discord.IsThread(thread.Type) {
+		// 配置的是普通频道，直接使用频道权限
+		return discord.CanReadHistory(channelPerms[thread.ID]), nil
+	}
+	parent := channelPerms[thread.ParentID]
+	isMember := false
+	if userID != everyoneSubject && thread.Type == discord.ChannelTypePrivateThread && discord.CanView(parent) && parent&discord.PermManageThreads == 0 {
+		if isMember, err = isThreadMember(token, threadID, userID); err != nil {
+			return false, err
+		}
 	}
+	return discord.CanReadHistory(discord.ThreadPermissions(parent, *thread, isMember)), nil
+}
 
+// 获取帖子(子区)频道对象；无权访问或已被删除时返回 nil
+func getThreadChannel(token, threadID string) (*DiscordChannel, error) {
 	client := getClient()
-	url := "https://discord.com/api/v9/users/@me/guilds?limit=200"
+	url := fmt.Sprintf("%s/channels/%s", discord.APIBase, threadID)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 403, 404:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("get channel failed: %d", resp.StatusCode)
+	}
+
+	var ch DiscordChannel
+	if err := json.NewDecoder(resp.Body).Decode(&ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// 用户是否是子区成员
+func isThreadMember(token, threadID, userID string) (bool, error) {
+	client := getClient()
+	url := fmt.Sprintf("%s/channels/%s/thread-members/%s", discord.APIBase, threadID, userID)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 403, 404:
+		return false, nil
+	}
+	return false, fmt.Errorf("get thread member failed: %d", resp.StatusCode)
+}
+
+// getJoinedGuilds 返回 guildIDs 中用户已加入的公会。
+// 使用 Bot Token 时 /users/@me/guilds 列出的是 Bot 所在的公会，只能逐个查询用户的成员信息（404 表示不是成员）；
+// 使用用户自己的 Token 时直接读取其公会列表
+func getJoinedGuilds(token, userID string, guildIDs []string) (map[string]bool, error) {
+	joined := make(map[string]bool, len(guildIDs))
+	if bot := getBotAuthorization(); bot != "" && token == bot {
+		for _, gid := range guildIDs {
+			ok, err := isGuildMember(token, gid, userID)
+			if err != nil {
+				return nil, err
+			}
+			joined[gid] = ok
+		}
+		return joined, nil
+	}
+
+	client := getClient()
+	url := discord.APIBase + "/users/@me/guilds?limit=200"
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Authorization", token)
 	resp, err := client.Do(req)
@@ -243,63 +347,302 @@ func getUserAllAccessibleChannels(token, userID string) (map[string]bool, error)
 	if err := json.NewDecoder(resp.Body).Decode(&guilds); err != nil {
 		return nil, err
 	}
+	for _, g := range guilds {
+		joined[g.ID] = true
+	}
+	return joined, nil
+}
+
+// isGuildMember 检查用户是否是公会成员（需要 Bot 在该公会中）
+func isGuildMember(token, guildID, userID string) (bool, error) {
+	client := getClient()
+	url := fmt.Sprintf("%s/guilds/%s/members/%s", discord.APIBase, guildID, userID)
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	}
+	return false, fmt.Errorf("get member failed: %d", resp.StatusCode)
+}
+
+// getUserAllAccessibleChannels: 遍历各社区所在的 guild，合并用户在其中可读的频道和帖子（按 guild 缓存）
+func getUserAllAccessibleChannels(token, userID string) (map[string]bool, error) {
+	var guildIDs []string
+	for _, c := range getCommunities() {
+		if !slices.Contains(guildIDs, c.GuildID) {
+			guildIDs = append(guildIDs, c.GuildID)
+		}
+	}
 
+	// 先查看缓存，全部命中时不再请求接口
 	allAccessible := make(map[string]bool)
-	for _, g := range guilds {
-		if g.ID != GuildID {
+	var missing []string
+	for _, gid := range guildIDs {
+		cached, found := getPermissionFromCache(userID, gid)
+		if !found {
+			missing = append(missing, gid)
 			continue
 		}
-		chs, err := getUserAccessibleChannels(token, g.ID, userID)
-		if err == nil {
-			for cid := range chs {
-				allAccessible[cid] = true
-			}
-		} else {
-			fmt.Printf("⚠️ getUserAccessibleChannels failed for guild %s: %v\n", g.ID, err)
+		for cid := range cached {
+			allAccessible[cid] = true
+		}
+	}
+	if len(missing) == 0 {
+		return allAccessible, nil
+	}
+
+	joined := make(map[string]bool, len(missing))
+	if userID == everyoneSubject {
+		for _, gid := range missing {
+			joined[gid] = true // @everyone 不需要确认成员身份
+		}
+	} else {
+		var err error
+		if joined, err = getJoinedGuilds(token, userID, missing); err != nil {
+			return nil, err
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 
-	// 保存到缓存
-	setPermissionCache(userID, GuildID, allAccessible)
+	for _, gid := range missing {
+		chs := make(map[string]bool)
+		if joined[gid] {
+			var err error
+			if chs, err = getUserAccessibleChannels(token, gid, userID); err != nil {
+				slog.Warn("计算可访问频道失败", "guild", gid, logKeyUserID, userID, logKeyErr, err)
+				chs = make(map[string]bool)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		for cid := range chs {
+			allAccessible[cid] = true
+		}
+		// 保存到缓存（不是成员的 guild 也缓存为空集合）
+		setPermissionCache(userID, gid, chs)
+	}
 
 	return allAccessible, nil
 }
 
+// 访客不是 Discord 成员，按只有 @everyone 身份组的成员计算权限（私密子区和限定身份组的频道都不可见）
+const everyoneSubject = ""
+
+// permissionSubject 返回计算用户可查看频道时使用的 Token 和用户 ID；token 为空表示无法计算
+// （OAuth 登录的会话不带 Token，需要 bot_token；访客只能用 bot_token 按 @everyone 计算）
+func permissionSubject(user *UserSession) (token, userID string) {
+	if isGuest(user) {
+		return getBotAuthorization(), everyoneSubject
+	}
+	return discordToken(user), user.UserID
+}
+
+// userAccessibleChannels 返回用户可读的频道和帖子，无法计算权限时返回 nil
+func userAccessibleChannels(user *UserSession) map[string]bool {
+	token, subject := permissionSubject(user)
+	if token == "" {
+		slog.Debug("未配置 bot_token，无法计算用户权限", userAttrs(user))
+		return nil
+	}
+	accessible, err := getUserAllAccessibleChannels(token, subject)
+	if err != nil {
+		slog.Warn("权限获取失败", userAttrs(user), logKeyErr, err)
+		return nil
+	}
+	return accessible
+}
+
+// userCommunities 返回用户能进入的社区（能查看社区的入口频道），无法计算权限时不开放任何社区。
+// OAuth 用户、访客和 API Key 还限于会话中记录的社区（登录时确认的成员身份 / 邀请和账号配置的社区 / Key 配置的社区）
+func userCommunities(user *UserSession) []CommunityConfig {
+	if user == nil {
+		return nil
+	}
+	accessible := userAccessibleChannels(user)
+	restricted := user.Auth == AuthOAuth || user.Auth == AuthGuest || user.Auth == AuthAPIKey
+	var out []CommunityConfig
+	for _, c := range getCommunities() {
+		if accessible[c.ChannelID] && (!restricted || slices.Contains(user.Communities, c.ID)) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// visiblePosts 返回用户可查看的月份：所属社区可进入，且对该帖子有查看权限
+func visiblePosts(user *UserSession) []PostConfig {
+	communities := userCommunities(user)
+	if len(communities) == 0 {
+		return nil
+	}
+	accessible := userAccessibleChannels(user) // 已在 userCommunities 中计算并缓存
+	var visible []PostConfig
+	for _, cfg := range getPostList() {
+		id := communityOf(cfg.FileName).ID
+		if !slices.ContainsFunc(communities, func(c CommunityConfig) bool { return c.ID == id }) {
+			continue
+		}
+		if !accessible[cfg.PostID] {
+			continue
+		}
+		visible = append(visible, cfg)
+	}
+	return visible
+}
+
+// canViewPost 返回用户可查看的月份配置；不存在或无权查看时 ok 为 false
+func canViewPost(user *UserSession, file string) (PostConfig, bool) {
+	for _, cfg := range visiblePosts(user) {
+		if cfg.FileName == file {
+			return cfg, true
+		}
+	}
+	return PostConfig{}, false
+}
+
+// hasCommunityAccess 检查用户能否进入至少一个社区
+func hasCommunityAccess(user *UserSession) bool {
+	return len(userCommunities(user)) > 0
+}
+
 // ==========================================
 // 服务层 (Service & Logic)
 // ==========================================
 
-// 初始化加载
-func initService() {
-	// 加载代理
+// 加载代理 (proxy.txt)
+func loadProxy() {
 	if content, err := os.ReadFile("proxy.txt"); err == nil {
 		ProxyURL = strings.TrimSpace(string(content))
 	}
-	// 加载数据
+}
+
+// applyAPIBase 设置 Discord API 前缀，优先级：命令行参数 > 环境变量 DISCORD_API_BASE > server_config.json
+func applyAPIBase(flagValue string) {
+	base := flagValue
+	if base == "" {
+		base = os.Getenv("DISCORD_API_BASE")
+	}
+	if base == "" {
+		base = getServerConfig().APIBase
+	}
+	discord.SetAPIBase(base)
+	if discord.APIBase != discord.DefaultAPIBase {
+		slog.Info("使用自定义 Discord API 地址", "api_base", discord.APIBase)
+	}
+}
+
+// 初始化加载
+func initService() {
+	loadProxy()
+	// 加载服务端配置
+	err := loadServerConfig()
+	if err != nil {
+		slog.Error("加载服务端配置失败", logKeyErr, err)
+	}
+	recordConfigLoad(err)
+	if err := setupLogging(getServerConfig().Log); err != nil {
+		slog.Error("日志配置无效，使用默认日志", logKeyErr, err)
+	}
+	// 加载高亮规则并监听文件变化
+	loadAllHighlightRules()
+	go watchHighlightRules()
+	// 加载频道配置和数据
+	if err := ensurePostList(); err != nil {
+		slog.Error("获取频道配置失败", logKeyErr, err)
+	}
 	count := 0
-	dynamicPostListMu.RLock()
-	for _, cfg := range dynamicPostList {
-		path := "data/" + cfg.FileName
-		bytes, err := embeddedFiles.ReadFile(path)
+	for _, cfg := range getPostList() {
+		msgs, err := loadArchiveFile(cfg.FileName)
+		recordArchiveLoad(cfg.FileName, err)
 		if err != nil {
 			continue
 		}
-		var msgs []DiscordMessage
-		if err := json.Unmarshal(bytes, &msgs); err == nil {
-			sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
-			memoryStore[cfg.FileName] = msgs
-			count++
+		storeMu.Lock()
+		setStoredMessages(cfg.FileName, msgs)
+		storeMu.Unlock()
+		count++
+	}
+	markStartupDone()
+	slog.Info("已加载数据文件", "count", count)
+}
+
+// loadArchiveFile 优先读取磁盘上 DataDir 中的存档（抓取脚本的输出），不存在时读取内嵌数据
+// 磁盘上的存档损坏且没有内嵌数据时返回磁盘的错误，便于就绪检查区分「损坏」和「尚未同步」
+func loadArchiveFile(fileName string) ([]DiscordMessage, error) {
+	msgs, diskErr := discord.LoadArchive(filepath.Join(DataDir, fileName))
+	if diskErr == nil {
+		return msgs, nil
+	} else if !os.IsNotExist(diskErr) {
+		slog.Warn("读取存档失败，尝试读取内嵌数据", logKeyFile, fileName, logKeyErr, diskErr)
+	}
+	bytes, err := embeddedFiles.ReadFile("data/" + fileName)
+	if err != nil {
+		if !os.IsNotExist(diskErr) {
+			return nil, diskErr
+		}
+		return nil, err
+	}
+	return discord.ParseArchive(bytes)
+}
+
+// markArchiveDirty 标记某个月份在 memoryStore 中有变化，等待 flushArchives 写回
+func markArchiveDirty(file string) {
+	dirtyArchivesMu.Lock()
+	defer dirtyArchivesMu.Unlock()
+	dirtyArchives[file] = true
+}
+
+// flushArchives 把有变化的月份写回 data/ 目录，返回写入失败的个数（失败的留到下次重试）
+func flushArchives() int {
+	dirtyArchivesMu.Lock()
+	files := dirtyArchives
+	dirtyArchives = make(map[string]bool)
+	dirtyArchivesMu.Unlock()
+
+	failed := 0
+	for file := range files {
+		msgs := getStoredMessages(file)
+		path := filepath.Join(DataDir, file) // 其他社区的文件名带 "<id>/" 前缀，即 data/<id>/ 下
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = discord.SaveArchive(path, msgs)
+		}
+		if err != nil {
+			slog.Error("写回存档失败", logKeyFile, file, logKeyErr, err)
+			markArchiveDirty(file)
+			failed++
+		}
+	}
+	return failed
+}
+
+// flushArchivesLoop 定期把修改过的月份写回磁盘（实时模式的更新、上次写入失败需要重试的月份），
+// ctx 取消时停止（退出前由 shutdown 再写一次）
+func flushArchivesLoop(ctx context.Context) {
+	t := time.NewTicker(archiveFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			flushArchives()
 		}
 	}
-	dynamicPostListMu.RUnlock()
-	fmt.Printf("📦 已加载 %d 个数据文件\n", count)
 }
 
 // 验证Token并获取用户信息
 func verifyToken(token string) (*UserSession, error) {
 	client := getClient()
-	req, _ := http.NewRequest("GET", "https://discord.com/api/v9/users/@me", nil)
+	req, _ := http.NewRequest("GET", discord.APIBase+"/users/@me", nil)
 	req.Header.Set("Authorization", token)
 
 	resp, err := client.Do(req)
@@ -321,184 +664,162 @@ func verifyToken(token string) (*UserSession, error) {
 	return &user, nil
 }
 
-// 抓取消息逻辑
+// 抓取消息逻辑（sinceID 为空时抓取全部历史）
 func fetchNewMessages(token, chanID, sinceID string) ([]DiscordMessage, error) {
-	client := getClient()
-	messageMap := make(map[string]DiscordMessage) // 用于去重
-
-	// 辅助函数：在一个消息批次中找到最小和最大的 ID
-	findMinMaxID := func(msgs []DiscordMessage) (string, string) {
-		if len(msgs) == 0 {
-			return "", ""
-		}
-		minID := msgs[0].ID
-		maxID := msgs[0].ID
-		for _, msg := range msgs {
-			if msg.ID < minID { // Discord snowflake ID 是时间有序的
-				minID = msg.ID
-			}
-			if msg.ID > maxID {
-				maxID = msg.ID
-			}
+	return discord.FetchMessages(getClient(), token, chanID, sinceID)
+}
+
+// fetchBatch 执行单个 Discord API 请求来获取消息批次。
+func fetchBatch(client *http.Client, token, chanID, query string) ([]DiscordMessage, error) {
+	return discord.FetchBatch(client, token, chanID, query)
+}
+
+// 通过消息索引在已加载的存档中查找指定 ID 的消息，只返回 configs 中月份的消息
+func findStoredMessage(msgID string, configs []PostConfig) *ReplyContext {
+	storeMu.Lock()
+	ref, ok := messageIndex[msgID]
+	var msg DiscordMessage
+	if ok {
+		msg = memoryStore[ref.file][ref.index]
+	}
+	storeMu.Unlock()
+	if !ok {
+		return nil
+	}
+	for _, cfg := range configs {
+		if cfg.FileName == ref.file {
+			return &ReplyContext{Message: msg, ChannelID: cfg.PostID, FileName: cfg.FileName}
 		}
-		return minID, maxID
 	}
+	return nil
+}
 
-	if sinceID == "" {
-		// 情况1: 抓取所有消息 (从最新的开始，逐步向过去抓取)
-		// 首先抓取第一批最新消息
-		query := "limit=100"
-		initialBatch, err := fetchBatch(client, token, chanID, query)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch initial batch of messages: %w", err)
+// fetchMessageByID 通过 around 查询单条消息（user token 无法调用单条消息接口）
+// 返回 nil, nil 表示消息（或频道）不存在；无权访问时返回 403 的 *discord.StatusError，
+// 因为这只说明当前 Token 看不到，不代表消息不存在
+func fetchMessageByID(client *http.Client, token, chanID, msgID string) (*DiscordMessage, error) {
+	batch, err := fetchBatch(client, token, chanID, "limit=1&around="+msgID)
+	if err != nil {
+		var statusErr *discord.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == 404 {
+			return nil, nil
 		}
-		if len(initialBatch) == 0 {
-			return []DiscordMessage{}, nil // 频道中没有消息
+		return nil, err
+	}
+	for _, m := range batch {
+		if m.ID == msgID {
+			return &m, nil
 		}
+	}
+	return nil, nil
+}
 
-		for _, msg := range initialBatch {
-			messageMap[msg.ID] = msg
+// 跨月份回复查找：先查用户可查看月份的存档，再查询 Discord 接口（结果缓存）
+// 每次渲染最多请求 maxReplyFetches 次接口，避免页面长时间阻塞
+func newReplyResolver(user *UserSession) func(ref MsgRef) *ReplyContext {
+	const maxReplyFetches = 10
+	fetches := 0
+	token := discordToken(user)
+	posts := visiblePosts(user)
+	// 缓存和 Bot Token 都可能包含用户无权查看的消息，只返回用户有权查看的频道中的消息
+	accessible := userAccessibleChannels(user)
+	return func(ref MsgRef) *ReplyContext {
+		if ctx := findStoredMessage(ref.MessageID, posts); ctx != nil {
+			return ctx
 		}
-
-		// 循环向过去抓取 (使用 'before' 参数)
-		currentOldestID, _ := findMinMaxID(initialBatch)
-		for {
-			query = "limit=100&before=" + currentOldestID
-			batch, err := fetchBatch(client, token, chanID, query)
-			if err != nil {
-				log.Printf("Error fetching messages before %s: %v. Continuing with collected messages.", currentOldestID, err)
-				break // 遇到错误，停止并返回已收集的消息
-			}
-			if len(batch) == 0 {
-				break // 没有更旧的消息了
-			}
-
-			newOldestID, _ := findMinMaxID(batch)
-			for _, msg := range batch {
-				messageMap[msg.ID] = msg
-			}
-
-			// 如果最旧的消息ID没有变化，说明已经到达频道的起点
-			if newOldestID == currentOldestID {
-				break
-			}
-			currentOldestID = newOldestID
-			time.Sleep(200 * time.Millisecond) // 尊重 Discord API 速率限制
+		if !accessible[ref.ChannelID] {
+			return nil
 		}
-
-	} else {
-		// 情况2: 抓取比 sinceID 更新的消息 (增量更新)
-		// 从 sinceID 之后开始抓取 (使用 'after' 参数)
-		currentNewestID := sinceID
-		for {
-			query := "limit=100&after=" + currentNewestID
-			batch, err := fetchBatch(client, token, chanID, query)
-			if err != nil {
-				log.Printf("Error fetching messages after %s: %v. Continuing with collected messages.", currentNewestID, err)
-				break // 遇到错误，停止并返回已收集的消息
-			}
-			if len(batch) == 0 {
-				break // 没有更新的消息了
+		if msg, found := getReplyMsgFromCache(ref.MessageID); found {
+			if msg == nil {
+				return nil
 			}
-
-			_, newestIDinBatch := findMinMaxID(batch)
-			for _, msg := range batch {
-				messageMap[msg.ID] = msg
-			}
-
-			// 如果最新消息ID没有变化，说明已经抓取到最新的消息
-			if newestIDinBatch == currentNewestID {
-				break
+			return &ReplyContext{Message: *msg, ChannelID: ref.ChannelID}
+		}
+		if token == "" || ref.ChannelID == "" || fetches >= maxReplyFetches {
+			return nil
+		}
+		fetches++
+		msg, err := fetchMessageByID(getClient(), token, ref.ChannelID, ref.MessageID)
+		if err != nil {
+			// 无权访问不缓存：换一个 Token（或权限变化后）可能就能看到
+			var statusErr *discord.StatusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode == 403 {
+				slog.Debug("无权查询被回复消息", "message", ref.MessageID, "channel", ref.ChannelID)
+				return nil
 			}
-			currentNewestID = newestIDinBatch
-			time.Sleep(200 * time.Millisecond) // 尊重 Discord API 速率限制
+			slog.Warn("查询被回复消息失败", "message", ref.MessageID, "channel", ref.ChannelID, logKeyErr, err)
+			return nil
 		}
+		setReplyMsgCache(ref.MessageID, msg)
+		if msg == nil {
+			return nil
+		}
+		return &ReplyContext{Message: *msg, ChannelID: ref.ChannelID}
 	}
-
-	// 将 map 中的消息转换为切片
-	var result []DiscordMessage
-	for _, msg := range messageMap {
-		result = append(result, msg)
-	}
-
-	// 按 ID 升序排序 (从旧到新)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].ID < result[j].ID
-	})
-
-	return result, nil
 }
 
-// fetchBatch 执行单个 Discord API 请求来获取消息批次。
-func fetchBatch(client *http.Client, token, chanID, query string) ([]DiscordMessage, error) {
-	discordUrl := fmt.Sprintf("https://discord.com/api/v9/channels/%s/messages?%s", chanID, query)
-	req, err := http.NewRequest("GET", discordUrl, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request for %s: %w", discordUrl, err)
-	}
-
-	// 假设传入的 token 已经包含了 "Bot " 前缀（如果它是一个 Bot Token）
-	req.Header.Set("Authorization", token)
-	req.Header.Set("User-Agent", "DiscordArchiveViewer (CustomApp, 1.0)") // 建议设置 User-Agent
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request to %s: %w", discordUrl, err)
+// discordToken 返回代表用户访问 Discord 时使用的 Authorization：配置了 Bot Token 时使用 Bot，否则使用用户自己的 Token。
+// 访客不是 Discord 成员，始终返回空，不会以访客的身份访问 Discord（可查看的频道见 permissionSubject）
+func discordToken(user *UserSession) string {
+	if isGuest(user) {
+		return ""
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body) // 读取响应体以获取更多错误信息
-		return nil, fmt.Errorf("received non-200 status code %d from %s: %s", resp.StatusCode, discordUrl, string(bodyBytes))
+	if bot := getBotAuthorization(); bot != "" {
+		return bot
 	}
-
-	var msgs []DiscordMessage
-	if err := json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
-		return nil, fmt.Errorf("failed to decode messages from %s: %w", discordUrl, err)
+	if user == nil {
+		return ""
 	}
-	return msgs, nil
+	return user.Token
 }
 
 // HTTP Client 工厂
 func getClient() *http.Client {
-	client := &http.Client{Timeout: 30 * time.Second}
-	if ProxyURL != "" {
-		u, err := url.Parse(ProxyURL)
-		if err == nil {
-			client.Transport = &http.Transport{Proxy: http.ProxyURL(u)}
-		}
-	}
-	return client
+	return instrumentClient(discord.NewHTTPClient(ProxyURL))
 }
 
-// 限流检查
-func checkRateLimit() (bool, string) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
+// 读取窗口内的刷新时间戳，调用方需持有 storeMu
+func recentRefreshes(now int64) []int64 {
 	var logData RateLog
 	bytes, err := os.ReadFile(LimitFile)
 	if err == nil {
 		json.Unmarshal(bytes, &logData)
 	}
 
-	now := time.Now().Unix()
 	var validTime []int64
 	for _, ts := range logData.Timestamps {
 		if now-ts < WindowSeconds {
 			validTime = append(validTime, ts)
 		}
 	}
+	return validTime
+}
+
+// 当前窗口内已使用的刷新次数
+func refreshQuotaUsed() int {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	return len(recentRefreshes(time.Now().Unix()))
+}
+
+// 限流检查
+func checkRateLimit() (bool, string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
 
+	now := time.Now().Unix()
+	validTime := recentRefreshes(now)
 	if len(validTime) >= MaxRefreshes {
+		refreshLimited.inc()
 		waitSec := WindowSeconds - (now - validTime[0])
 		return false, fmt.Sprintf("%d小时%d分", waitSec/3600, (waitSec%3600)/60)
 	}
 
 	validTime = append(validTime, now)
-	logData.Timestamps = validTime
-	newBytes, _ := json.Marshal(logData)
-	os.WriteFile(LimitFile, newBytes, 0666)
+	if err := writeJSONFile(LimitFile, RateLog{Timestamps: validTime}); err != nil {
+		slog.Error("写入刷新记录失败", "path", LimitFile, logKeyErr, err)
+	}
 
 	return true, ""
 }
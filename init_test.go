@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+func TestReplyResolverHidesCachedMessagesFromOtherChannels(t *testing.T) {
+	useTestState(t, ServerConfig{}, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	fake := useFakeGuild(t, "111")
+	fake.AddUser(discord.FakeUser{ID: "42", Username: "bob"})
+	// 其他用户之前从 Discord 查到并缓存的消息
+	setReplyMsgCache("m-visible", &DiscordMessage{ID: "m-visible"})
+	setReplyMsgCache("m-hidden", &DiscordMessage{ID: "m-hidden"})
+
+	users := map[string]*UserSession{
+		"guest": {UserID: "invite:alice", Auth: AuthGuest, Communities: []string{""}},
+		"oauth": {UserID: "42", Auth: AuthOAuth, Communities: []string{""}},
+	}
+	for name, user := range users {
+		t.Run(name, func(t *testing.T) {
+			resolve := newReplyResolver(user)
+			if got := resolve(MsgRef{MessageID: "m-hidden", ChannelID: "999"}); got != nil {
+				t.Errorf("resolved message from a channel the user cannot see: %+v", got)
+			}
+			if got := resolve(MsgRef{MessageID: "m-visible", ChannelID: "111"}); got == nil || got.Message.ID != "m-visible" {
+				t.Errorf("resolve visible = %+v, want m-visible", got)
+			}
+		})
+	}
+}
+
+func TestFindStoredMessage(t *testing.T) {
+	jan := PostConfig{FileName: "2025-01.json", PostID: "111"}
+	feb := PostConfig{FileName: "2025-02.json", PostID: "222"}
+	useTestState(t, ServerConfig{}, []PostConfig{jan, feb})
+	storeMu.Lock()
+	setStoredMessages(jan.FileName, testMessages("1", "2"))
+	setStoredMessages(feb.FileName, testMessages("3"))
+	storeMu.Unlock()
+
+	if got := findStoredMessage("2", []PostConfig{jan, feb}); got == nil || got.Message.ID != "2" || got.FileName != jan.FileName || got.ChannelID != "111" {
+		t.Errorf("find 2 = %+v", got)
+	}
+	if got := findStoredMessage("3", []PostConfig{jan}); got != nil {
+		t.Errorf("found message from a month not in the list: %+v", got)
+	}
+	if got := findStoredMessage("4", []PostConfig{jan, feb}); got != nil {
+		t.Errorf("found unknown message: %+v", got)
+	}
+
+	// 重新写入月份后索引随之更新：删除的消息找不到，下标变化后仍返回正确的消息
+	storeMu.Lock()
+	setStoredMessages(jan.FileName, testMessages("0", "2"))
+	storeMu.Unlock()
+	if got := findStoredMessage("1", []PostConfig{jan, feb}); got != nil {
+		t.Errorf("found removed message: %+v", got)
+	}
+	if got := findStoredMessage("0", []PostConfig{jan}); got == nil || got.Message.ID != "0" {
+		t.Errorf("find 0 = %+v", got)
+	}
+	if got := findStoredMessage("2", []PostConfig{jan}); got == nil || got.Message.ID != "2" {
+		t.Errorf("find 2 after rewrite = %+v", got)
+	}
+}
+
+// 使用 Bot Token 时按成员信息判断用户是否在公会中，而不是读取 Bot 自己的公会列表
+func TestBotTokenChecksUserMembership(t *testing.T) {
+	cfg := ServerConfig{BotToken: "bot-secret", Communities: []CommunityConfig{{GuildID: "100", ChannelID: "110"}}}
+	useTestState(t, cfg, nil)
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: "Bot bot-secret", ID: "500", Username: "bot"})
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "alice"})
+	fake.AddUser(discord.FakeUser{ID: "3", Username: "outsider", Guest: true})
+	fake.AddChannel(discord.Channel{ID: "110"})
+
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, strings.TrimPrefix(r.URL.Path, "/api/v9"))
+		mu.Unlock()
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	discord.SetAPIBase(fake.APIBase(ts.URL))
+	defer discord.SetAPIBase("")
+
+	bot := getBotAuthorization()
+	tests := []struct {
+		userID   string
+		wantSeen bool
+	}{
+		{"1", true},
+		{"3", false},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		paths = nil
+		mu.Unlock()
+		got, err := getUserAllAccessibleChannels(bot, tt.userID)
+		if err != nil {
+			t.Fatalf("user %s: %v", tt.userID, err)
+		}
+		if got["110"] != tt.wantSeen {
+			t.Errorf("user %s: channel visible = %v, want %v", tt.userID, got["110"], tt.wantSeen)
+		}
+		mu.Lock()
+		requested := slices.Clone(paths)
+		mu.Unlock()
+		if slices.Contains(requested, "/users/@me/guilds") {
+			t.Errorf("user %s: bot token listed its own guilds: %v", tt.userID, requested)
+		}
+		if !tt.wantSeen && !slices.Equal(requested, []string{"/guilds/100/members/3"}) {
+			t.Errorf("user %s: requests = %v, want only the member lookup", tt.userID, requested)
+		}
+	}
+}
+
+// 月份是否可见按 Discord 权限计算：入口频道、私密子区都要检查，访客按 @everyone 计算，无法计算时一律不可见
+func TestVisiblePostsRequirePermissions(t *testing.T) {
+	cfg := ServerConfig{Communities: []CommunityConfig{{ChannelID: "120"}}} // 默认社区的入口频道
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}, {FileName: "2025-02.json", PostID: "222"}})
+	fake := useFakeGuild(t, "111")
+	fake.AddChannel(discord.Channel{ID: "222", Type: discord.ChannelTypePrivateThread, ParentID: ChannelID})
+	fake.AddChannel(discord.Channel{ID: "120", Name: "gate", PermissionOverwrites: []discord.PermissionOverwrite{
+		{ID: GuildID, Type: 0, Deny: strconv.Itoa(discord.PermViewChannel)},
+		{ID: "r-member", Type: 0, Allow: strconv.Itoa(discord.PermViewChannel)},
+	}})
+	fake.AddRole(discord.Role{ID: "r-member", Name: "member", Permissions: "0"})
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "alice", Roles: []string{"r-member"}})
+	fake.AddUser(discord.FakeUser{ID: "2", Username: "bob", Roles: []string{"r-member"}})
+	fake.AddUser(discord.FakeUser{ID: "3", Username: "carol"})
+	fake.AddThreadMember("222", "1")
+
+	def := []string{""}
+	tests := []struct {
+		name string
+		user *UserSession
+		want []string
+	}{
+		{"private thread member", &UserSession{UserID: "1", Auth: AuthOAuth, Communities: def}, []string{"2025-01.json", "2025-02.json"}},
+		{"not in private thread", &UserSession{UserID: "2", Auth: AuthOAuth, Communities: def}, []string{"2025-01.json"}},
+		{"cannot read gate channel", &UserSession{UserID: "3", Auth: AuthOAuth, Communities: def}, nil},
+		{"community not granted at login", &UserSession{UserID: "1", Auth: AuthOAuth}, nil},
+		{"guest cannot read gate channel", &UserSession{UserID: "invite:x", Auth: AuthGuest, Communities: def}, nil},
+	}
+	check := func(t *testing.T, user *UserSession, want []string) {
+		t.Helper()
+		var got []string
+		for _, p := range visiblePosts(user) {
+			got = append(got, p.FileName)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("visible = %v, want %v", got, want)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.user, tt.want) })
+	}
+
+	// 入口频道对 @everyone 开放时，访客可以看到公开子区，看不到私密子区
+	clearPermissionCache()
+	serverConfigMu.Lock()
+	serverConfig.Communities = nil
+	serverConfigMu.Unlock()
+	t.Run("guest", func(t *testing.T) {
+		check(t, &UserSession{UserID: "invite:x", Auth: AuthGuest, Communities: def}, []string{"2025-01.json"})
+	})
+
+	// 没有 bot_token 时 OAuth 会话和访客的权限无法计算
+	clearPermissionCache()
+	serverConfigMu.Lock()
+	serverConfig.BotToken = ""
+	serverConfigMu.Unlock()
+	t.Run("no bot token", func(t *testing.T) {
+		check(t, &UserSession{UserID: "1", Auth: AuthOAuth, Communities: def}, nil)
+		check(t, &UserSession{UserID: "invite:x", Auth: AuthGuest, Communities: def}, nil)
+	})
+}
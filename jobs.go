@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 后台同步任务 (Sync Jobs)
+// ==========================================
+
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+
+	finishedJobTTL = time.Hour // 已结束的任务保留多久供页面查询
+)
+
+// 后台同步任务，状态变化时推送给所有 SSE 订阅者
+type syncJob struct {
+	mu     sync.Mutex
+	status SyncJobStatus
+	cancel context.CancelFunc
+	subs   map[chan SyncJobStatus]bool
+	log    *slog.Logger // 带发起请求的 request_id 和任务字段
+}
+
+var (
+	syncJobsMu sync.Mutex
+	syncJobs   = make(map[string]*syncJob)
+	activeJobs = make(map[string]*syncJob) // FileName -> 正在进行的任务，同一月份同时只有一个任务
+)
+
+func (j *syncJob) snapshot() SyncJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// update 修改任务状态并推送给订阅者（订阅者跟不上时丢弃中间进度，只保证最终状态送达）
+func (j *syncJob) update(fn func(s *SyncJobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+	for ch := range j.subs {
+		select {
+		case ch <- j.status:
+		default:
+		}
+	}
+	if j.status.Finished() {
+		for ch := range j.subs {
+			close(ch)
+		}
+		j.subs = nil
+	}
+}
+
+// subscribe 返回状态推送通道；任务已结束时返回 nil
+func (j *syncJob) subscribe() chan SyncJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Finished() {
+		return nil
+	}
+	ch := make(chan SyncJobStatus, 16)
+	j.subs[ch] = true
+	return ch
+}
+
+func (j *syncJob) unsubscribe(ch chan SyncJobStatus) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.subs[ch] {
+		delete(j.subs, ch)
+		close(ch)
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSyncJob 为某个月份启动后台同步任务，任务不依赖发起请求的生命周期；
+// 该月份已有进行中的任务时不再重复抓取，而是把请求者加入该任务并返回它（created=false）；
+// backfill 为 true 时忽略已有存档，从头抓取整个月份；logger 通常是发起请求的 logger，使任务日志带上同一个 request_id。
+// admit 只在需要创建新任务时调用（如扣减刷新次数），与“是否已有任务”的判断在同一把锁内完成，
+// 并发的刷新不会各扣一次；admit 拒绝时返回 nil 和需等待的时间，admit 为 nil 时不限制
+func startSyncJob(logger *slog.Logger, user *UserSession, cfg PostConfig, backfill bool, admit func() (bool, string)) (job *syncJob, created bool, waitTime string) {
+	pruneFinishedJobs()
+
+	// 锁顺序：syncJobsMu 在 storeMu 之前（admit 会获取 storeMu）
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	if job := activeJobs[cfg.FileName]; job != nil {
+		job.attach(user)
+		logger.Info("加入进行中的同步任务", userAttrs(user), logKeyFile, cfg.FileName, logKeyJob, job.status.ID)
+		return job, false, ""
+	}
+	if admit != nil {
+		if ok, wait := admit(); !ok {
+			return nil, false, wait
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id := newJobID()
+	job = &syncJob{
+		status: SyncJobStatus{
+			ID:        id,
+			FileName:  cfg.FileName,
+			PostID:    cfg.PostID,
+			Backfill:  backfill,
+			UserID:    user.UserID,
+			Username:  user.Username,
+			Waiters:   []string{user.UserID},
+			State:     JobRunning,
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+		subs:   make(map[chan SyncJobStatus]bool),
+		log:    logger.With(logKeyJob, id, logKeyFile, cfg.FileName, logKeyPost, cfg.PostID),
+	}
+	syncJobs[job.status.ID] = job
+	activeJobs[cfg.FileName] = job
+
+	go runSyncJob(ctx, job, discordToken(user), cfg)
+	return job, true, ""
+}
+
+// attach 把用户加入等待该任务结果的列表
+func (j *syncJob) attach(user *UserSession) {
+	j.update(func(s *SyncJobStatus) {
+		if !slices.Contains(s.Waiters, user.UserID) {
+			s.Waiters = append(s.Waiters, user.UserID)
+		}
+	})
+}
+
+// detach 把用户移出等待列表，没有人再等待时才真正取消任务；用户不在列表中时返回 false
+func (j *syncJob) detach(userID string) bool {
+	found, empty := false, false
+	j.update(func(s *SyncJobStatus) {
+		if i := slices.Index(s.Waiters, userID); i >= 0 {
+			found = true
+			s.Waiters = slices.Delete(s.Waiters, i, i+1)
+		}
+		empty = len(s.Waiters) == 0
+	})
+	if found && empty {
+		j.cancel()
+	}
+	return found
+}
+
+func runSyncJob(ctx context.Context, job *syncJob, token string, cfg PostConfig) {
+	defer job.cancel()
+	defer finishActiveJob(job)
+	defer auditSyncJob(job)
+	defer observeSyncJob(job)
+
+	storeMu.Lock()
+	existingMsgs := memoryStore[cfg.FileName]
+	storeMu.Unlock()
+
+	// 与原刷新逻辑一致：从已有最早一条之后重新抓取，顺带刷新旧消息的图片 URL；回填时从头抓取
+	sinceID := ""
+	if len(existingMsgs) > 0 && !job.status.Backfill {
+		sinceID = existingMsgs[0].ID
+	}
+	start := time.Now()
+	logger := job.log.With(logKeyUser, job.status.Username, logKeyUserID, job.status.UserID)
+	logger.Info("开始同步", "since", sinceID, "backfill", job.status.Backfill)
+
+	fetcher := &discord.Fetcher{
+		Client: getClient(),
+		Token:  token,
+		Logger: logger,
+		Progress: func(p discord.FetchProgress) {
+			job.update(func(s *SyncJobStatus) { s.Progress = p })
+		},
+	}
+	fetched, err := fetcher.FetchMessages(ctx, cfg.PostID, sinceID)
+
+	var partial *discord.PartialError
+	switch {
+	case errors.Is(err, context.Canceled):
+		logger.Info("同步已取消", logKeyDuration, time.Since(start))
+		job.update(func(s *SyncJobStatus) { s.State = JobCancelled; s.FinishedAt = time.Now() })
+		return
+	case err != nil && !errors.As(err, &partial):
+		logger.Error("同步失败", logKeyErr, err, logKeyDuration, time.Since(start))
+		job.update(func(s *SyncJobStatus) { s.State = JobFailed; s.Error = err.Error(); s.FinishedAt = time.Now() })
+		return
+	}
+
+	storeMu.Lock()
+	merged, added := discord.MergeMessages(memoryStore[cfg.FileName], fetched)
+	setStoredMessages(cfg.FileName, merged)
+	storeMu.Unlock()
+	// 立即写回磁盘，不依赖正常退出；写入失败的月份保持待写回，由定期写回重试
+	markArchiveDirty(cfg.FileName)
+	flushArchives()
+
+	state := JobDone
+	errStr := ""
+	if err != nil {
+		state = JobPartial
+		errStr = err.Error()
+		logger.Warn("同步部分成功", "added", added, "total", len(merged), logKeyErr, err, logKeyDuration, time.Since(start))
+	} else {
+		logger.Info("同步成功", "added", added, "total", len(merged), logKeyDuration, time.Since(start))
+	}
+	job.update(func(s *SyncJobStatus) {
+		s.State = state
+		s.Error = errStr
+		s.Added = added
+		s.Total = len(merged)
+		s.FinishedAt = time.Now()
+	})
+}
+
+// 任务结束后记录审计日志（发起者、结果、新增条数）
+func auditSyncJob(job *syncJob) {
+	s := job.snapshot()
+	detail := "job=" + s.ID
+	if s.Backfill {
+		detail += " backfill"
+	}
+	if s.Error != "" {
+		detail += ": " + s.Error
+	}
+	recordAudit(AuditEntry{UserID: s.UserID, Username: s.Username, Action: AuditSync, Target: s.FileName, Result: s.State, Added: s.Added, Total: s.Total, Detail: detail})
+}
+
+// 任务结束后从 activeJobs 移除，之后同一月份的刷新会创建新任务
+func finishActiveJob(job *syncJob) {
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	if activeJobs[job.status.FileName] == job {
+		delete(activeJobs, job.status.FileName)
+	}
+}
+
+// runningJobCount 返回正在进行的任务数
+func runningJobCount() int {
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	return len(activeJobs)
+}
+
+// waitSyncJobs 等待所有进行中的任务结束（包括写入 memoryStore），ctx 到期时返回 false
+func waitSyncJobs(ctx context.Context) bool {
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for runningJobCount() > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+		}
+	}
+	return true
+}
+
+// cancelSyncJobs 取消所有进行中的任务，返回取消的个数
+func cancelSyncJobs() int {
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	for _, job := range activeJobs {
+		job.cancel()
+	}
+	return len(activeJobs)
+}
+
+func getSyncJob(id string) *syncJob {
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	return syncJobs[id]
+}
+
+// 清理结束超过 finishedJobTTL 的任务
+func pruneFinishedJobs() {
+	syncJobsMu.Lock()
+	defer syncJobsMu.Unlock()
+	for id, job := range syncJobs {
+		s := job.snapshot()
+		if s.Finished() && time.Since(s.FinishedAt) > finishedJobTTL {
+			delete(syncJobs, id)
+		}
+	}
+}
+
+// ---------------- 任务相关接口 ----------------
+
+func registerJobRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /jobs/{id}", authMiddleware(handleJobStatus))
+	mux.HandleFunc("GET /jobs/{id}/events", authMiddleware(handleJobEvents))
+	mux.HandleFunc("POST /jobs/{id}/cancel", authMiddleware(handleJobCancel))
+}
+
+// viewableJob 返回当前用户可查看的任务：等待该任务的用户，或有权查看该月份的用户；
+// 其他情况一律视为不存在，不暴露任务 ID 对应的月份
+func viewableJob(r *http.Request) (*syncJob, *UserSession) {
+	job := getSyncJob(r.PathValue("id"))
+	user := getCurrentUser(r)
+	if job == nil || user == nil {
+		return nil, nil
+	}
+	s := job.snapshot()
+	if slices.Contains(s.Waiters, user.UserID) {
+		return job, user
+	}
+	if _, ok := canViewPost(user, s.FileName); ok {
+		return job, user
+	}
+	return nil, nil
+}
+
+// statusFor 返回给某个用户看的任务状态：等待者列表只对管理员可见
+func statusFor(user *UserSession, s SyncJobStatus) SyncJobStatus {
+	if !hasRole(user, RoleAdmin) {
+		s.Waiters = nil
+	}
+	return s
+}
+
+func handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, user := viewableJob(r)
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, statusFor(user, job.snapshot()))
+}
+
+// 通过 Server-Sent Events 推送任务进度，任务结束后发送 done 事件并关闭连接
+func handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	job, user := viewableJob(r)
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	sentDone := false
+	send := func(s SyncJobStatus) {
+		event := "progress"
+		if s.Finished() {
+			event = "done"
+			sentDone = true
+		}
+		data, _ := json.Marshal(statusFor(user, s))
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+
+	ch := job.subscribe()
+	send(job.snapshot())
+	if ch == nil {
+		return
+	}
+	defer job.unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-serverClosing(r):
+			return
+		case s, ok := <-ch:
+			if !ok {
+				// 通道关闭说明任务已结束；最终状态可能因缓冲区满被丢弃，这里补发一次
+				if !sentDone {
+					send(job.snapshot())
+				}
+				return
+			}
+			send(s)
+		}
+	}
+}
+
+// 取消任务：只有等待该任务的用户可以取消，且所有等待者都取消后任务才真正停止
+func handleJobCancel(w http.ResponseWriter, r *http.Request) {
+	job := getSyncJob(r.PathValue("id"))
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	user := getCurrentUser(r)
+	if user == nil || !job.detach(user.UserID) {
+		writeAPIError(w, http.StatusForbidden, "not waiting on this job")
+		return
+	}
+	auditRequest(r, user, AuditCancel, job.snapshot().FileName, AuditOK, "job="+job.snapshot().ID)
+	writeJSON(w, http.StatusOK, statusFor(user, job.snapshot()))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// addTestJob 直接登记一个已结束的任务，不发起同步
+func addTestJob(t *testing.T, s SyncJobStatus) *syncJob {
+	t.Helper()
+	job := &syncJob{status: s, cancel: func() {}, subs: make(map[chan SyncJobStatus]bool)}
+	syncJobsMu.Lock()
+	syncJobs[s.ID] = job
+	syncJobsMu.Unlock()
+	t.Cleanup(func() {
+		syncJobsMu.Lock()
+		delete(syncJobs, s.ID)
+		syncJobsMu.Unlock()
+	})
+	return job
+}
+
+func TestJobStatusVisibility(t *testing.T) {
+	cfg := ServerConfig{Roles: RolesConfig{Admin: RoleMapping{UserIDs: []string{"9"}}}}
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	fake := useFakeGuild(t, "111")
+	for _, id := range []string{"1", "2", "9"} {
+		fake.AddUser(discord.FakeUser{ID: id, Username: "user" + id})
+	}
+	addTestJob(t, SyncJobStatus{
+		ID: "job1", FileName: "2025-01.json", PostID: "111", UserID: "1",
+		Waiters: []string{"1"}, State: JobDone, StartedAt: time.Now(), FinishedAt: time.Now(),
+	})
+	mux := http.NewServeMux()
+	registerJobRoutes(mux)
+
+	member := []string{""} // 默认社区
+	tests := []struct {
+		name        string
+		user        *UserSession
+		wantCode    int
+		wantWaiters bool
+	}{
+		{"waiter without post access", &UserSession{UserID: "1", Auth: AuthOAuth}, http.StatusOK, false},
+		{"member who can view the month", &UserSession{UserID: "2", Auth: AuthOAuth, Communities: member}, http.StatusOK, false},
+		{"outsider", &UserSession{UserID: "3", Auth: AuthOAuth}, http.StatusNotFound, false},
+		{"guest of another community", &UserSession{UserID: "invite:x", Auth: AuthGuest, Communities: []string{"other"}}, http.StatusNotFound, false},
+		{"admin", &UserSession{UserID: "9", Auth: AuthOAuth, Communities: member}, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/jobs/job1", "/jobs/job1/events"} {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, sessionRequest(t, "GET", path, tt.user))
+				if w.Code != tt.wantCode {
+					t.Fatalf("GET %s = %d, want %d: %s", path, w.Code, tt.wantCode, w.Body)
+				}
+				if w.Code != http.StatusOK {
+					continue
+				}
+				body := w.Body.String()
+				if path == "/jobs/job1/events" {
+					_, body, _ = strings.Cut(body, "data: ")
+				}
+				var s SyncJobStatus
+				if err := json.Unmarshal([]byte(strings.TrimSpace(body)), &s); err != nil {
+					t.Fatalf("GET %s: %v: %s", path, err, body)
+				}
+				if s.ID != "job1" || s.State != JobDone {
+					t.Errorf("GET %s = %+v", path, s)
+				}
+				if got := len(s.Waiters) > 0; got != tt.wantWaiters {
+					t.Errorf("GET %s waiters = %v, want visible=%v", path, s.Waiters, tt.wantWaiters)
+				}
+			}
+		})
+	}
+}
+
+// 同一月份的并发刷新只创建一个任务，刷新次数也只扣一次
+func TestConcurrentRefreshChargesQuotaOnce(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+	discord.SetAPIBase(ts.URL)
+	defer discord.SetAPIBase("")
+
+	var admitted atomic.Int32
+	admit := func() (bool, string) {
+		admitted.Add(1)
+		return true, ""
+	}
+	cfg := PostConfig{FileName: "2025-01.json", PostID: "111"}
+	user := &UserSession{UserID: "1", Token: "t"}
+
+	const n = 20
+	jobs := make([]*syncJob, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			jobs[i], _, _ = startSyncJob(slog.Default(), user, cfg, false, admit)
+		})
+	}
+	wg.Wait()
+	close(release)
+
+	if got := admitted.Load(); got != 1 {
+		t.Errorf("admit called %d times, want 1", got)
+	}
+	for _, job := range jobs {
+		if job != jobs[0] {
+			t.Fatal("concurrent refreshes started separate jobs")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !waitSyncJobs(ctx) {
+		t.Fatal("sync job did not finish")
+	}
+}
+
+func TestRefreshDeniedCreatesNoJob(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	deny := func() (bool, string) { return false, "1小时0分" }
+	job, created, wait := startSyncJob(slog.Default(), &UserSession{UserID: "1"}, PostConfig{FileName: "2025-02.json"}, false, deny)
+	if job != nil || created || wait != "1小时0分" {
+		t.Errorf("startSyncJob = %v, %v, %q; want nil job and wait time", job, created, wait)
+	}
+	if n := runningJobCount(); n != 0 {
+		t.Errorf("%d jobs running after denied refresh", n)
+	}
+}
+
+// 刷新通过 POST 表单提交，查询参数中的 f 不会触发抓取
+func TestRefreshReadsPostForm(t *testing.T) {
+	useTestState(t, ServerConfig{Roles: RolesConfig{Default: RoleViewer}}, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	user := &UserSession{UserID: "1", Username: "alice"}
+
+	r := sessionRequest(t, "POST", "/refresh?f=2025-02.json", user)
+	r.Body = io.NopCloser(strings.NewReader("f=2025-01.json&full=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handleRefresh(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("viewer POST /refresh = %d, want 403", w.Code)
+	}
+	entries, err := readAuditEntries(AuditFilter{Action: AuditDenied, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != "2025-01.json" || !strings.HasPrefix(entries[0].Detail, AuditBackfill) {
+		t.Errorf("denied entry = %+v, want backfill of 2025-01.json from the form body", entries)
+	}
+}
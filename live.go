@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 实时模式：通过 Gateway 接收新消息 (Live Tail)
+// ==========================================
+
+// 推送给浏览器的实时更新
+type liveUpdate struct {
+	File      string `json:"file"`
+	Type      string `json:"type"` // MESSAGE_CREATE / MESSAGE_UPDATE / MESSAGE_DELETE
+	MessageID string `json:"message_id"`
+}
+
+var (
+	liveEnabled   atomic.Bool
+	liveConnected atomic.Bool
+
+	liveSubsMu sync.Mutex
+	liveSubs   = make(map[chan liveUpdate]bool)
+)
+
+// startLiveTail 按 server_config.json 的 live 配置连接 Gateway，ctx 取消时断开；未开启时什么都不做
+func startLiveTail(ctx context.Context) {
+	cfg := getServerConfig().Live
+	if !cfg.Enabled {
+		return
+	}
+	token := cfg.Token
+	if token == "" {
+		token = getBotAuthorization()
+	}
+	if token == "" {
+		token = os.Getenv("DISCORD_TOKEN")
+	}
+	if token == "" {
+		slog.Error("实时模式已开启但未配置 token (live.token、bot_token 或环境变量 DISCORD_TOKEN)")
+		return
+	}
+
+	liveEnabled.Store(true)
+	gw := &discord.Gateway{
+		URL:     cfg.GatewayURL,
+		Token:   token,
+		Proxy:   ProxyURL,
+		Handler: handleGatewayEvent,
+		Status: func(connected bool) {
+			if connected && !liveConnected.Load() {
+				slog.Info("实时模式已连接 Gateway")
+			}
+			liveConnected.Store(connected)
+		},
+	}
+	go gw.Run(ctx)
+}
+
+// 把 Gateway 事件应用到对应月份的 memoryStore，并通知打开的页面
+func handleGatewayEvent(ev discord.GatewayEvent) {
+	file := ""
+	for _, cfg := range getPostList() {
+		if cfg.PostID == ev.ChannelID {
+			file = cfg.FileName
+			break
+		}
+	}
+	if file == "" {
+		return // 不是配置中的帖子
+	}
+
+	storeMu.Lock()
+	msgs := append([]DiscordMessage(nil), memoryStore[file]...)
+	msgs, changed := discord.ApplyGatewayEvent(msgs, ev)
+	if changed {
+		setStoredMessages(file, msgs)
+	}
+	storeMu.Unlock()
+	if !changed {
+		return
+	}
+
+	markArchiveDirty(file)
+	broadcastLiveUpdate(liveUpdate{File: file, Type: ev.Type, MessageID: ev.Message.ID})
+}
+
+func broadcastLiveUpdate(u liveUpdate) {
+	liveSubsMu.Lock()
+	defer liveSubsMu.Unlock()
+	for ch := range liveSubs {
+		select {
+		case ch <- u:
+		default: // 页面处理不过来时丢弃，页面只用来提示有新消息
+		}
+	}
+}
+
+// 通过 SSE 向页面推送实时更新
+func handleLiveEvents(w http.ResponseWriter, r *http.Request) {
+	if !liveEnabled.Load() {
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	// 只推送用户有权查看的月份
+	visible := make(map[string]bool)
+	for _, cfg := range visiblePosts(getCurrentUser(r)) {
+		visible[cfg.FileName] = true
+	}
+
+	ch := make(chan liveUpdate, 32)
+	liveSubsMu.Lock()
+	liveSubs[ch] = true
+	liveSubsMu.Unlock()
+	defer func() {
+		liveSubsMu.Lock()
+		delete(liveSubs, ch)
+		liveSubsMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-serverClosing(r):
+			return
+		case u := <-ch:
+			if !visible[u.File] {
+				continue
+			}
+			data, _ := json.Marshal(u)
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+func TestLiveTailAppliesGatewayEvents(t *testing.T) {
+	fg := discord.NewFakeGateway()
+	ts := httptest.NewServer(fg)
+	defer ts.Close()
+
+	cfg := ServerConfig{Live: LiveConfig{Enabled: true, Token: "live-token", GatewayURL: fg.URL(ts.URL)}}
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	storeMu.Lock()
+	setStoredMessages("2025-01.json", testMessages("1"))
+	storeMu.Unlock()
+	t.Cleanup(func() {
+		liveEnabled.Store(false)
+		liveConnected.Store(false)
+	})
+
+	ch := make(chan liveUpdate, 8)
+	liveSubsMu.Lock()
+	liveSubs[ch] = true
+	liveSubsMu.Unlock()
+	t.Cleanup(func() {
+		liveSubsMu.Lock()
+		delete(liveSubs, ch)
+		liveSubsMu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startLiveTail(ctx)
+	if !liveEnabled.Load() {
+		t.Fatal("live tail not enabled")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fg.Identifies()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("gateway never received IDENTIFY")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := fg.Identifies()[0]; got != "live-token" {
+		t.Errorf("IDENTIFY token = %q", got)
+	}
+
+	// 未配置的频道被忽略，配置中的帖子写入 memoryStore 并通知页面
+	fg.Dispatch(discord.EventMessageCreate, map[string]any{"id": "5", "channel_id": "999", "content": "other"})
+	fg.Dispatch(discord.EventMessageCreate, map[string]any{"id": "2", "channel_id": "111", "content": "new", "author": map[string]string{"id": "1"}})
+
+	select {
+	case u := <-ch:
+		if u.File != "2025-01.json" || u.Type != discord.EventMessageCreate || u.MessageID != "2" {
+			t.Errorf("update = %+v", u)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no live update broadcast")
+	}
+	storeMu.Lock()
+	msgs := memoryStore["2025-01.json"]
+	storeMu.Unlock()
+	if len(msgs) != 2 || msgs[1].ID != "2" || msgs[1].Content != "new" {
+		t.Errorf("memoryStore = %+v", msgs)
+	}
+	if got := findStoredMessage("2", getPostList()); got == nil || got.Message.Content != "new" {
+		t.Errorf("findStoredMessage after live event = %+v", got)
+	}
+	select {
+	case u := <-ch:
+		t.Errorf("unexpected update %+v", u)
+	default:
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// 结构化日志 (log/slog)
+// ==========================================
+
+// 日志中统一使用的字段名
+const (
+	logKeyRequestID = "request_id"
+	logKeyUser      = "user"    // 用户名
+	logKeyUserID    = "user_id" // 用户 ID
+	logKeyFile      = "file"    // 月份文件名
+	logKeyPost      = "post"    // 帖子 ID
+	logKeyJob       = "job"
+	logKeyDuration  = "duration"
+	logKeyErr       = "err"
+)
+
+type (
+	logContextKey       struct{}
+	requestIDContextKey struct{}
+)
+
+// parseLogConfig 解析日志配置：format 为 text（默认）或 json，level 为 debug / info（默认）/ warn / error
+func parseLogConfig(cfg LogConfig) (slog.Level, string, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return level, "", fmt.Errorf("log.level %q 无效: %w", cfg.Level, err)
+		}
+	}
+	format := strings.ToLower(cfg.Format)
+	switch format {
+	case "":
+		format = "text"
+	case "text", "json":
+	default:
+		return level, "", fmt.Errorf("log.format %q 无效，只能是 text 或 json", cfg.Format)
+	}
+	return level, format, nil
+}
+
+// validateLogConfig 检查 server_config.json 中的日志配置
+func validateLogConfig(cfg LogConfig) error {
+	_, _, err := parseLogConfig(cfg)
+	return err
+}
+
+// setupLogging 按配置替换默认 logger，输出到标准错误
+func setupLogging(cfg LogConfig) error {
+	level, format, err := parseLogConfig(cfg)
+	if err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// loggerFrom 返回请求上下文中的 logger（带 request_id），没有时返回默认 logger
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(logContextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// requestIDFrom 返回请求的 request_id（经过 withRequestLogging 时才有）
+func requestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// reqLogger 返回当前请求的 logger
+func reqLogger(r *http.Request) *slog.Logger {
+	return loggerFrom(r.Context())
+}
+
+// userAttrs 用户相关的日志字段
+func userAttrs(user *UserSession) slog.Attr {
+	if user == nil {
+		return slog.Attr{}
+	}
+	return slog.Group("", logKeyUser, user.Username, logKeyUserID, user.UserID)
+}
+
+// requestID 沿用反向代理传入的 X-Request-ID（只接受简单字符），否则生成一个新的
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 64 && !strings.ContainsFunc(id, func(c rune) bool {
+		return !(c == '-' || c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+	}) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder 记录响应状态码；保留 Flush 以支持 SSE
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush 转发给底层 ResponseWriter，SSE 接口依赖它
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// 监控系统频繁轮询的路径，请求日志降为 debug 级别
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// withRequestLogging 为每个请求分配 request_id（写入响应头 X-Request-ID），
+// 把带 request_id 的 logger 放进请求上下文，并在请求结束时记录状态码和耗时
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		logger := slog.Default().With(logKeyRequestID, id)
+		ctx := context.WithValue(r.Context(), logContextKey{}, logger)
+		r = r.WithContext(context.WithValue(ctx, requestIDContextKey{}, id))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		logger.Log(r.Context(), level, "请求完成",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", cmp.Or(rec.status, http.StatusOK),
+			logKeyDuration, time.Since(start),
+			"ip", clientIP(r),
+		)
+	})
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
 )
 
 // ==========================================
@@ -13,61 +16,76 @@ import (
 // ==========================================
 
 func main() {
+	if err := runCommand(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serve 子命令：启动 Web 查看器（不带参数运行时的默认行为）
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	noBrowser := fs.Bool("no-browser", false, "启动后不自动打开浏览器")
+	apiBase := fs.String("api-base", "", "Discord API 地址（默认读取环境变量 DISCORD_API_BASE 或 server_config.json）")
+	record := fs.String("record", "", "把所有 Discord 请求 / 响应录制到该目录（Authorization 会被替换）")
+	replay := fs.String("replay", "", "只从该目录中录制的 fixture 返回响应，不访问网络")
+	shutdownTimeout := fs.Duration("shutdown-timeout", DefaultShutdownTimeout, "退出时等待进行中的请求和同步任务的最长时间，超时后取消")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := applyFixtureFlags(*record, *replay); err != nil {
+		return err
+	}
+
 	initService()
+	applyAPIBase(*apiBase)
+	// 后台任务：实时模式和定期写回存档，退出时在最后一次写回前停止
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	startLiveTail(bgCtx)
+	go flushArchivesLoop(bgCtx)
 
 	// 路由注册
-	http.HandleFunc("/login", handleLogin)                     // 登录页 & 提交
-	http.HandleFunc("/logout", handleLogout)                   // 登出
-	http.HandleFunc("/refresh", authMiddleware(handleRefresh)) // 刷新 (需登录)
-	http.HandleFunc("/", authMiddleware(handleIndex))          // 主页 (需登录)
+	http.HandleFunc("/login", handleLogin)                                // 登录页 & 提交
+	http.HandleFunc("/logout", handleLogout)                              // 登出
+	http.HandleFunc("GET /oauth/login", handleOAuthLogin)                 // 跳转 Discord 授权
+	http.HandleFunc("GET /oauth/callback", handleOAuthCallback)           // Discord 授权回调
+	http.HandleFunc("GET /invite", handleInvite)                          // 访客邀请链接
+	http.HandleFunc("/prefs", authMiddleware(handlePrefs))                // 查看偏好 (需登录)
+	http.HandleFunc("POST /refresh", authMiddleware(handleRefresh))       // 刷新 (需登录)
+	http.HandleFunc("/", authMiddleware(handleIndex))                     // 主页 (需登录)
+	registerAPIRoutes(http.DefaultServeMux)                               // 只读 JSON API (Session 或 API Key)
+	registerJobRoutes(http.DefaultServeMux)                               // 后台同步任务进度 / 取消 (需登录)
+	registerAdminRoutes(http.DefaultServeMux)                             // 管理页 (admin 角色)
+	http.HandleFunc("GET /live/events", authMiddleware(handleLiveEvents)) // 实时模式推送 (需登录)
+	http.HandleFunc("GET /metrics", handleMetrics)                        // 运行指标 (Prometheus 格式)
+	http.HandleFunc("GET /healthz", handleHealthz)                        // 存活检查
+	http.HandleFunc("GET /readyz", handleReadyz)                          // 就绪检查 (配置、数据目录、存档、Discord)
 
 	link := "http://localhost:" + Port
-	fmt.Println("-------------------------------------------")
-	fmt.Println("✅ 聊天存档查看器已启动")
-	fmt.Printf("👉 请访问: %s\n", link)
-	fmt.Println("-------------------------------------------")
+	slog.Info("聊天存档查看器已启动", "url", link)
 
-	openBrowser(link)
-	log.Fatal(http.ListenAndServe(":"+Port, nil))
+	if !*noBrowser {
+		openBrowser(link)
+	}
+	srv := &http.Server{Addr: ":" + Port, Handler: withRequestLogging(withMetrics(http.DefaultServeMux))}
+	return serveUntilSignal(srv, *shutdownTimeout, stopBackground)
 }
 
 // 中间件：验证登录状态
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(CookieName)
-		if err != nil || cookie.Value == "" {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		// 简单解码 Session (实际生产环境应加密)
-		jsonBytes, err := base64.StdEncoding.DecodeString(cookie.Value)
-		if err != nil {
+		if getCurrentUser(r) == nil {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		var session UserSession
-		if err := json.Unmarshal(jsonBytes, &session); err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if err := ensurePostList(); err != nil {
+			reqLogger(r).Error("获取频道配置失败", logKeyErr, err)
+			renderLogin(w, "获取频道配置失败")
 			return
 		}
 
-		if len(dynamicPostList) == 0 {
-			currentUser := getCurrentUser(r)
-			fmt.Printf("🔄 用户 [%s] 鉴权成功，开始从接口获取频道配置...\n", currentUser.Username)
-			configs, fetchConfigErr := fetchPostConfigurations() // 假设接口需要 token
-			if fetchConfigErr != nil {
-				log.Printf("❌ 获取频道配置失败: %v\n", fetchConfigErr)
-				renderLogin(w, "获取频道配置失败")
-				return
-			}
-
-			// 成功获取后，更新全局的 dynamicPostList
-			dynamicPostList = configs
-			fmt.Printf("✅ 成功获取 %d 个频道配置，开始预加载消息...\n", len(configs))
-		}
-
 		next(w, r)
 	}
 }
@@ -75,48 +93,71 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 // 获取当前用户 helper
 func getCurrentUser(r *http.Request) *UserSession {
 	cookie, err := r.Cookie(CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	user, err := decodeSession(cookie.Value)
 	if err != nil {
 		return nil
 	}
-	bytes, _ := base64.StdEncoding.DecodeString(cookie.Value)
-	var user UserSession
-	json.Unmarshal(bytes, &user)
-	return &user
+	if isGuest(user) && !guestSessionValid(user) {
+		return nil
+	}
+	return user
 }
 
 func handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
-		token := r.FormValue("token")
-		user, err := verifyToken(token)
+		var user *UserSession
+		var err error
+		method := "token"
+		username := r.FormValue("username")
+		if username != "" {
+			// 只读访客账号
+			method = "guest_account"
+			user, err = guestAccountLogin(username, r.FormValue("password"))
+		} else {
+			user, err = verifyToken(r.FormValue("token"))
+		}
 		if err != nil {
+			reqLogger(r).Warn("登录失败", "method", method, logKeyUser, username, logKeyErr, err)
+			auditRequest(r, &UserSession{Username: username}, AuditLogin, "", AuditFailed, method+": "+err.Error())
 			renderLogin(w, err.Error())
 			return
 		}
 
+		if !isGuest(user) {
+			user.Roles = collectDiscordRoles(discordToken(user), user.UserID)
+		}
+
+		// 服务端配置了 Bot Token 时，个人 Token 只用于确认身份，不写入 Session
+		if getBotAuthorization() != "" {
+			user.Token = ""
+		}
+
 		// 创建 Session
-		sessionBytes, _ := json.Marshal(user)
-		encoded := base64.StdEncoding.EncodeToString(sessionBytes)
+		if err := setSessionCookie(w, user); err != nil {
+			renderLogin(w, "创建会话失败")
+			return
+		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     CookieName,
-			Value:    encoded,
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   3600 * 24 * 30, // 30天
-		})
+		auditRequest(r, user, AuditLogin, "", AuditOK, method)
 
 		// --- 在登录时预加载所有频道的历史消息 ---
-		fmt.Printf("🔄 用户 [%s] 登录成功，开始从接口获取频道配置...\n", user.Username)
+		logger := reqLogger(r).With(userAttrs(user))
+		logger.Info("登录成功", "method", method)
 		configs, fetchConfigErr := fetchPostConfigurations() // 假设接口需要 token
 		if fetchConfigErr != nil {
-			log.Printf("❌ 获取频道配置失败: %v\n", fetchConfigErr)
+			logger.Error("获取频道配置失败", logKeyErr, fetchConfigErr)
 			renderLogin(w, "获取频道配置失败")
 			return
 		}
 
 		// 成功获取后，更新全局的 dynamicPostList
+		dynamicPostListMu.Lock()
 		dynamicPostList = configs
-		fmt.Printf("✅ 成功获取 %d 个频道配置，开始预加载消息...\n", len(configs))
+		dynamicPostListMu.Unlock()
+		logger.Info("已获取频道配置", "count", len(configs))
 		//for _, cfg := range ChannelList {
 		//	// 调用 fetchNewMessages 获取特定 PostID 的所有历史消息。
 		//	// 假设 fetchNewMessages 的第二个参数是 PostID，第三个参数 sinceID 为空字符串表示获取所有历史消息。
@@ -141,6 +182,9 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if user := getCurrentUser(r); user != nil {
+		auditRequest(r, user, AuditLogout, "", AuditOK, "")
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:   CookieName,
 		Value:  "",
@@ -150,6 +194,64 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// 读取用户的查看偏好
+func getViewPrefs(r *http.Request) ViewPrefs {
+	var prefs ViewPrefs
+	cookie, err := r.Cookie(PrefsCookie)
+	if err != nil {
+		return prefs
+	}
+	values, _ := url.ParseQuery(cookie.Value)
+	prefs.NoMerge = values.Get("merge") == "off"
+	prefs.Tree = values.Get("mode") == "tree"
+	return prefs
+}
+
+// 保存查看偏好，例如 /prefs?merge=off&mode=tree&f=2025-12.json
+func handlePrefs(w http.ResponseWriter, r *http.Request) {
+	prefs := getViewPrefs(r)
+	if v := r.URL.Query().Get("merge"); v != "" {
+		prefs.NoMerge = v == "off"
+	}
+	if v := r.URL.Query().Get("mode"); v != "" {
+		prefs.Tree = v == "tree"
+	}
+
+	values := url.Values{}
+	if prefs.NoMerge {
+		values.Set("merge", "off")
+	}
+	if prefs.Tree {
+		values.Set("mode", "tree")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     PrefsCookie,
+		Value:    values.Encode(),
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   3600 * 24 * 365,
+	})
+	http.Redirect(w, r, "/?f="+url.QueryEscape(r.URL.Query().Get("f")), http.StatusSeeOther)
+}
+
+// 根据帖子配置和用户偏好生成视图选项
+func viewOptionsFor(cfg PostConfig, prefs ViewPrefs) ViewOptions {
+	community := communityOf(cfg.FileName)
+	opts := ViewOptions{
+		PostID:      cfg.PostID,
+		GuildID:     community.GuildID,
+		RulesFile:   community.HighlightRules,
+		MergeWindow: getMergeWindow(),
+		Tree:        prefs.Tree,
+		MaxDepth:    getTreeMaxDepth(),
+	}
+	if prefs.NoMerge {
+		opts.MergeWindow = 0
+	}
+	opts.AuthorRoles = authorRolesResolver(community.HighlightRules, community.GuildID)
+	return opts
+}
+
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 	currentUser := getCurrentUser(r)
 	if currentUser == nil {
@@ -157,56 +259,68 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取用户可访问的所有频道
-	fmt.Printf("🔐 正在获取用户 [%s] 的频道权限...\n", currentUser.Username)
-	accessibleChannels, err := getUserAllAccessibleChannels(currentUser.Token, currentUser.UserID)
-	if err != nil {
-		fmt.Printf("⚠️  权限获取失败: %v\n", err)
-		accessibleChannels = make(map[string]bool)
-	}
-
 	// 检查用户是否有权访问此频道
-	if !accessibleChannels[ChannelID] {
-		fmt.Printf("⛔ 用户 [%s] 无权访问频道\n", currentUser.Username)
+	logger := reqLogger(r).With(userAttrs(currentUser))
+	logger.Debug("正在获取用户的频道权限")
+	if !hasCommunityAccess(currentUser) {
+		logger.Warn("用户无权访问频道")
 		renderLogin(w, "无权访问频道")
 		return
 	}
 
+	// 只显示用户有权查看的月份（每个月份是一个帖子，可能有各自的权限）
+	posts := visiblePosts(currentUser)
 	activeFile := r.URL.Query().Get("f")
-	if activeFile == "" && len(dynamicPostList) > 0 {
-		activeFile = dynamicPostList[0].FileName
+	if activeFile == "" && len(posts) > 0 {
+		activeFile = posts[0].FileName
+	}
+	if activeFile != "" && !slices.ContainsFunc(posts, func(cfg PostConfig) bool { return cfg.FileName == activeFile }) {
+		http.Error(w, "无权查看该月份", http.StatusForbidden)
+		return
 	}
 
-	var navItems []NavItem
-	dynamicPostListMu.RLock()
-	for _, cfg := range dynamicPostList {
-		msgs, exists := memoryStore[cfg.FileName]
-		count := "0"
-		if exists {
-			count = fmt.Sprintf("%d", len(msgs))
+	// 侧边栏按社区分组，只列出有可见月份的社区
+	var navGroups []NavGroup
+	for _, c := range getCommunities() {
+		group := NavGroup{Name: c.Name}
+		for _, cfg := range posts {
+			if communityOf(cfg.FileName).ID != c.ID {
+				continue
+			}
+			group.Items = append(group.Items, NavItem{
+				MonthStr: cfg.MonthStr,
+				Title:    cfg.Title,
+				SubTitle: cfg.SubTitle,
+				FileName: cfg.FileName,
+				Count:    fmt.Sprintf("%d条", storedCount(cfg.FileName)),
+				IsActive: (cfg.FileName == activeFile),
+			})
+		}
+		if len(group.Items) > 0 {
+			navGroups = append(navGroups, group)
 		}
-		navItems = append(navItems, NavItem{
-			MonthStr: cfg.MonthStr,
-			Title:    cfg.Title,
-			SubTitle: cfg.SubTitle,
-			FileName: cfg.FileName,
-			Count:    count + "条",
-			IsActive: (cfg.FileName == activeFile),
-		})
 	}
-	dynamicPostListMu.RUnlock()
 
+	prefs := getViewPrefs(r)
 	var nodes []*ViewNode
-	if msgs, ok := memoryStore[activeFile]; ok {
-		nodes = buildViewNodes(msgs, currentUser.UserID)
+	if msgs := getStoredMessages(activeFile); len(msgs) > 0 {
+		cfg, _ := findPostConfig(activeFile)
+		opts := viewOptionsFor(cfg, prefs)
+		opts.ResolveReply = newReplyResolver(currentUser)
+		nodes = buildViewNodes(msgs, currentUser.UserID, opts)
 	}
 
 	renderHome(w, PageData{
-		NavItems:    navItems,
+		NavGroups:   navGroups,
 		Messages:    nodes,
 		ActiveFile:  activeFile,
 		ProxyInfo:   ProxyURL,
 		CurrentUser: currentUser,
+		Role:        userRole(currentUser),
+		CanSync:     hasRole(currentUser, RoleSyncer),
+		Prefs:       prefs,
+		JobID:       r.URL.Query().Get("job"),
+		Live:        liveEnabled.Load(),
 	})
 }
 
@@ -216,91 +330,46 @@ func handleRefresh(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	targetFile := r.URL.Query().Get("f")
-
-	if allowed, waitTime := checkRateLimit(); !allowed {
-		renderLimitError(w, waitTime)
-		return
+	targetFile := r.PostFormValue("f")
+	backfill := r.PostFormValue("full") == "1"
+	action := AuditRefresh
+	if backfill {
+		action = AuditBackfill
 	}
-
-	var targetPostID string
-	dynamicPostListMu.RLock()
-	for _, cfg := range dynamicPostList {
-		if cfg.FileName == targetFile {
-			targetPostID = cfg.PostID
-			break
-		}
+	logger := reqLogger(r).With(userAttrs(currentUser), logKeyFile, targetFile)
+	if !hasRole(currentUser, RoleSyncer) {
+		logger.Warn("角色无权抓取", "role", userRole(currentUser), "action", action)
+		auditRequest(r, currentUser, AuditDenied, targetFile, AuditFailed, action+": 角色 "+userRole(currentUser))
+		http.Error(w, "当前角色只能查看已同步的存档", http.StatusForbidden)
+		return
 	}
-	dynamicPostListMu.RUnlock()
 
-	if targetPostID == "" {
-		log.Printf("错误: 无法为文件 [%s] 找到对应的 PostID\n", targetFile)
+	if _, ok := findPostConfig(targetFile); !ok {
+		logger.Warn("找不到月份对应的帖子")
 		http.Error(w, "Invalid file specified", http.StatusBadRequest)
 		return
 	}
-
-	var existingMsgs []DiscordMessage
-	var hasExistingMsgs bool
-	storeMu.Lock()
-	existingMsgs, hasExistingMsgs = memoryStore[targetFile]
-	storeMu.Unlock()
-
-	sinceID := ""
-	if hasExistingMsgs && len(existingMsgs) > 0 {
-		sinceID = existingMsgs[0].ID
-		fmt.Printf("🔄 用户 [%s] 正在抓取 [%s] 的新消息 (PostID: %s, 从 %s 之后)...\n", currentUser.Username, targetFile, targetPostID, sinceID)
-	} else {
-		fmt.Printf("🔄 用户 [%s] 正在抓取 [%s] 的所有消息 (PostID: %s, 从头开始)...\n", currentUser.Username, targetFile, targetPostID)
+	cfg, ok := canViewPost(currentUser, targetFile)
+	if !ok {
+		logger.Warn("用户无权查看该月份", "action", action)
+		auditRequest(r, currentUser, AuditDenied, targetFile, AuditFailed, action+": 无权查看该月份")
+		http.Error(w, "无权查看该月份", http.StatusForbidden)
+		return
 	}
 
-	newlyFetchedMsgs, err := fetchNewMessages(currentUser.Token, targetPostID, sinceID)
-
-	if err == nil {
-		storeMu.Lock()
-		if sinceID != "" {
-			// 1. 用新消息构建 map，用于：① 去重判断 ② 覆盖旧消息的图片 URL
-			newMsgMap := make(map[string]DiscordMessage, len(newlyFetchedMsgs))
-			for _, m := range newlyFetchedMsgs {
-				newMsgMap[m.ID] = m
-			}
-
-			// 2. 遍历旧消息：如果新消息里有同 ID，用新消息的 Attachments 覆盖（刷新过期图片 URL）
-			for i, old := range existingMsgs {
-				if fresh, ok := newMsgMap[old.ID]; ok {
-					existingMsgs[i].Attachments = fresh.Attachments
-				}
-			}
-
-			// 3. 筛选出真正新增的消息（旧列表里没有的 ID）
-			existingIDs := make(map[string]bool, len(existingMsgs))
-			for _, m := range existingMsgs {
-				existingIDs[m.ID] = true
-			}
-			var trulyNew []DiscordMessage
-			for _, m := range newlyFetchedMsgs {
-				if !existingIDs[m.ID] {
-					trulyNew = append(trulyNew, m)
-				}
-			}
-
-			// 4. 将真正新增的消息追加到列表头部
-			if len(trulyNew) > 0 {
-				memoryStore[targetFile] = append(trulyNew, existingMsgs...)
-				fmt.Printf("✅ 同步 [%s] 成功，新增 %d 条，当前共 %d 条\n", targetFile, len(trulyNew), len(trulyNew)+len(existingMsgs))
-			} else {
-				// 没有新消息，但图片 URL 已刷新，直接写回
-				memoryStore[targetFile] = existingMsgs
-				fmt.Printf("✅ 同步 [%s] 成功，无新消息，已刷新图片 URL\n", targetFile)
-			}
-		} else {
-			// 首次抓取，直接存储
-			memoryStore[targetFile] = newlyFetchedMsgs
-			fmt.Printf("✅ 同步 [%s] 成功，共 %d 条\n", targetFile, len(newlyFetchedMsgs))
-		}
-		storeMu.Unlock()
-	} else {
-		fmt.Printf("❌ 同步 [%s] 失败: %v\n", targetFile, err)
+	// 抓取在后台任务中进行，页面通过 /jobs/{id}/events 获取进度；同一月份的并发刷新合并为一个任务
+	// full=1 时回填：从头重新抓取整个月份（已有任务进行中时加入该任务）
+	// 只有真正创建新任务时才计入刷新次数，加入进行中的任务不计入
+	job, created, waitTime := startSyncJob(logger, currentUser, cfg, backfill, checkRateLimit)
+	if job == nil {
+		auditRequest(r, currentUser, action, targetFile, AuditLimited, "需等待 "+waitTime)
+		renderLimitError(w, waitTime)
+		return
 	}
-
-	http.Redirect(w, r, "/?f="+targetFile, http.StatusSeeOther)
+	result := AuditOK
+	if !created {
+		result = AuditJoined
+	}
+	auditRequest(r, currentUser, action, targetFile, result, "job="+job.snapshot().ID)
+	http.Redirect(w, r, "/?f="+targetFile+"&job="+job.snapshot().ID, http.StatusSeeOther)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// useTestState 在临时目录中运行测试，并设置服务端配置和月份列表；测试结束后恢复全局状态
+func useTestState(t *testing.T, cfg ServerConfig, posts []PostConfig) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	serverConfigMu.Lock()
+	oldConfig := serverConfig
+	serverConfig = cfg
+	serverConfigMu.Unlock()
+
+	dynamicPostListMu.Lock()
+	oldPosts := dynamicPostList
+	dynamicPostList = posts
+	dynamicPostListMu.Unlock()
+
+	storeMu.Lock()
+	oldStore := maps.Clone(memoryStore)
+	oldIndex := maps.Clone(messageIndex)
+	clear(memoryStore)
+	clear(messageIndex)
+	storeMu.Unlock()
+
+	t.Cleanup(func() {
+		serverConfigMu.Lock()
+		serverConfig = oldConfig
+		serverConfigMu.Unlock()
+		dynamicPostListMu.Lock()
+		dynamicPostList = oldPosts
+		dynamicPostListMu.Unlock()
+		storeMu.Lock()
+		clear(memoryStore)
+		maps.Copy(memoryStore, oldStore)
+		clear(messageIndex)
+		maps.Copy(messageIndex, oldIndex)
+		storeMu.Unlock()
+		clearPermissionCache()
+		replyMsgCacheMu.Lock()
+		clear(replyMsgCache)
+		replyMsgCacheMu.Unlock()
+		rolePermsCacheMu.Lock()
+		clear(rolePermsCache)
+		rolePermsCacheMu.Unlock()
+		guildOwnerCacheMu.Lock()
+		clear(guildOwnerCache)
+		guildOwnerCacheMu.Unlock()
+		threadCacheMu.Lock()
+		clear(threadCache)
+		threadCacheMu.Unlock()
+	})
+}
+
+const testBotToken = "bot-secret"
+
+// useFakeGuild 配置 bot_token 并启动假 Discord：默认社区的公会和入口频道，postIDs 为入口频道下的公开子区。
+// 需在 useTestState 之后调用，返回的服务器可继续添加成员、频道和子区
+func useFakeGuild(t *testing.T, postIDs ...string) *discord.FakeServer {
+	t.Helper()
+	serverConfigMu.Lock()
+	serverConfig.BotToken = testBotToken
+	serverConfigMu.Unlock()
+
+	fake := discord.NewFakeServer(GuildID)
+	fake.AddUser(discord.FakeUser{Token: "Bot " + testBotToken, ID: "500", Username: "bot"})
+	fake.AddChannel(discord.Channel{ID: ChannelID, Name: "gate"})
+	for _, id := range postIDs {
+		fake.AddChannel(discord.Channel{ID: id, Name: id, Type: discord.ChannelTypePublicThread, ParentID: ChannelID})
+	}
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+	discord.SetAPIBase(fake.APIBase(ts.URL))
+	t.Cleanup(func() { discord.SetAPIBase("") })
+	return fake
+}
+
+// sessionRequest 构造带有签名登录 Cookie 的请求；user 为 nil 时不带 Cookie
+func sessionRequest(t *testing.T, method, target string, user *UserSession) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(method, target, nil)
+	if user != nil {
+		value, err := encodeSession(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddCookie(&http.Cookie{Name: CookieName, Value: value})
+	}
+	return r
+}
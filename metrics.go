@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// 运行指标 (/metrics，Prometheus 文本格式)
+// ==========================================
+
+const metricsPrefix = "cyclestudies_"
+
+// 直方图的桶（秒）
+var (
+	httpDurationBuckets    = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	discordDurationBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+	syncDurationBuckets    = []float64{1, 2, 5, 10, 30, 60, 120, 300, 600, 1800}
+)
+
+var (
+	httpRequests = newCounter("http_requests_total", "查看器处理的 HTTP 请求数", "method", "route", "status")
+	httpDuration = newHistogram("http_request_duration_seconds", "查看器处理 HTTP 请求的耗时", httpDurationBuckets, "method", "route")
+
+	discordRequests = newCounter("discord_requests_total", "发往 Discord API 的请求数，status 为 error 表示网络错误", "method", "route", "status")
+	discordDuration = newHistogram("discord_request_duration_seconds", "Discord API 请求的耗时", discordDurationBuckets, "route")
+
+	syncJobsFinished    = newCounter("sync_jobs_total", "结束的后台同步任务数", "state", "backfill")
+	syncDuration        = newHistogram("sync_duration_seconds", "后台同步任务的耗时", syncDurationBuckets, "state")
+	syncMessagesFetched = newCounter("sync_messages_fetched_total", "同步任务从 Discord 抓取的消息数")
+	syncMessagesAdded   = newCounter("sync_messages_added_total", "同步任务新增到存档的消息数")
+
+	cacheLookups = newCounter("cache_lookups_total", "缓存查询次数，cache 为 permission / role_perms / guild_owner / thread / reply", "cache", "result")
+
+	refreshLimited = newCounter("refresh_limited_total", "因刷新次数超限被拒绝的刷新请求数")
+)
+
+func init() {
+	newGauge("sync_jobs_running", "正在进行的后台同步任务数", func() float64 { return float64(runningJobCount()) })
+	newGauge("refresh_quota_used", "当前窗口内已使用的刷新次数", func() float64 { return float64(refreshQuotaUsed()) })
+	newGauge("refresh_quota_limit", "每个窗口允许的刷新次数", func() float64 { return MaxRefreshes })
+	newGauge("permission_cache_entries", "权限缓存中的条目数（含已过期未清理的）", func() float64 {
+		permCacheMu.RLock()
+		defer permCacheMu.RUnlock()
+		return float64(len(permCache))
+	})
+}
+
+// ---------------- 指标类型 ----------------
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	metricsMu sync.Mutex
+	registry  []metric // 按注册顺序输出
+)
+
+func register(m metric) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	registry = append(registry, m)
+}
+
+// metricVec 是带标签的计数器或直方图，每组标签值对应一个序列
+type metricVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // 为 nil 时是计数器
+
+	mu     sync.Mutex
+	series map[string]*metricSeries // key: 标签值以 \xff 连接
+}
+
+type metricSeries struct {
+	values []string
+	value  float64  // 计数器的值 / 直方图的总和
+	counts []uint64 // 直方图每个桶（不累计）的次数
+	count  uint64
+}
+
+func newCounter(name, help string, labels ...string) *metricVec {
+	m := &metricVec{name: metricsPrefix + name, help: help, labels: labels, series: make(map[string]*metricSeries)}
+	register(m)
+	return m
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *metricVec {
+	m := newCounter(name, help, labels...)
+	m.buckets = buckets
+	return m
+}
+
+// 取得某组标签值对应的序列，调用方需持有 m.mu；标签个数不对时记录日志并返回 nil，丢弃这次采样
+func (m *metricVec) get(values []string) *metricSeries {
+	if len(values) != len(m.labels) {
+		slog.Error("指标标签个数不匹配，已丢弃采样", "metric", m.name, "want", len(m.labels), "got", len(values))
+		return nil
+	}
+	key := strings.Join(values, "\xff")
+	s := m.series[key]
+	if s == nil {
+		s = &metricSeries{values: slices.Clone(values)}
+		if m.buckets != nil {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *metricVec) inc(values ...string) {
+	m.add(1, values...)
+}
+
+func (m *metricVec) add(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.get(values); s != nil {
+		s.value += v
+	}
+}
+
+func (m *metricVec) observe(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(values)
+	if s == nil {
+		return
+	}
+	s.value += v
+	s.count++
+	if i, _ := slices.BinarySearch(m.buckets, v); i < len(m.buckets) {
+		s.counts[i]++
+	}
+}
+
+func (m *metricVec) write(w io.Writer) {
+	kind := "counter"
+	if m.buckets != nil {
+		kind = "histogram"
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, escapeHelp(m.help), m.name, kind)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.labels) == 0 && len(m.series) == 0 {
+		m.get(nil) // 无标签的指标始终输出，从 0 开始
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.series)) {
+		s := m.series[key]
+		if m.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, s.values), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(append(slices.Clone(m.labels), "le"), append(slices.Clone(s.values), formatFloat(le))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(append(slices.Clone(m.labels), "le"), append(slices.Clone(s.values), "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, formatLabels(m.labels, s.values), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, formatLabels(m.labels, s.values), s.count)
+	}
+}
+
+// gaugeFunc 在抓取 /metrics 时才计算当前值
+type gaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func newGauge(name, help string, fn func() float64) {
+	register(&gaugeFunc{name: metricsPrefix + name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, escapeHelp(g.help), g.name, g.name, formatFloat(g.fn()))
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ---------------- 采集点 ----------------
+
+// withMetrics 统计每个请求的状态码和耗时；route 使用 ServeMux 匹配到的路由模式，避免路径参数导致标签过多
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if r.Pattern != "" {
+			_, path, found := strings.Cut(r.Pattern, " ") // 去掉 "GET " 之类的方法前缀
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+		httpRequests.inc(r.Method, route, strconv.Itoa(cmp.Or(rec.status, http.StatusOK)))
+		httpDuration.observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// metricsTransport 统计发往 Discord 的请求（包括 429 重试的每一次）
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	route := discordRoute(req.URL)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	discordRequests.inc(req.Method, route, status)
+	discordDuration.observe(time.Since(start).Seconds(), route)
+	return resp, err
+}
+
+// instrumentClient 给 Discord 客户端加上请求统计
+func instrumentClient(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &metricsTransport{base: base}
+	return client
+}
+
+var snowflakeSegment = regexp.MustCompile(`/\d{5,}`)
+
+// discordRoute 把请求路径归一为路由，例如 /channels/123.../messages -> /channels/{id}/messages
+func discordRoute(u *url.URL) string {
+	path := u.Path
+	if base, err := url.Parse(discord.APIBase); err == nil && base.Path != "" {
+		path = strings.TrimPrefix(path, base.Path)
+	}
+	return snowflakeSegment.ReplaceAllString(path, "/{id}")
+}
+
+// observeSyncJob 在任务结束后记录耗时、结果和消息数
+func observeSyncJob(job *syncJob) {
+	s := job.snapshot()
+	syncJobsFinished.inc(s.State, strconv.FormatBool(s.Backfill))
+	if !s.FinishedAt.IsZero() {
+		syncDuration.observe(s.FinishedAt.Sub(s.StartedAt).Seconds(), s.State)
+	}
+	syncMessagesFetched.add(float64(s.Progress.Messages))
+	syncMessagesAdded.add(float64(s.Added))
+}
+
+// observeCache 记录一次缓存查询是否命中
+func observeCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.inc(cache, result)
+}
+
+// ---------------- 输出 ----------------
+
+// handleMetrics 输出所有指标；配置了 metrics.token 时需要 Authorization: Bearer <token>，
+// 未配置时只允许本机访问（指标里有刷新配额和路由信息，不宜对外公开）
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := getServerConfig().Metrics.Token; token != "" {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else if !isLoopback(clientIP(r)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	metricsMu.Lock()
+	metrics := slices.Clone(registry)
+	metricsMu.Unlock()
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	bw.Flush()
+}
+
+func isLoopback(host string) bool {
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
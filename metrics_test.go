@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricLabelMismatchDropsSample(t *testing.T) {
+	m := &metricVec{name: "test_total", help: "test", labels: []string{"route"}, series: make(map[string]*metricSeries)}
+	m.inc("/a")
+	m.inc()
+	m.add(2, "/a", "extra")
+	h := &metricVec{name: "test_seconds", help: "test", labels: []string{"route"}, buckets: []float64{1}, series: make(map[string]*metricSeries)}
+	h.observe(0.5)
+
+	var b strings.Builder
+	m.write(&b)
+	h.write(&b)
+	if got := b.String(); !strings.Contains(got, `test_total{route="/a"} 1`) || strings.Count(got, "test_total{") != 1 || strings.Contains(got, "test_seconds_") {
+		t.Errorf("output:\n%s", got)
+	}
+}
+
+func TestMetricsAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    ServerConfig
+		remote string
+		header map[string]string
+		want   int
+	}{
+		{"loopback v4", ServerConfig{}, "127.0.0.1:5000", nil, http.StatusOK},
+		{"loopback v6", ServerConfig{}, "[::1]:5000", nil, http.StatusOK},
+		{"remote without token", ServerConfig{}, "192.0.2.1:5000", nil, http.StatusForbidden},
+		{"forwarded remote", ServerConfig{Audit: AuditConfig{TrustForwardedFor: true}}, "127.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "192.0.2.1"}, http.StatusForbidden},
+		{"token required on loopback", ServerConfig{Metrics: MetricsConfig{Token: "s3cret"}}, "127.0.0.1:5000", nil, http.StatusUnauthorized},
+		{"remote with token", ServerConfig{Metrics: MetricsConfig{Token: "s3cret"}}, "192.0.2.1:5000",
+			map[string]string{"Authorization": "Bearer s3cret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestState(t, tt.cfg, nil)
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handleMetrics(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), metricsPrefix+"http_requests_total") {
+				t.Errorf("body missing metrics:\n%s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// ==========================================
+// Discord OAuth2 登录
+// ==========================================
+
+const oauthStateCookie = "oauth_state"
+
+// 当前的 OAuth2 配置，client_id 为空表示未开启
+func getOAuthConfig() (discord.OAuthConfig, []string, bool) {
+	cfg := getServerConfig().OAuth
+	if cfg.ClientID == "" {
+		return discord.OAuthConfig{}, nil, false
+	}
+	secret := os.Getenv("DISCORD_CLIENT_SECRET")
+	if secret == "" {
+		secret = cfg.ClientSecret
+	}
+	redirect := cfg.RedirectURL
+	if redirect == "" {
+		redirect = "http://localhost:" + Port + "/oauth/callback"
+	}
+	return discord.OAuthConfig{
+		ClientID:     cfg.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  redirect,
+		AuthorizeURL: cfg.AuthorizeURL,
+		TokenURL:     cfg.TokenURL,
+	}, cfg.AllowedRoles, true
+}
+
+func oauthEnabled() bool {
+	_, _, ok := getOAuthConfig()
+	return ok
+}
+
+// 跳转到 Discord 授权页
+func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	cfg, _, ok := getOAuthConfig()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	state := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/oauth",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+	http.Redirect(w, r, cfg.AuthCodeURL(state), http.StatusFound)
+}
+
+// Discord 授权后的回调：校验 state，换取令牌，确认公会成员身份后建立 Session。
+// 访问令牌只在这里使用一次，不写入 Session
+func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	cfg, allowedRoles, ok := getOAuthConfig()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Value: "", Path: "/oauth", MaxAge: -1})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		renderLogin(w, "Discord 授权失败: "+e)
+		return
+	}
+	state, err := r.Cookie(oauthStateCookie)
+	if err != nil || state.Value == "" || state.Value != q.Get("state") {
+		renderLogin(w, "登录已过期，请重试")
+		return
+	}
+
+	client := getClient()
+	tok, err := cfg.Exchange(client, q.Get("code"))
+	if err != nil {
+		reqLogger(r).Error("OAuth 换取令牌失败", logKeyErr, err)
+		renderLogin(w, "Discord 授权失败，请重试")
+		return
+	}
+	user, err := oauthSessionFor(reqLogger(r), client, tok.Authorization(), allowedRoles)
+	if err != nil {
+		auditRequest(r, nil, AuditLogin, "", AuditFailed, "oauth: "+err.Error())
+		renderLogin(w, err.Error())
+		return
+	}
+	if err := setSessionCookie(w, user); err != nil {
+		renderLogin(w, "创建会话失败")
+		return
+	}
+
+	reqLogger(r).Info("登录成功", userAttrs(user), "method", "oauth", "communities", len(user.Communities))
+	auditRequest(r, user, AuditLogin, "", AuditOK, "oauth")
+	if err := ensurePostList(); err != nil {
+		reqLogger(r).Error("获取频道配置失败", logKeyErr, err)
+		renderLogin(w, "获取频道配置失败")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// 读取用户信息并检查公会成员身份 / 角色，以及（用 Bot 计算的）社区入口频道的查看权限
+func oauthSessionFor(logger *slog.Logger, client *http.Client, auth string, allowedRoles []string) (*UserSession, error) {
+	me, err := discord.GetCurrentUser(client, auth)
+	if err != nil {
+		logger.Error("OAuth 获取用户信息失败", logKeyErr, err)
+		return nil, errors.New("获取 Discord 用户信息失败")
+	}
+	bot := getBotAuthorization()
+	if bot == "" {
+		logger.Error("OAuth 登录需要配置 bot_token")
+		return nil, errors.New("服务端未配置 bot_token，无法登录")
+	}
+	accessible, err := getUserAllAccessibleChannels(bot, me.ID)
+	if err != nil {
+		logger.Error("OAuth 计算频道权限失败", logKeyUser, me.Username, logKeyUserID, me.ID, logKeyErr, err)
+		return nil, errors.New("获取成员信息失败")
+	}
+	// 逐个社区所在的 guild 确认成员身份，记录可以进入的社区
+	var communities, roles []string
+	checked := make(map[string]bool) // guildID -> 是否通过
+	for _, c := range getCommunities() {
+		ok, seen := checked[c.GuildID]
+		if !seen {
+			var memberRoles []string
+			memberRoles, ok, err = oauthGuildAllowed(client, auth, c.GuildID, allowedRoles)
+			if err != nil {
+				logger.Error("OAuth 获取成员信息失败", logKeyUser, me.Username, logKeyUserID, me.ID, "guild", c.GuildID, logKeyErr, err)
+				return nil, errors.New("获取成员信息失败")
+			}
+			checked[c.GuildID] = ok
+			if ok {
+				roles = append(roles, memberRoles...)
+			}
+		}
+		if ok && accessible[c.ChannelID] {
+			communities = append(communities, c.ID)
+		}
+	}
+	if len(communities) == 0 {
+		logger.Warn("用户不是任何社区的成员", logKeyUser, me.Username, logKeyUserID, me.ID)
+		return nil, errors.New("你还不是任何社区的成员，或你的身份组无权访问")
+	}
+	return &UserSession{
+		UserID:   me.ID,
+		Username: me.Username,
+		Avatar:   getAvatar(me.ID, me.Avatar),
+		Auth:     AuthOAuth,
+
+		Communities: communities,
+		Roles:       roles,
+	}, nil
+}
+
+// oauthGuildAllowed 当前用户是否是 guild 成员（同时返回其身份组）；配置了 allowed_roles 时还需拥有其中任一角色
+func oauthGuildAllowed(client *http.Client, auth, guildID string, allowedRoles []string) ([]string, bool, error) {
+	member, err := discord.GetCurrentUserGuildMember(client, auth, guildID)
+	if err != nil {
+		var se *discord.StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if len(allowedRoles) > 0 && !slices.ContainsFunc(member.Roles, func(id string) bool { return slices.Contains(allowedRoles, id) }) {
+		return nil, false, nil
+	}
+	return member.Roles, true, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+// oauthCallback 走一遍 /oauth/login → 假授权页 → /oauth/callback；tamper 为 true 时回调带上错误的 state
+func oauthCallback(t *testing.T, userID string, tamper bool) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleOAuthLogin(w, httptest.NewRequest("GET", "/oauth/login", nil))
+	var state *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oauthStateCookie {
+			state = c
+		}
+	}
+	if w.Code != http.StatusFound || state == nil {
+		t.Fatalf("login: %d, state cookie %v", w.Code, state)
+	}
+
+	// 假授权页直接带着授权码跳回回调地址
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location") + "&user=" + userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		t.Fatalf("authorize redirect = %q", resp.Header.Get("Location"))
+	}
+	if tamper {
+		state.Value = "forged"
+	}
+
+	r := httptest.NewRequest("GET", "/oauth/callback?"+callback.RawQuery, nil)
+	r.AddCookie(&http.Cookie{Name: state.Name, Value: state.Value})
+	w = httptest.NewRecorder()
+	handleOAuthCallback(w, r)
+	return w
+}
+
+func TestOAuthCallback(t *testing.T) {
+	cfg := ServerConfig{OAuth: OAuthConfig{ClientID: "cid", ClientSecret: "secret", AllowedRoles: []string{"r-student"}}}
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	fake := useFakeGuild(t, "111")
+	fake.OAuthClientID, fake.OAuthClientSecret = "cid", "secret"
+	// 入口频道只对 r-member 开放
+	fake.AddChannel(discord.Channel{ID: "120", Name: "gate", PermissionOverwrites: []discord.PermissionOverwrite{
+		{ID: GuildID, Type: 0, Deny: strconv.Itoa(discord.PermViewChannel)},
+		{ID: "r-member", Type: 0, Allow: strconv.Itoa(discord.PermViewChannel)},
+	}})
+	serverConfigMu.Lock()
+	serverConfig.Communities = []CommunityConfig{{ChannelID: "120"}}
+	serverConfigMu.Unlock()
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "alice", Roles: []string{"r-student", "r-member"}})
+	fake.AddUser(discord.FakeUser{ID: "2", Username: "outsider", Guest: true})
+	fake.AddUser(discord.FakeUser{ID: "3", Username: "no-role", Roles: []string{"r-member"}})
+	fake.AddUser(discord.FakeUser{ID: "4", Username: "no-gate", Roles: []string{"r-student"}})
+
+	tests := []struct {
+		name    string
+		userID  string
+		tamper  bool
+		wantErr string
+	}{
+		{"state mismatch", "1", true, "登录已过期"},
+		{"not a member", "2", false, "不是任何社区的成员"},
+		{"missing allowed role", "3", false, "不是任何社区的成员"},
+		{"cannot read gate channel", "4", false, "不是任何社区的成员"},
+		{"success", "1", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := oauthCallback(t, tt.userID, tt.tamper)
+			var session *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == CookieName && c.Value != "" {
+					session = c
+				}
+			}
+			if tt.wantErr != "" {
+				if session != nil || !strings.Contains(w.Body.String(), tt.wantErr) {
+					t.Errorf("status %d, session %v, body missing %q", w.Code, session, tt.wantErr)
+				}
+				return
+			}
+			if w.Code != http.StatusSeeOther || session == nil {
+				t.Fatalf("status %d, session %v: %s", w.Code, session, w.Body)
+			}
+			user, err := decodeSession(session.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.UserID != "1" || user.Auth != AuthOAuth || user.Token != "" || !slices.Equal(user.Communities, []string{""}) {
+				t.Errorf("session = %+v", user)
+			}
+		})
+	}
+}
+
+func TestOAuthRequiresBotToken(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	writeFile(t, ServerConfigFile, `{"oauth": {"client_id": "cid"}}`)
+	if err := loadServerConfig(); err == nil || !strings.Contains(err.Error(), "bot_token") {
+		t.Errorf("err = %v, want bot_token required", err)
+	}
+	writeFile(t, ServerConfigFile, `{"oauth": {"client_id": "cid"}, "bot_token": "x"}`)
+	if err := loadServerConfig(); err != nil {
+		t.Error(err)
+	}
+}
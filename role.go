@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// ==========================================
+// 查看器角色 (viewer / syncer / admin)
+// ==========================================
+
+const (
+	RoleViewer = "viewer" // 只能浏览已同步的存档
+	RoleSyncer = "syncer" // 还可以抓取最新消息、回填整个月份
+	RoleAdmin  = "admin"  // 还可以修改高亮规则、管理月份列表、查看审计日志
+)
+
+// 角色等级，高等级拥有低等级的全部权限
+var roleLevels = map[string]int{RoleViewer: 1, RoleSyncer: 2, RoleAdmin: 3}
+
+// defaultRole 未匹配任何映射时的角色；未配置时为 syncer，与引入角色前所有成员都能刷新的行为一致
+func (c RolesConfig) defaultRole() string {
+	if c.Default == "" {
+		return RoleSyncer
+	}
+	return c.Default
+}
+
+// usesDiscordRoles 是否有按 Discord 身份组映射的角色（需要在登录时记录身份组）
+func (c RolesConfig) usesDiscordRoles() bool {
+	return len(c.Admin.DiscordRoles) > 0 || len(c.Syncer.DiscordRoles) > 0
+}
+
+func (m RoleMapping) matches(user *UserSession) bool {
+	if slices.Contains(m.UserIDs, user.UserID) {
+		return true
+	}
+	return slices.ContainsFunc(user.Roles, func(id string) bool { return slices.Contains(m.DiscordRoles, id) })
+}
+
+// validateRoles 检查 server_config.json 中的角色配置
+func validateRoles(c RolesConfig) error {
+	if c.Default != "" && roleLevels[c.Default] == 0 {
+		return fmt.Errorf("roles.default %q 无效，只能是 viewer / syncer / admin", c.Default)
+	}
+	return nil
+}
+
+// userRole 返回用户在查看器中的角色：访客始终是 viewer，其次按用户 ID / Discord 身份组匹配 admin、syncer，否则为默认角色
+func userRole(user *UserSession) string {
+	if user == nil {
+		return ""
+	}
+	if isGuest(user) {
+		return RoleViewer
+	}
+	cfg := getServerConfig().Roles
+	switch {
+	case cfg.Admin.matches(user):
+		return RoleAdmin
+	case cfg.Syncer.matches(user):
+		return RoleSyncer
+	}
+	return cfg.defaultRole()
+}
+
+// hasRole 用户的角色是否不低于 role
+func hasRole(user *UserSession, role string) bool {
+	return roleLevels[userRole(user)] >= roleLevels[role]
+}
+
+// requireRole 检查当前用户的角色，不满足时返回 403 并返回 nil
+func requireRole(w http.ResponseWriter, r *http.Request, role string) *UserSession {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil
+	}
+	if !hasRole(user, role) {
+		reqLogger(r).Warn("角色不足，拒绝访问", userAttrs(user), "role", userRole(user), "required", role, "path", r.URL.Path)
+		auditRequest(r, user, AuditDenied, r.URL.Path, AuditFailed, "需要 "+role+" 角色")
+		http.Error(w, fmt.Sprintf("需要 %s 角色", role), http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// collectDiscordRoles 在登录时获取用户在各社区公会中的身份组 ID，用于角色映射；获取失败的公会跳过
+func collectDiscordRoles(token, userID string) []string {
+	if token == "" || !getServerConfig().Roles.usesDiscordRoles() {
+		return nil
+	}
+	var roles []string
+	checked := make(map[string]bool)
+	for _, c := range getCommunities() {
+		if checked[c.GuildID] {
+			continue
+		}
+		checked[c.GuildID] = true
+		ids, err := getUserRolesInGuild(token, c.GuildID, userID)
+		if err != nil {
+			slog.Warn("获取身份组失败", "guild", c.GuildID, logKeyUserID, userID, logKeyErr, err)
+			continue
+		}
+		for _, id := range ids {
+			if !slices.Contains(roles, id) {
+				roles = append(roles, id)
+			}
+		}
+	}
+	return roles
+}
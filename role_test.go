@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserRole(t *testing.T) {
+	roles := RolesConfig{
+		Admin:  RoleMapping{UserIDs: []string{"1"}, DiscordRoles: []string{"r-admin"}},
+		Syncer: RoleMapping{UserIDs: []string{"1", "2"}, DiscordRoles: []string{"r-admin", "r-sync"}},
+	}
+	tests := []struct {
+		name  string
+		roles RolesConfig
+		user  *UserSession
+		want  string
+	}{
+		{"not logged in", roles, nil, ""},
+		{"admin by user ID beats syncer", roles, &UserSession{UserID: "1"}, RoleAdmin},
+		{"admin by Discord role beats syncer", roles, &UserSession{UserID: "5", Roles: []string{"r-admin"}}, RoleAdmin},
+		{"syncer by user ID", roles, &UserSession{UserID: "2"}, RoleSyncer},
+		{"syncer by Discord role", roles, &UserSession{UserID: "5", Roles: []string{"r-other", "r-sync"}}, RoleSyncer},
+		{"default is syncer", roles, &UserSession{UserID: "5"}, RoleSyncer},
+		{"configured default", RolesConfig{Default: RoleViewer}, &UserSession{UserID: "5"}, RoleViewer},
+		{"guest is always viewer", roles, &UserSession{UserID: "1", Auth: AuthGuest}, RoleViewer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestState(t, ServerConfig{Roles: tt.roles}, nil)
+			if got := userRole(tt.user); got != tt.want {
+				t.Errorf("userRole = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 角色不足时返回 403 并记录一条 denied 审计
+func TestRequireRoleDenied(t *testing.T) {
+	useTestState(t, ServerConfig{Roles: RolesConfig{Default: RoleViewer, Admin: RoleMapping{UserIDs: []string{"9"}}}}, nil)
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, sessionRequest(t, "GET", "/admin", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("anonymous GET /admin = %d %q, want redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+
+	viewer := &UserSession{UserID: "1", Username: "alice"}
+	for _, path := range []string{"/admin", "/admin/audit"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, sessionRequest(t, "GET", path, viewer))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("viewer GET %s = %d, want 403", path, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, sessionRequest(t, "POST", "/admin/posts", viewer))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("viewer POST /admin/posts = %d, want 403", w.Code)
+	}
+
+	entries, err := readAuditEntries(AuditFilter{Action: AuditDenied, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("denied entries = %+v, want 3", entries)
+	}
+	for _, e := range entries {
+		if e.UserID != "1" || e.Username != "alice" || e.Result != AuditFailed {
+			t.Errorf("denied entry = %+v", e)
+		}
+	}
+	if entries[0].Target != "/admin/posts" || entries[2].Target != "/admin" {
+		t.Errorf("denied targets = %q, %q, want newest /admin/posts, oldest /admin", entries[0].Target, entries[2].Target)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, sessionRequest(t, "GET", "/admin", &UserSession{UserID: "9"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("admin GET /admin = %d, want 200", w.Code)
+	}
+}
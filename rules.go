@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 高亮规则引擎 (Highlight Rules)
+// ==========================================
+
+const (
+	HighlightRulesFile    = "highlight_rules.json"
+	DefaultHighlightColor = "#faa61a"
+	rulesReloadInterval   = 5 * time.Second
+)
+
+// 编译后的规则（正则预编译）
+type compiledRule struct {
+	HighlightRule
+	regexps []*regexp.Regexp
+}
+
+// 一个规则文件编译后的规则
+type ruleSet struct {
+	rules    []compiledRule
+	mtime    time.Time
+	hasRoles bool // 含有 role 规则，渲染时需要查询作者身份组
+}
+
+var (
+	highlightRulesMu sync.RWMutex
+	highlightRules   = make(map[string]*ruleSet) // 规则文件 -> 规则，每个社区一个文件
+)
+
+// 未提供规则文件时的默认规则，与旧版硬编码的关键词一致
+func defaultHighlightRules() []HighlightRule {
+	return []HighlightRule{
+		{Name: "everyone", Type: "keyword", Values: []string{"@everyone"}, Category: "mention", Color: DefaultHighlightColor},
+		{Name: "优质问题", Type: "keyword", Values: []string{"优质问题", "优质提问"}, Category: "mention", Color: DefaultHighlightColor},
+		{Name: "新手问答", Type: "keyword", Values: []string{"新手问答"}, Exclude: true},
+	}
+}
+
+// loadAllHighlightRules 加载所有社区的规则文件，出错的文件使用默认规则
+func loadAllHighlightRules() {
+	for _, c := range getCommunities() {
+		if err := loadHighlightRules(c.HighlightRules); err != nil {
+			slog.Error("加载高亮规则失败，使用默认规则", "path", c.HighlightRules, logKeyErr, err)
+			compiled, _ := compileHighlightRules(defaultHighlightRules())
+			highlightRulesMu.Lock()
+			highlightRules[c.HighlightRules] = &ruleSet{rules: compiled}
+			highlightRulesMu.Unlock()
+		}
+	}
+}
+
+// loadHighlightRules 从规则文件加载规则，文件不存在时使用默认规则
+func loadHighlightRules(path string) error {
+	rules := defaultHighlightRules()
+	var mtime time.Time
+	if info, err := os.Stat(path); err == nil {
+		fileContent, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取规则文件 %s 失败: %w", path, err)
+		}
+		rules = nil
+		if err := json.Unmarshal(fileContent, &rules); err != nil {
+			return fmt.Errorf("解析规则文件 %s 失败: %w", path, err)
+		}
+		mtime = info.ModTime()
+	}
+
+	compiled, err := compileHighlightRules(rules)
+	if err != nil {
+		return err
+	}
+
+	set := &ruleSet{rules: compiled, mtime: mtime}
+	set.hasRoles = slices.ContainsFunc(compiled, func(r compiledRule) bool { return r.Type == "role" })
+	if set.hasRoles && getBotAuthorization() == "" {
+		slog.Warn("规则中的 role 规则需要配置 bot_token 才能查询作者身份组，目前不会命中", "path", path)
+	}
+
+	highlightRulesMu.Lock()
+	highlightRules[path] = set
+	highlightRulesMu.Unlock()
+	slog.Info("已加载高亮规则", "path", path, "count", len(compiled))
+	return nil
+}
+
+func compileHighlightRules(rules []HighlightRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		cr := compiledRule{HighlightRule: r}
+		switch r.Type {
+		case "keyword", "author", "role", "has_attachment":
+		case "regex":
+			for _, v := range r.Values {
+				re, err := regexp.Compile(v)
+				if err != nil {
+					return nil, fmt.Errorf("规则 [%s] 正则 %q 无效: %w", r.Name, v, err)
+				}
+				cr.regexps = append(cr.regexps, re)
+			}
+		default:
+			return nil, fmt.Errorf("规则 [%s] 类型 %q 不支持", r.Name, r.Type)
+		}
+		if cr.Color == "" && !cr.Exclude {
+			cr.Color = DefaultHighlightColor
+		}
+		compiled = append(compiled, cr)
+	}
+	// 优先级高的排在前面，同优先级保持文件中的顺序
+	sort.SliceStable(compiled, func(i, j int) bool { return compiled[i].Priority > compiled[j].Priority })
+	return compiled, nil
+}
+
+// watchHighlightRules 定期检查各规则文件的修改时间，变化时热加载
+func watchHighlightRules() {
+	ticker := time.NewTicker(rulesReloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		highlightRulesMu.RLock()
+		mtimes := make(map[string]time.Time, len(highlightRules))
+		for path, set := range highlightRules {
+			mtimes[path] = set.mtime
+		}
+		highlightRulesMu.RUnlock()
+
+		for path, old := range mtimes {
+			var mtime time.Time
+			if info, err := os.Stat(path); err == nil {
+				mtime = info.ModTime()
+			}
+			if mtime.Equal(old) {
+				continue
+			}
+			if err := loadHighlightRules(path); err != nil {
+				slog.Error("热加载高亮规则失败，继续使用旧规则", "path", path, logKeyErr, err)
+				highlightRulesMu.Lock()
+				highlightRules[path].mtime = mtime // 避免对同一个错误文件反复报错
+				highlightRulesMu.Unlock()
+			}
+		}
+	}
+}
+
+func (r *compiledRule) matches(node *ViewNode) bool {
+	switch r.Type {
+	case "keyword":
+		for _, v := range r.Values {
+			if v != "" && strings.Contains(node.Content, v) {
+				return true
+			}
+		}
+	case "regex":
+		for _, re := range r.regexps {
+			if re.MatchString(node.Content) {
+				return true
+			}
+		}
+	case "author":
+		for _, v := range r.Values {
+			if v == node.AuthorID {
+				return true
+			}
+		}
+	case "role":
+		for _, v := range r.Values {
+			if slices.Contains(node.AuthorRoles, v) {
+				return true
+			}
+		}
+	case "has_attachment":
+		return len(node.Images) > 0
+	}
+	return false
+}
+
+// authorRolesResolver 返回渲染时查询作者身份组的函数：存档消息不带 member，需要用 bot_token 逐个查询（按公会和作者缓存）。
+// 规则文件中没有 role 规则或未配置 bot_token 时返回 nil
+func authorRolesResolver(path, guildID string) func(authorID string) []string {
+	highlightRulesMu.RLock()
+	set := highlightRules[path]
+	highlightRulesMu.RUnlock()
+	token := getBotAuthorization()
+	if set == nil || !set.hasRoles || token == "" {
+		return nil
+	}
+	// 同一次渲染中查询失败的作者不再重复请求
+	seen := make(map[string][]string)
+	return func(authorID string) []string {
+		if roles, ok := seen[authorID]; ok {
+			return roles
+		}
+		roles, err := getMemberRolesWithCache(token, guildID, authorID)
+		if err != nil {
+			slog.Warn("查询作者身份组失败", "guild", guildID, logKeyUserID, authorID, logKeyErr, err)
+		}
+		seen[authorID] = roles
+		return roles
+	}
+}
+
+// applyHighlightRules 根据规则文件 path 中的规则设置节点的高亮状态：
+// 命中任意排除规则则不高亮，否则由优先级最高的命中规则决定分类与颜色
+func applyHighlightRules(node *ViewNode, path string) {
+	highlightRulesMu.RLock()
+	defer highlightRulesMu.RUnlock()
+	var rules []compiledRule
+	if set := highlightRules[path]; set != nil {
+		rules = set.rules
+	}
+
+	node.IsMention = false
+	node.Highlight = ""
+	node.HighlightColor = ""
+	node.MatchedRules = nil
+
+	var winner *compiledRule
+	excluded := false
+	for i := range rules {
+		r := &rules[i]
+		if !r.matches(node) {
+			continue
+		}
+		node.MatchedRules = append(node.MatchedRules, r.Name)
+		if r.Exclude {
+			excluded = true
+		} else if winner == nil {
+			winner = r
+		}
+	}
+
+	if winner != nil && !excluded {
+		node.IsMention = true
+		node.Highlight = winner.Category
+		node.HighlightColor = winner.Color
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+func TestCompileHighlightRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    HighlightRule
+		wantErr string
+	}{
+		{"keyword", HighlightRule{Name: "k", Type: "keyword", Values: []string{"x"}}, ""},
+		{"author", HighlightRule{Name: "a", Type: "author", Values: []string{"1"}}, ""},
+		{"invalid regex", HighlightRule{Name: "r", Type: "regex", Values: []string{"("}}, "正则"},
+		{"role", HighlightRule{Name: "管理员", Type: "role", Values: []string{"201"}}, ""},
+		{"unknown type", HighlightRule{Name: "u", Type: "emoji"}, "不支持"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileHighlightRules([]HighlightRule{tt.rule})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyHighlightRules(t *testing.T) {
+	compiled, err := compileHighlightRules([]HighlightRule{
+		{Name: "everyone", Type: "keyword", Values: []string{"@everyone"}, Category: "mention"},
+		{Name: "admin", Type: "author", Values: []string{"9"}, Priority: 10, Category: "admin", Color: "#5865f2"},
+		{Name: "mod", Type: "role", Values: []string{"201"}, Priority: 5, Category: "mod", Color: "#2ecc71"},
+		{Name: "skip", Type: "keyword", Values: []string{"新手问答"}, Exclude: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const path = "test_rules.json"
+	highlightRulesMu.Lock()
+	highlightRules[path] = &ruleSet{rules: compiled}
+	highlightRulesMu.Unlock()
+	t.Cleanup(func() {
+		highlightRulesMu.Lock()
+		delete(highlightRules, path)
+		highlightRulesMu.Unlock()
+	})
+
+	tests := []struct {
+		name      string
+		node      ViewNode
+		highlight string
+		color     string
+	}{
+		{"no match", ViewNode{Content: "hello", AuthorID: "1"}, "", ""},
+		{"keyword", ViewNode{Content: "@everyone hi", AuthorID: "1"}, "mention", DefaultHighlightColor},
+		{"higher priority wins", ViewNode{Content: "@everyone hi", AuthorID: "9"}, "admin", "#5865f2"},
+		{"role", ViewNode{Content: "hello", AuthorID: "2", AuthorRoles: []string{"200", "201"}}, "mod", "#2ecc71"},
+		{"author beats role", ViewNode{Content: "hello", AuthorID: "9", AuthorRoles: []string{"201"}}, "admin", "#5865f2"},
+		{"exclude beats everything", ViewNode{Content: "@everyone 新手问答", AuthorID: "9"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			applyHighlightRules(&node, path)
+			if node.Highlight != tt.highlight || node.HighlightColor != tt.color || node.IsMention != (tt.highlight != "") {
+				t.Errorf("highlight = %q %q (mention %v), want %q %q", node.Highlight, node.HighlightColor, node.IsMention, tt.highlight, tt.color)
+			}
+		})
+	}
+}
+
+func TestRoleRulesLookUpAuthorRoles(t *testing.T) {
+	cfg := ServerConfig{BotToken: "bot-secret", Communities: []CommunityConfig{{GuildID: "100", ChannelID: "110"}}}
+	useTestState(t, cfg, []PostConfig{{FileName: "2025-01.json", PostID: "111"}})
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: "Bot bot-secret", ID: "500", Username: "bot"})
+	fake.AddUser(discord.FakeUser{ID: "1", Username: "mod", Roles: []string{"201"}})
+	fake.AddUser(discord.FakeUser{ID: "2", Username: "member"})
+
+	var memberLookups atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/members/") {
+			memberLookups.Add(1)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	discord.SetAPIBase(fake.APIBase(ts.URL))
+	defer discord.SetAPIBase("")
+
+	writeFile(t, HighlightRulesFile, `[{"name": "mod", "type": "role", "values": ["201"], "category": "mod"}]`)
+	if err := loadHighlightRules(HighlightRulesFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		highlightRulesMu.Lock()
+		delete(highlightRules, HighlightRulesFile)
+		highlightRulesMu.Unlock()
+	})
+
+	// 3 位作者：有身份组的成员、无身份组的成员、已离开公会的用户
+	msgs := testMessages("10", "11", "12", "13")
+	for i, author := range []string{"1", "2", "3", "1"} {
+		msgs[i].Author.ID = author
+	}
+	for range 2 {
+		opts := viewOptionsFor(PostConfig{FileName: "2025-01.json", PostID: "111"}, ViewPrefs{NoMerge: true})
+		nodes := buildViewNodes(msgs, "", opts)
+		if len(nodes) != 4 {
+			t.Fatalf("got %d nodes", len(nodes))
+		}
+		for _, n := range nodes {
+			if want := n.AuthorID == "1"; n.IsMention != want || (want && n.Highlight != "mod") {
+				t.Errorf("node %s (author %s): highlight %q mention %v", n.ID, n.AuthorID, n.Highlight, n.IsMention)
+			}
+		}
+	}
+	// 每位作者只查询一次，第二次渲染使用缓存
+	if got := memberLookups.Load(); got != 3 {
+		t.Errorf("member lookups = %d, want 3", got)
+	}
+
+	// 没有 bot_token 时不查询身份组
+	serverConfigMu.Lock()
+	serverConfig.BotToken = ""
+	serverConfigMu.Unlock()
+	if opts := viewOptionsFor(PostConfig{FileName: "2025-01.json"}, ViewPrefs{}); opts.AuthorRoles != nil {
+		t.Error("AuthorRoles set without a bot token")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// Session Cookie（HMAC 签名）
+// ==========================================
+
+const (
+	AuthOAuth     = "oauth"   // 通过 Discord OAuth2 登录
+	AuthGuest     = "guest"   // 只读访客（邀请链接或本地账号）
+	AuthAPIKey    = "api_key" // 个人 API Key（不经过登录，只用于 /api/v1）
+	SessionMaxAge = 3600 * 24 * 30
+)
+
+var (
+	sessionSecretOnce sync.Once
+	sessionSecret     []byte
+)
+
+// 签名密钥：server_config.json 的 session_secret，未配置时启动后随机生成
+func getSessionSecret() []byte {
+	sessionSecretOnce.Do(func() {
+		if s := getServerConfig().SessionSecret; s != "" {
+			sessionSecret = []byte(s)
+			return
+		}
+		sessionSecret = make([]byte, 32)
+		rand.Read(sessionSecret)
+		slog.Info("未配置 session_secret，已随机生成（重启后需要重新登录）")
+	})
+	return sessionSecret
+}
+
+func signSession(payload string) string {
+	mac := hmac.New(sha256.New, getSessionSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeSession 把会话编码为 <base64 JSON>.<签名>
+func encodeSession(user *UserSession) (string, error) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signSession(payload), nil
+}
+
+// decodeSession 校验签名并解码会话；OAuth 会话不带 Token，伪造 Cookie 即可冒充成员，所以必须签名
+func decodeSession(value string) (*UserSession, error) {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signSession(payload))) {
+		return nil, errors.New("invalid session signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	var user UserSession
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	if user.UserID == "" {
+		return nil, errors.New("session has no user id")
+	}
+	if user.Expires > 0 && time.Now().Unix() >= user.Expires {
+		return nil, errors.New("session expired")
+	}
+	return &user, nil
+}
+
+// 写入登录 Cookie
+func setSessionCookie(w http.ResponseWriter, user *UserSession) error {
+	value, err := encodeSession(user)
+	if err != nil {
+		return err
+	}
+	maxAge := SessionMaxAge // 30天
+	if user.Expires > 0 {
+		maxAge = min(maxAge, int(user.Expires-time.Now().Unix()))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+	})
+	return nil
+}
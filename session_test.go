@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requestWithCookie(value string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: value})
+	return r
+}
+
+func TestSessionCookieSignature(t *testing.T) {
+	user := &UserSession{UserID: "1", Username: "alice", Auth: AuthOAuth}
+	value, err := encodeSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getCurrentUser(requestWithCookie(value)); got == nil || got.UserID != "1" || got.Username != "alice" {
+		t.Fatalf("valid cookie decoded to %+v", got)
+	}
+
+	payload, sig, _ := strings.Cut(value, ".")
+	forged, _ := json.Marshal(&UserSession{UserID: "2", Username: "mallory", Auth: AuthOAuth})
+	otherSig := signSession(base64.RawURLEncoding.EncodeToString([]byte("{}")))
+	tampered := map[string]string{
+		"payload swapped":  base64.RawURLEncoding.EncodeToString(forged) + "." + sig,
+		"signature edited": payload + "." + otherSig,
+		"unsigned":         payload,
+		"empty signature":  payload + ".",
+	}
+	for name, v := range tampered {
+		if got := getCurrentUser(requestWithCookie(v)); got != nil {
+			t.Errorf("%s: accepted as %+v", name, got)
+		}
+	}
+}
+
+func TestSessionCookieExpiry(t *testing.T) {
+	expired, err := encodeSession(&UserSession{UserID: "1", Auth: AuthOAuth, Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeSession(expired); err == nil {
+		t.Error("expired session accepted")
+	}
+
+	// Cookie 的 MaxAge 不超过会话的剩余有效期
+	user := &UserSession{UserID: "1", Auth: AuthOAuth, Expires: time.Now().Add(time.Hour).Unix()}
+	w := httptest.NewRecorder()
+	if err := setSessionCookie(w, user); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge <= 0 || cookies[0].MaxAge > 3600 {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	if got, err := decodeSession(cookies[0].Value); err != nil || got.UserID != "1" {
+		t.Errorf("decodeSession = %+v, %v", got, err)
+	}
+}
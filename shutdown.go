@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ==========================================
+// 优雅退出 (Ctrl+C / SIGTERM)
+// ==========================================
+
+const (
+	DefaultShutdownTimeout = 30 * time.Second
+	jobCancelGrace         = 5 * time.Second // 超时取消同步任务后，等待它们退出的时间
+)
+
+// serverClosingKey 请求 context 中保存所属服务开始退出时关闭的通道，每次 serveUntil 一个
+type serverClosingKey struct{}
+
+// serverClosing 返回请求所属的服务开始退出时关闭的通道，SSE 等长连接据此结束，否则 Server.Shutdown 会一直等到超时；
+// 不是由 serveUntil 提供服务的请求（例如测试中直接调用 handler）返回 nil，永远不会关闭
+func serverClosing(r *http.Request) <-chan struct{} {
+	ch, _ := r.Context().Value(serverClosingKey{}).(chan struct{})
+	return ch
+}
+
+// serveUntilSignal 启动 HTTP 服务，收到 SIGINT / SIGTERM 后依次：
+// 停止接收新请求并等待进行中的请求、等待同步任务完成（超时则取消）、停止后台任务（实时模式、定期写回）、把 memoryStore 中有变化的月份写回磁盘；
+// 退出期间再按一次 Ctrl+C 会立即结束进程
+func serveUntilSignal(srv *http.Server, timeout time.Duration, stopBackground context.CancelFunc) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err // 例如端口被占用
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop) // 收到第一次信号后恢复默认处理
+	return serveUntil(ctx, srv, ln, timeout, stopBackground)
+}
+
+// serveUntil 在 ln 上提供服务，直到 ctx 取消后按 serveUntilSignal 的步骤退出
+func serveUntil(ctx context.Context, srv *http.Server, ln net.Listener, timeout time.Duration, stopBackground context.CancelFunc) error {
+	closing := make(chan struct{})
+	base := srv.BaseContext
+	srv.BaseContext = func(l net.Listener) context.Context {
+		ctx := context.Background()
+		if base != nil {
+			ctx = base(l)
+		}
+		return context.WithValue(ctx, serverClosingKey{}, closing)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("收到退出信号，正在停止服务", "timeout", timeout)
+	start := time.Now()
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	srv.RegisterOnShutdown(func() { close(closing) })
+	if err := srv.Shutdown(deadline); err != nil {
+		slog.Warn("等待进行中的请求超时，强制关闭连接", logKeyErr, err)
+		srv.Close()
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		slog.Warn("HTTP 服务异常退出", logKeyErr, err)
+	}
+
+	if n := runningJobCount(); n > 0 {
+		slog.Info("等待同步任务完成", "count", n)
+		if !waitSyncJobs(deadline) {
+			slog.Warn("同步任务未在期限内完成，已取消（本次抓取的消息不会写入）", "count", cancelSyncJobs())
+			grace, cancelGrace := context.WithTimeout(context.Background(), jobCancelGrace)
+			defer cancelGrace()
+			if !waitSyncJobs(grace) {
+				slog.Error("同步任务取消后仍未退出", "count", runningJobCount())
+			}
+		}
+	}
+
+	stopBackground()
+	if failed := flushArchives(); failed > 0 {
+		return errors.New("部分存档写回磁盘失败，详见日志")
+	}
+	slog.Info("服务已停止", logKeyDuration, time.Since(start))
+	return nil
+}
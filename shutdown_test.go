@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
+)
+
+const testToken = "user-token"
+
+// startFakeDiscord 启动只有一个帖子（111）的假 Discord，gate 不为 nil 时 messages 请求会等到 gate 关闭
+func startFakeDiscord(t *testing.T, msgs []DiscordMessage, gate chan struct{}) {
+	t.Helper()
+	fake := discord.NewFakeServer("100")
+	fake.AddUser(discord.FakeUser{Token: testToken, ID: "1", Username: "alice"})
+	fake.AddChannel(discord.Channel{ID: "111", ParentID: "110", Type: discord.ChannelTypePublicThread})
+	fake.SeedMessages("111", msgs)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gate != nil && strings.HasSuffix(r.URL.Path, "/messages") {
+			<-gate
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	discord.SetAPIBase(fake.APIBase(ts.URL))
+	t.Cleanup(func() { discord.SetAPIBase("") })
+}
+
+func testMessages(ids ...string) []DiscordMessage {
+	msgs := make([]DiscordMessage, len(ids))
+	for i, id := range ids {
+		msgs[i] = DiscordMessage{ID: id, Content: "msg " + id, Timestamp: "2025-01-01T00:00:00Z", Author: discord.Author{Username: "alice"}}
+	}
+	return msgs
+}
+
+func loadTestArchive(t *testing.T, file string) []DiscordMessage {
+	t.Helper()
+	msgs, err := discord.LoadArchive(filepath.Join(DataDir, file))
+	if err != nil {
+		t.Fatalf("load %s: %v", file, err)
+	}
+	return msgs
+}
+
+// 同步结果在任务结束时就写入磁盘，不依赖正常退出
+func TestSyncJobWritesArchiveImmediately(t *testing.T) {
+	cfg := PostConfig{FileName: "2025-01.json", PostID: "111"}
+	useTestState(t, ServerConfig{}, []PostConfig{cfg})
+	startFakeDiscord(t, testMessages("1000001", "1000002"), nil)
+
+	job, created, _ := startSyncJob(slog.Default(), &UserSession{UserID: "1", Token: testToken}, cfg, false, nil)
+	if !created {
+		t.Fatal("job not created")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !waitSyncJobs(ctx) {
+		t.Fatal("sync job did not finish")
+	}
+	if s := job.snapshot(); s.State != JobDone || s.Added != 2 {
+		t.Fatalf("job = %+v", s)
+	}
+	if got := loadTestArchive(t, cfg.FileName); len(got) != 2 {
+		t.Errorf("archive on disk has %d messages, want 2", len(got))
+	}
+}
+
+// 退出时等待进行中的同步任务、停止后台任务，并写回尚未写入的月份
+func TestShutdownWaitsForJobsAndFlushes(t *testing.T) {
+	synced := PostConfig{FileName: "2025-01.json", PostID: "111"}
+	live := PostConfig{FileName: "2025-02.json", PostID: "222"}
+	useTestState(t, ServerConfig{}, []PostConfig{synced, live})
+	gate := make(chan struct{})
+	startFakeDiscord(t, testMessages("1000001"), gate)
+
+	// 实时模式改过、还没被定期写回的月份
+	storeMu.Lock()
+	setStoredMessages(live.FileName, testMessages("2000001"))
+	storeMu.Unlock()
+	markArchiveDirty(live.FileName)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	srv := &http.Server{Handler: mux}
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	stopped := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntil(ctx, srv, ln, 5*time.Second, func() { close(stopped) })
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	startSyncJob(slog.Default(), &UserSession{UserID: "1", Token: testToken}, synced, false, nil)
+	shutdown()
+	time.Sleep(100 * time.Millisecond) // 退出流程开始后任务仍在抓取
+	select {
+	case err := <-done:
+		t.Fatalf("serveUntil returned before the sync job finished: %v", err)
+	default:
+	}
+	close(gate)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serveUntil did not return")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("background tasks were not stopped")
+	}
+	if got := loadTestArchive(t, synced.FileName); len(got) != 1 {
+		t.Errorf("%s has %d messages, want 1", synced.FileName, len(got))
+	}
+	if got := loadTestArchive(t, live.FileName); len(got) != 1 || got[0].ID != "2000001" {
+		t.Errorf("%s = %+v, want the live update", live.FileName, got)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/healthz"); err == nil {
+		t.Error("server still accepting requests after shutdown")
+	}
+}
+
+// 同一进程中先后启动的服务各自通知自己的长连接退出，第二次退出不会重复关闭通道
+func TestServeUntilTwiceClosesStreams(t *testing.T) {
+	useTestState(t, ServerConfig{}, nil)
+	for i := range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /stream", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-serverClosing(r)
+		})
+		srv := &http.Server{Handler: mux}
+		ctx, shutdown := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- serveUntil(ctx, srv, ln, 5*time.Second, func() {}) }()
+
+		resp, err := http.Get("http://" + ln.Addr().String() + "/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		shutdown()
+		io.Copy(io.Discard, resp.Body) // 服务退出时长连接结束
+		resp.Body.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("run %d: %v", i+1, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("run %d: serveUntil did not return", i+1)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("run %d: shutdown took %v, stream was not closed", i+1, d)
+		}
+	}
+}
@@ -5,54 +5,142 @@ import (
 	"fmt"
 	"strconv"
 	"time"
+
+	"github.com/ColorRabbit/CycleStudies/discord"
 )
 
 // ==========================================
 // 模型定义 (Models)
 // ==========================================
 
-// Discord 原始数据模型
-type DiscordMessage struct {
-	ID          string       `json:"id"`
-	Content     string       `json:"content"`
-	Timestamp   string       `json:"timestamp"`
-	Author      Author       `json:"author"`
-	Attachments []Attachment `json:"attachments"`
-	MsgRef      *MsgRef      `json:"message_reference,omitempty"`
-}
-type Author struct {
-	Username string `json:"username"`
-	Avatar   string `json:"avatar"`
-	ID       string `json:"id"`
-}
-type Attachment struct {
-	URL      string `json:"url"`
-	Filename string `json:"filename"`
+// Discord 原始数据模型（与抓取脚本共用 discord 包中的定义）
+type DiscordMessage = discord.Message
+type Author = discord.Author
+type Attachment = discord.Attachment
+type MsgRef = discord.MsgRef
+
+// 视图渲染模型
+type ViewNode struct {
+	ID          string      `json:"id"`
+	AuthorID    string      `json:"author_id"`
+	AuthorName  string      `json:"author_name"`
+	AuthorRoles []string    `json:"author_roles,omitempty"` // 作者在公会中的身份组，只在规则中有 role 时查询
+	Avatar      string      `json:"avatar"`
+	Time        string      `json:"time"`
+	Content     string      `json:"content"`
+	RawTime     time.Time   `json:"raw_time"`
+	Images      []string    `json:"images,omitempty"`
+	Replies     []*ViewNode `json:"replies,omitempty"`
+	ReplyTarget string      `json:"reply_target,omitempty"`
+	ReplyToID   string      `json:"reply_to_id,omitempty"`
+	ReplyQuote  string      `json:"reply_quote,omitempty"` // 被回复消息的内容摘要
+	// 被回复消息的跳转链接；ReplyMissing 表示原消息已无法找到（被删除或无权限）
+	ReplyPermalink string `json:"reply_permalink,omitempty"`
+	ReplyMissing   bool   `json:"reply_missing,omitempty"`
+	IsReply        bool   `json:"is_reply"`
+	IsMention      bool   `json:"is_mention"`
+	IsMe           bool   `json:"is_me"` // 是否是当前登录用户
+
+	// 高亮规则命中结果：分类、颜色和所有命中的规则名
+	Highlight      string   `json:"highlight,omitempty"`
+	HighlightColor string   `json:"highlight_color,omitempty"`
+	MatchedRules   []string `json:"matched_rules,omitempty"`
+
+	Permalink string      `json:"permalink,omitempty"`
+	Parts     []*ViewNode `json:"parts,omitempty"` // 被合并的各条原始消息（仅合并节点有值）
 }
 
-type MsgRef struct {
-	MessageID string `json:"message_id"`
+// 构建视图时的选项
+type ViewOptions struct {
+	PostID      string        // 帖子(频道) ID，用于生成消息链接
+	GuildID     string        // 所在公会 ID，用于生成消息链接
+	RulesFile   string        // 所在社区的高亮规则文件
+	MergeWindow time.Duration // 同一作者连发消息的合并窗口，<=0 表示不合并
+	Tree        bool          // 树形模式：保留完整回复层级
+	MaxDepth    int           // 树形模式的最大嵌套深度，<=0 表示不限制
+
+	// 父消息不在当前月份时的查找函数（跨月份 / Discord 接口），为 nil 时不做跨月查找
+	ResolveReply func(ref MsgRef) *ReplyContext
+	// 查询作者身份组的函数（role 高亮规则使用），规则文件中有 role 规则且配置了 bot_token 时才设置
+	AuthorRoles func(authorID string) []string
 }
 
-// 视图渲染模型
-type ViewNode struct {
-	ID, AuthorName, Avatar, Time, Content string
-	RawTime                               time.Time
-	Images                                []string
-	Replies                               []*ViewNode
-	ReplyTarget, ReplyToID                string
-	IsReply                               bool
-	IsMention                             bool
-	IsMe                                  bool // 是否是当前登录用户
+// 跨月份解析到的被回复消息
+type ReplyContext struct {
+	Message   DiscordMessage
+	ChannelID string // 所在帖子(频道) ID
+	FileName  string // 所在的存档文件，为空表示来自 Discord 接口
 }
 
 // 页面数据包
 type PageData struct {
-	NavItems    []NavItem
+	NavGroups   []NavGroup // 侧边栏按社区分组
 	Messages    []*ViewNode
 	ActiveFile  string
 	ProxyInfo   string
 	CurrentUser *UserSession
+	Prefs       ViewPrefs
+	Role        string // 当前用户的查看器角色
+	CanSync     bool   // 可以抓取最新消息 / 回填
+	JobID       string // 正在进行的后台同步任务，页面据此订阅进度
+	Live        bool   // 实时模式已开启，页面订阅 /live/events
+}
+
+// 管理页数据
+type AdminPageData struct {
+	CurrentUser *UserSession
+	Communities []AdminCommunity
+	Message     string
+	Error       string
+}
+
+// 管理页中一个社区的可编辑配置（JSON 文本）
+type AdminCommunity struct {
+	Ref, Name                  string
+	PostConfigFile, PostConfig string
+	RulesFile, Rules           string
+}
+
+// 审计记录（audit.log 中的一行）
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	UserID    string    `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Action    string    `json:"action"`           // login / refresh / sync / admin_posts ...
+	Target    string    `json:"target,omitempty"` // 月份文件名、配置文件或请求路径
+	Result    string    `json:"result"`           // ok / failed / joined / done / partial ...
+	Added     int       `json:"added,omitempty"`  // 同步新增的消息条数
+	Total     int       `json:"total,omitempty"`  // 同步后的消息总数
+	IP        string    `json:"ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"` // 与运行日志中的 request_id 对应
+	Detail    string    `json:"detail,omitempty"`     // 登录方式、错误信息等
+}
+
+// 审计日志筛选条件（查询参数）
+type AuditFilter struct {
+	User, Action, Target, Result string
+	Since, Until                 string // 2006-01-02
+	Limit                        int
+	since, until                 time.Time
+}
+
+// 审计日志页数据
+type AuditPageData struct {
+	CurrentUser      *UserSession
+	Filter           AuditFilter
+	Entries          []AuditEntry
+	Actions, Results []string
+	Error            string
+}
+
+// 用户个人的查看偏好（保存在 Cookie 中）
+type ViewPrefs struct {
+	NoMerge bool // 关闭连发消息合并
+	Tree    bool // 使用树形回复视图
+}
+type NavGroup struct {
+	Name  string
+	Items []NavItem
 }
 type NavItem struct {
 	MonthStr, Title, SubTitle, FileName, Count string
@@ -65,6 +153,12 @@ type UserSession struct {
 	UserID   string `json:"id"`
 	Username string `json:"username"`
 	Avatar   string `json:"avatar"`
+	Auth     string `json:"auth,omitempty"` // 登录方式：AuthOAuth、AuthGuest、AuthAPIKey 或为空（User Token）
+	// OAuth 登录时确认过成员身份的社区 ID / 访客可查看的社区 ID（没有 Token 时据此判断能进入哪些社区）
+	Communities []string `json:"communities,omitempty"`
+	Expires     int64    `json:"exp,omitempty"` // 过期时间（Unix 秒），访客会话使用，0 为不过期
+	// 登录时记录的 Discord 身份组 ID（只在配置了按身份组映射的角色时获取），身份组变化需重新登录
+	Roles []string `json:"roles,omitempty"`
 }
 
 // 限流日志
@@ -73,22 +167,10 @@ type RateLog struct {
 }
 
 // 如果 Discord 返回该字段，表示该频道对不同对象的权限覆盖
-type Overwrite struct {
-	ID    string `json:"id"`
-	Type  int    `json:"type"` // 0 = role, 1 = member
-	Allow string `json:"allow"`
-	Deny  string `json:"deny"`
-}
+type Overwrite = discord.PermissionOverwrite
 
 // Discord API 返回的频道对象
-type DiscordChannel struct {
-	ID                   string      `json:"id"`
-	Name                 string      `json:"name"`
-	GuildID              string      `json:"guild_id"`
-	Type                 int         `json:"type"`
-	Position             int         `json:"position"`
-	PermissionOverwrites []Overwrite `json:"permission_overwrites"`
-}
+type DiscordChannel = discord.Channel
 
 type Uint64Like struct {
 	V uint64
@@ -114,10 +196,153 @@ func (u *Uint64Like) UnmarshalJSON(b []byte) error {
 	return fmt.Errorf("invalid uint64 like: %s", string(b))
 }
 
-type PostConfig struct {
-	MonthStr string `json:"month_str"`
-	Title    string `json:"title"`
-	SubTitle string `json:"sub_title"`
-	FileName string `json:"file_name"`
-	PostID   string `json:"post_id"`
+// 月份配置（与抓取脚本共用 discord 包中的定义）
+type PostConfig = discord.PostConfig
+
+// 服务端配置 (server_config.json)
+type ServerConfig struct {
+	APIKeys            []APIKey          `json:"api_keys"`             // JSON API 的个人密钥
+	MergeWindowMinutes int               `json:"merge_window_minutes"` // 连发消息合并窗口，0 为默认 5 分钟，负数关闭合并
+	TreeMaxDepth       int               `json:"tree_max_depth"`       // 树形回复的最大深度，0 为默认值，负数不限制
+	Live               LiveConfig        `json:"live"`                 // 实时模式
+	APIBase            string            `json:"api_base"`             // Discord API 地址，为空时使用官方地址，测试时可指向 fake-discord
+	BotToken           string            `json:"bot_token"`            // 服务端 Bot Token，配置后同步与权限检查都使用它，不再使用成员的个人 Token
+	OAuth              OAuthConfig       `json:"oauth"`                // Discord OAuth2 登录
+	SessionSecret      string            `json:"session_secret"`       // 签名 Session Cookie 的密钥，为空时每次启动随机生成（重启后需重新登录）
+	Communities        []CommunityConfig `json:"communities"`          // 同时托管的其他社区（默认社区始终存在）
+	GuestAccounts      []GuestAccount    `json:"guest_accounts"`       // 只读访客的本地账号
+	Roles              RolesConfig       `json:"roles"`                // 查看器角色（viewer / syncer / admin）
+	Audit              AuditConfig       `json:"audit"`                // 审计日志
+	Log                LogConfig         `json:"log"`                  // 运行日志格式与级别
+	Metrics            MetricsConfig     `json:"metrics"`              // /metrics 运行指标
+	Health             HealthConfig      `json:"health"`               // /readyz 就绪检查
+}
+
+// 就绪检查配置
+type HealthConfig struct {
+	DiscordProbe bool `json:"discord_probe"` // 就绪检查时通过代理访问 Discord，确认网络可达
+}
+
+// /readyz 的响应
+type ReadyStatus struct {
+	Status string                 `json:"status"` // ok / fail
+	Checks map[string]HealthCheck `json:"checks"` // config / data_dir / archives / discord
+}
+
+// 单个子系统的检查结果
+type HealthCheck struct {
+	Status  string         `json:"status"` // ok / fail / skipped
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// 运行指标配置
+type MetricsConfig struct {
+	Token string `json:"token"` // 非空时抓取 /metrics 需带 Authorization: Bearer <token>；为空时只允许本机访问
+}
+
+// 运行日志配置
+type LogConfig struct {
+	Format string `json:"format"` // text（默认）或 json
+	Level  string `json:"level"`  // debug / info（默认）/ warn / error
+}
+
+// 审计日志配置，零值使用默认值
+type AuditConfig struct {
+	File              string `json:"file"`                // 默认 audit.log
+	MaxSizeMB         int    `json:"max_size_mb"`         // 单个文件超过该大小时轮转，默认 10
+	MaxFiles          int    `json:"max_files"`           // 保留的轮转文件数，默认 5
+	TrustForwardedFor bool   `json:"trust_forwarded_for"` // 部署在反向代理后时，从 X-Forwarded-For 读取客户端 IP
+}
+
+// 查看器角色配置：先匹配 admin，再匹配 syncer，都不匹配时使用 default
+type RolesConfig struct {
+	Default string      `json:"default"` // viewer / syncer / admin，为空时为 syncer
+	Admin   RoleMapping `json:"admin"`
+	Syncer  RoleMapping `json:"syncer"`
+}
+
+// 角色映射：用户 ID 或拥有任一 Discord 身份组即匹配
+type RoleMapping struct {
+	UserIDs      []string `json:"user_ids"`
+	DiscordRoles []string `json:"discord_roles"`
+}
+
+// 只读访客账号：不需要 Discord 账号，只能浏览已同步的存档
+type GuestAccount struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"` // 用 hash-password 子命令生成
+	Communities  []string `json:"communities"`   // 可查看的社区 ID，默认社区写作 "default"，为空表示全部社区
+	ExpiresAt    string   `json:"expires_at"`    // 到期日期 2006-01-02（当天有效），为空表示不过期
+}
+
+// 社区配置：某个公会中的一个学习群，拥有各自的入口频道、月份列表、存档目录和高亮规则
+type CommunityConfig struct {
+	ID             string `json:"id"`   // 唯一标识，存档保存在 data/<id>/，月份文件名以 "<id>/" 为前缀；为空表示修改默认社区
+	Name           string `json:"name"` // 侧边栏分组标题
+	GuildID        string `json:"guild_id"`
+	ChannelID      string `json:"channel_id"`      // 入口频道，能查看该频道的成员才能进入社区
+	PostConfig     string `json:"post_config"`     // 月份列表文件，默认 post_config.<id>.json
+	HighlightRules string `json:"highlight_rules"` // 高亮规则文件，默认 highlight_rules.<id>.json，不存在时使用默认规则
+}
+
+// Discord OAuth2 登录配置，client_id 为空时不开启
+type OAuthConfig struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"` // 环境变量 DISCORD_CLIENT_SECRET 优先
+	RedirectURL  string   `json:"redirect_url"`  // 为空时为 http://localhost:<端口>/oauth/callback，需与 Discord 应用中填写的一致
+	AuthorizeURL string   `json:"authorize_url"` // 为空时根据 api_base 推导，测试时可指向 fake-discord
+	TokenURL     string   `json:"token_url"`
+	AllowedRoles []string `json:"allowed_roles"` // 非空时成员需拥有其中任一角色才能登录
+}
+
+// 实时模式配置：通过 Gateway 接收配置帖子中的新消息 / 编辑 / 删除
+type LiveConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Token      string `json:"token"`       // 为空时依次使用 bot_token、环境变量 DISCORD_TOKEN
+	GatewayURL string `json:"gateway_url"` // 为空时使用 Discord 官方地址，测试时可指向本地假 Gateway
+}
+
+// 个人 API Key，请求时通过 "Authorization: Bearer <key>" 或 "X-API-Key" 传入。
+// 只能查看 communities 中列出的社区（默认社区写作 "default"），且按 user_id 的 Discord 权限过滤帖子；
+// communities 必须显式填写，避免新增社区后旧 Key 自动获得访问权
+type APIKey struct {
+	Key         string   `json:"key"`
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	Communities []string `json:"communities"`
+}
+
+// 高亮规则 (highlight_rules.json)
+type HighlightRule struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`               // keyword / regex / author / role（需要 bot_token）/ has_attachment
+	Values   []string `json:"values,omitempty"`   // 关键词、正则、作者ID 或 角色ID，任意一个命中即可
+	Exclude  bool     `json:"exclude,omitempty"`  // 排除规则：命中后整条消息不高亮
+	Priority int      `json:"priority,omitempty"` // 数值越大越优先决定分类
+	Category string   `json:"category,omitempty"` // 高亮分类名
+	Color    string   `json:"color,omitempty"`    // 分类颜色，如 #faa61a
+}
+
+// 后台同步任务状态，/jobs/{id} 与 SSE 事件中返回
+type SyncJobStatus struct {
+	ID         string                `json:"id"`
+	FileName   string                `json:"file_name"`
+	PostID     string                `json:"post_id"`
+	Backfill   bool                  `json:"backfill,omitempty"` // 从头重新抓取整个月份
+	UserID     string                `json:"user_id"`
+	Username   string                `json:"username"`
+	Waiters    []string              `json:"waiters,omitempty"` // 等待该任务结果的用户 ID（含发起者），只返回给管理员
+	State      string                `json:"state"`             // running / done / partial / failed / cancelled
+	Progress   discord.FetchProgress `json:"progress"`
+	Added      int                   `json:"added"`
+	Total      int                   `json:"total"`
+	Error      string                `json:"error,omitempty"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt time.Time             `json:"finished_at,omitzero"`
+}
+
+// Finished 任务是否已结束（成功、部分成功、失败或取消）
+func (s SyncJobStatus) Finished() bool {
+	return s.State != "" && s.State != JobRunning
 }
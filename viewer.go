@@ -13,7 +13,7 @@ import (
 // ==========================================
 // 视图逻辑 (View & Templates)
 // ==========================================
-func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
+func buildViewNodes(raw []DiscordMessage, myID string, opts ViewOptions) []*ViewNode {
 	nodeMap := make(map[string]*ViewNode)
 	var mainAxis []*ViewNode
 
@@ -32,9 +32,16 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 			replyToID = m.MsgRef.MessageID
 		}
 
+		var roles []string
+		if opts.AuthorRoles != nil {
+			roles = opts.AuthorRoles(m.Author.ID)
+		}
+
 		node := &ViewNode{
 			ID:          m.ID,
+			AuthorID:    m.Author.ID,
 			AuthorName:  m.Author.Username,
+			AuthorRoles: roles,
 			Avatar:      getAvatar(m.Author.ID, m.Author.Avatar),
 			Time:        t.Format("2006-01-02 15:04"),
 			RawTime:     t,
@@ -45,11 +52,13 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 			IsReply:     false,
 			IsMention:   false,
 			IsMe:        isMe,
+			Permalink:   messagePermalink(opts.GuildID, opts.PostID, m.ID),
 		}
 		nodeMap[m.ID] = node
 	}
 
-	// 第二步：构建“根消息 + 扁平回复流”结构
+	// 第二步：构建回复结构
+	// 扁平模式（默认）为“根消息 + 扁平回复流”，树形模式保留完整的回复层级
 	findRoot := func(node *ViewNode) *ViewNode {
 		visited := map[string]bool{}
 		curr := node
@@ -69,6 +78,30 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 		return curr
 	}
 
+	// 树形模式下找到应挂载的父节点：默认为直接父消息，超过 MaxDepth 时挂到该深度的祖先上；
+	// 回复链成环时返回 nil，作为主轴消息处理
+	findTreeParent := func(node *ViewNode) *ViewNode {
+		var chain []*ViewNode // 从直接父消息到根消息
+		visited := map[string]bool{node.ID: true}
+		for curr := nodeMap[node.ReplyToID]; curr != nil; curr = nodeMap[curr.ReplyToID] {
+			if visited[curr.ID] {
+				return nil
+			}
+			visited[curr.ID] = true
+			chain = append(chain, curr)
+			if curr.ReplyToID == "" {
+				break
+			}
+		}
+		if len(chain) == 0 {
+			return nil
+		}
+		if opts.MaxDepth > 0 && len(chain) > opts.MaxDepth {
+			return chain[len(chain)-opts.MaxDepth]
+		}
+		return chain[0]
+	}
+
 	for _, m := range raw {
 		curr := nodeMap[m.ID]
 
@@ -76,12 +109,32 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 			if parent, ok := nodeMap[m.MsgRef.MessageID]; ok {
 				curr.IsReply = true
 				curr.ReplyTarget = parent.AuthorName
+				curr.ReplyQuote = quoteSnippet(parent.Content)
+				curr.ReplyPermalink = parent.Permalink
 
-				root := findRoot(curr)
-				if root != nil && root.ID != curr.ID {
-					root.Replies = append(root.Replies, curr)
-					continue
+				if opts.Tree {
+					if target := findTreeParent(curr); target != nil {
+						target.Replies = append(target.Replies, curr)
+						continue
+					}
+				} else {
+					root := findRoot(curr)
+					if root != nil && root.ID != curr.ID {
+						root.Replies = append(root.Replies, curr)
+						continue
+					}
+				}
+			} else if m.MsgRef.MessageID != "" {
+				// 父消息不在本月：跨月份查找，找不到则标记为原消息不可用，仍作为主轴消息展示
+				curr.IsReply = true
+				if opts.ResolveReply != nil {
+					if ctx := opts.ResolveReply(*m.MsgRef); ctx != nil {
+						curr.ReplyTarget = ctx.Message.Author.Username
+						curr.ReplyQuote = quoteSnippet(ctx.Message.Content)
+						curr.ReplyPermalink = messagePermalink(opts.GuildID, ctx.ChannelID, ctx.Message.ID)
+					}
 				}
+				curr.ReplyMissing = curr.ReplyTarget == ""
 			}
 		}
 
@@ -94,19 +147,29 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 			return nil
 		}
 
-		// A. 执行合并 (保持5分钟限制，保持时间线清晰)
+		// A. 执行合并 (同一作者 ID、合并窗口内的连发消息，保持时间线清晰)
 		var merged []*ViewNode
 		var last *ViewNode
 		for _, curr := range nodes {
 			shouldMerge := false
-			if last != nil && last.AuthorName == curr.AuthorName {
+			if last != nil && opts.MergeWindow > 0 && last.AuthorID == curr.AuthorID {
 				diff := curr.RawTime.Sub(last.RawTime)
-				if diff >= 0 && diff <= 5*time.Minute {
+				if diff >= 0 && diff <= opts.MergeWindow {
 					shouldMerge = true
 				}
 			}
 
 			if shouldMerge {
+				// 首次合并时先保存第一条消息自身的快照，之后每条消息作为独立的 Part 保留
+				if len(last.Parts) == 0 {
+					first := *last
+					first.Replies = nil
+					last.Parts = append(last.Parts, &first)
+				}
+				part := *curr
+				part.Replies = nil
+				last.Parts = append(last.Parts, &part)
+
 				if curr.Content != "" {
 					if last.Content != "" {
 						last.Content += "\n\n" + curr.Content
@@ -123,16 +186,11 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 			}
 		}
 
-		// B. 高亮判定
+		// B. 高亮判定 (规则见 highlight_rules.json)，合并节点的每个 Part 也单独判定
 		for _, node := range merged {
-			hasEveryone := strings.Contains(node.Content, "@everyone")
-			hqQuestion := strings.Contains(node.Content, "优质问题")
-			hqQuestion2 := strings.Contains(node.Content, "优质提问")
-			isNewbieQA := strings.Contains(node.Content, "新手问答")
-			if (hasEveryone || hqQuestion || hqQuestion2) && !isNewbieQA {
-				node.IsMention = true
-			} else {
-				node.IsMention = false
+			applyHighlightRules(node, opts.RulesFile)
+			for _, part := range node.Parts {
+				applyHighlightRules(part, opts.RulesFile)
 			}
 		}
 
@@ -140,8 +198,10 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 		for i := len(merged) - 1; i > 0; i-- {
 			curr := merged[i]
 			prev := merged[i-1]
-			if curr.IsMention && curr.AuthorName == prev.AuthorName {
+			if curr.IsMention && !prev.IsMention && curr.AuthorID == prev.AuthorID {
 				prev.IsMention = true
+				prev.Highlight = curr.Highlight
+				prev.HighlightColor = curr.HighlightColor
 			}
 		}
 
@@ -161,6 +221,27 @@ func buildViewNodes(raw []DiscordMessage, myID string) []*ViewNode {
 	return finalRoot
 }
 
+// quoteSnippet 截取被回复消息的开头作为引用
+func quoteSnippet(content string) string {
+	const maxRunes = 80
+	runes := []rune(strings.TrimSpace(content))
+	if len(runes) > maxRunes {
+		return string(runes[:maxRunes]) + "…"
+	}
+	return string(runes)
+}
+
+// messagePermalink 生成 Discord 消息跳转链接
+func messagePermalink(guildID, channelID, msgID string) string {
+	if channelID == "" {
+		return ""
+	}
+	if guildID == "" {
+		guildID = GuildID
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, msgID)
+}
+
 func getAvatar(id, hash string) string {
 	if hash == "" {
 		return "https://cdn.discordapp.com/embed/avatars/0.png"
@@ -193,19 +274,29 @@ func renderLogin(w http.ResponseWriter, errStr string) {
         h2 { text-align: center; color: #fff; margin-bottom: 20px; }
         .input-group { margin-bottom: 20px; }
         label { display: block; margin-bottom: 8px; font-size: 12px; font-weight: bold; text-transform: uppercase; color: #b9bbbe; }
-        input[type="password"] { width: 100%; padding: 10px; background: #202225; border: 1px solid #202225; border-radius: 3px; color: #dcddde; box-sizing: border-box; }
+        input[type="password"], input[type="text"] { width: 100%; padding: 10px; background: #202225; border: 1px solid #202225; border-radius: 3px; color: #dcddde; box-sizing: border-box; }
         input:focus { outline: none; border-color: #7289da; }
         button { width: 100%; background: #5865f2; color: white; padding: 12px; border: none; border-radius: 3px; cursor: pointer; font-size: 16px; transition: 0.2s; }
         button:hover { background: #4752c4; }
         .error { color: #f04747; font-size: 14px; margin-bottom: 15px; text-align: center; }
         .help { font-size: 12px; color: #72767d; margin-top: 15px; line-height: 1.5; }
+        .oauth-btn { display: block; text-align: center; background: #5865f2; color: white; padding: 12px; border-radius: 3px; text-decoration: none; font-size: 16px; }
+        .oauth-btn:hover { background: #4752c4; }
+        .fallback { margin-top: 20px; font-size: 13px; color: #b9bbbe; }
+        .fallback summary { cursor: pointer; margin-bottom: 15px; }
+        .guest-form { margin-top: 20px; padding-top: 20px; border-top: 1px solid #202225; }
     </style>
 </head>
 <body>
     <div class="login-box">
         <h2>🔐 身份验证</h2>
-        {{if .}}<div class="error">{{.}}</div>{{end}}
-        <form method="POST">
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+        {{if .OAuth}}
+        <a class="oauth-btn" href="/oauth/login">使用 Discord 登录</a>
+        <details class="fallback">
+            <summary>使用 User Token 登录（不推荐）</summary>
+        {{end}}
+        <form method="POST" action="/login">
             <div class="input-group">
                 <label>User Token</label>
                 <input type="password" name="token" placeholder="请输入您的 Discord User Token" required>
@@ -219,12 +310,29 @@ func renderLogin(w http.ResponseWriter, errStr string) {
             3. 刷新页面，在过滤器输入 "credentials"<br>
             4. 点击请求，在 Request Headers 中找到 "Authorization"
         </div>
+        {{if .OAuth}}</details>{{end}}
+        {{if .Guest}}
+        <form method="POST" action="/login" class="guest-form">
+            <div class="input-group">
+                <label>访客账号</label>
+                <input type="text" name="username" placeholder="用户名" required>
+            </div>
+            <div class="input-group">
+                <input type="password" name="password" placeholder="密码" required>
+            </div>
+            <button type="submit">以访客身份只读登录</button>
+        </form>
+        {{end}}
     </div>
 </body>
 </html>
 `
 	t, _ := template.New("login").Parse(tpl)
-	t.Execute(w, errStr)
+	t.Execute(w, struct {
+		Error string
+		OAuth bool // 配置了 OAuth2 时优先显示 Discord 登录按钮，Token 登录收起为备选
+		Guest bool // 配置了访客账号时显示用户名/密码登录
+	}{errStr, oauthEnabled(), guestAccountsEnabled()})
 }
 
 func renderHome(w http.ResponseWriter, data PageData) {
@@ -244,11 +352,14 @@ func renderHome(w http.ResponseWriter, data PageData) {
     .user-avatar { width: 32px; height: 32px; border-radius: 50%; margin-right: 10px; }
     .user-info { flex: 1; overflow: hidden; }
     .user-name { color: #fff; font-weight: bold; font-size: 14px; }
+    .user-role { font-size: 11px; font-weight: normal; color: #72767d; }
     .btn-logout { font-size: 12px; color: #f04747; text-decoration: none; cursor: pointer; }
+    .btn-pref { font-size: 12px; color: #8E9297; text-decoration: none; margin-left: 8px; }
     
     .nav-list { flex: 1; overflow-y: auto; padding: 10px; }
     .nav-item { display: flex; align-items: stretch; background: var(--sidebar-item-bg); margin-bottom: 10px; border-radius: 4px; cursor: pointer; transition: 0.2s; border: 1px solid transparent; text-decoration: none; }
     .nav-item:hover { background: #36393f; }
+    .nav-group { font-size: 12px; font-weight: bold; text-transform: uppercase; color: #8e9297; margin: 12px 4px 8px; }
     .nav-item.active { border-left: 4px solid var(--active-border); background: #36393f; }
     .month-box { width: 60px; display: flex; align-items: center; justify-content: center; font-size: 20px; font-weight: bold; color: #FFF; border-right: 1px solid #202225; }
     .meta-box { flex: 1; padding: 10px; display: flex; flex-direction: column; justify-content: center; }
@@ -271,6 +382,10 @@ func renderHome(w http.ResponseWriter, data PageData) {
     .user-row { margin-bottom: 8px; }
     .username { color: #E91E63; font-weight: bold; font-size: 15px; margin-right: 10px; }
     .timestamp { color: #999; font-size: 12px; }
+    .timestamp a, .part-time a { color: inherit; text-decoration: none; }
+    .msg-part { padding: 2px 0 2px 6px; border-left: 3px solid transparent; }
+    .msg-part.mentioned { border-left-color: #faa61a; }
+    .part-time { color: #bbb; font-size: 11px; }
     .msg-text { font-size: 15px; line-height: 1.7; color: #2e3338; white-space: pre-wrap; margin-bottom: 10px; }
     
     .img-grid { display: flex; flex-wrap: wrap; gap: 10px; margin-top: 10px; }
@@ -279,6 +394,12 @@ func renderHome(w http.ResponseWriter, data PageData) {
     .reply-list { background: #F5F7FA; border-radius: 8px; padding: 10px 15px; margin-top: 10px; }
     .reply-item { margin-bottom: 8px; font-size: 13px; line-height: 1.5; color: #555; white-space: normal; }
     .reply-content { white-space: pre-wrap; }
+    .tree-node { margin: 4px 0; }
+    .tree-node > summary { cursor: pointer; list-style-position: outside; }
+    .tree-children { margin-left: 18px; padding-left: 10px; border-left: 2px solid #e3e5e8; }
+    .tree-content { display: block; font-size: 13px; color: #2e3338; white-space: pre-wrap; margin: 2px 0 6px; }
+    .reply-quote { margin: 2px 0; padding: 2px 8px; border-left: 3px solid #ccc; color: #888; font-size: 12px; }
+    .tree-count { color: #00AEEC; font-size: 12px; margin-left: 8px; }
     .reply-item.mentioned { background-color: rgba(250, 166, 26, 0.15); border-left: 3px solid #faa61a; padding: 5px; border-radius: 0 4px 4px 0;}
     .reply-user { color: #E91E63; font-weight: bold; margin-right: 5px; }
     .reply-at { color: #00AEEC; margin: 0 5px; }
@@ -289,19 +410,29 @@ func renderHome(w http.ResponseWriter, data PageData) {
 </style>
 </head>
 <body>
-<div id="loading">🔄 正在同步...</div>
+<div id="loading"><div style="text-align:center;">
+    <div id="loading-text">🔄 正在同步...</div>
+    <button id="loading-cancel" style="display:none; margin-top:12px;" onclick="cancelJob()">取消同步</button>
+</div></div>
+<div id="live-banner" style="display:none; position:fixed; top:10px; left:50%; transform:translateX(-50%); z-index:90; background:#00AEEC; color:#fff; padding:8px 16px; border-radius:16px; cursor:pointer;" onclick="window.location.reload()"></div>
 <div id="lightbox" onclick="this.style.display='none'"><img id="lb-img"></div>
 
 <div class="sidebar">
     <div class="user-panel">
         <img class="user-avatar" src="{{.CurrentUser.Avatar}}">
         <div class="user-info">
-            <div class="user-name">{{.CurrentUser.Username}}</div>
+            <div class="user-name">{{.CurrentUser.Username}} <span class="user-role">{{.Role}}</span></div>
             <a href="/logout" class="btn-logout">退出登录</a>
+            {{if eq .Role "admin"}}<a href="/admin" class="btn-pref">管理</a>{{end}}
+            <a href="/prefs?merge={{if .Prefs.NoMerge}}on{{else}}off{{end}}&f={{.ActiveFile}}" class="btn-pref">{{if .Prefs.NoMerge}}开启{{else}}关闭{{end}}消息合并</a>
+            <a href="/prefs?mode={{if .Prefs.Tree}}flat{{else}}tree{{end}}&f={{.ActiveFile}}" class="btn-pref">{{if .Prefs.Tree}}扁平{{else}}树形{{end}}回复</a>
         </div>
     </div>
     <div class="nav-list">
-        {{range .NavItems}}
+        {{$grouped := gt (len .NavGroups) 1}}
+        {{range .NavGroups}}
+        {{if $grouped}}<div class="nav-group">{{.Name}}</div>{{end}}
+        {{range .Items}}
         <a href="/?f={{.FileName}}" class="nav-item {{if .IsActive}}active{{end}}">
             <div class="month-box">{{.MonthStr}}</div>
             <div class="meta-box">
@@ -311,6 +442,7 @@ func renderHome(w http.ResponseWriter, data PageData) {
             </div>
         </a>
         {{end}}
+        {{end}}
     </div>
 </div>
 
@@ -318,26 +450,50 @@ func renderHome(w http.ResponseWriter, data PageData) {
     <div class="chat-container">
         <div class="refresh-bar">
             <span style="font-size:12px;color:#999">网络: {{if .ProxyInfo}}{{.ProxyInfo}}{{else}}直连{{end}}</span>
-            <button onclick="confirmRefresh('{{.ActiveFile}}')" class="btn-refresh">⚡ 抓取最新消息</button>
+            {{if .CanSync}}<form method="POST" action="/refresh" onsubmit="return confirmRefresh(event)">
+                <input type="hidden" name="f" value="{{.ActiveFile}}">
+                <button type="submit" class="btn-refresh">⚡ 抓取最新消息</button>
+                <button type="submit" name="full" value="1" class="btn-refresh" title="忽略已有存档，从头重新抓取整个月份">⏮️ 回填整月</button>
+            </form>{{else}}<span style="font-size:12px;color:#999">👀 只读</span>{{end}}
         </div>
         
         {{if .Messages}}
             {{range .Messages}}
-            <div class="msg-group {{if .IsMention}}mentioned{{end}} {{if .IsMe}}is-me{{end}}">
+            <div class="msg-group {{if .IsMention}}mentioned{{end}} {{if .IsMe}}is-me{{end}}"{{if .HighlightColor}} style="border-left-color: {{.HighlightColor}}"{{end}}{{if .MatchedRules}} title="{{join .MatchedRules ", "}}"{{end}}>
                 <img class="avatar" src="{{.Avatar}}">
                 <div class="msg-body">
                     <div class="user-row">
                         <span class="username">{{.AuthorName}}</span>
-                        <span class="timestamp">{{.Time}}</span>
+                        <span class="timestamp">{{if .Permalink}}<a href="{{.Permalink}}" target="_blank">{{.Time}}</a>{{else}}{{.Time}}{{end}}</span>
                     </div>
-                    <div class="msg-text">{{.Content | formatMsg}}</div>
+                    {{if .ReplyMissing}}
+                    <blockquote class="reply-quote">↩ 原消息不可用</blockquote>
+                    {{else if .IsReply}}
+                    <blockquote class="reply-quote">↩ 回复 @{{.ReplyTarget}}：{{.ReplyQuote}}{{if .ReplyPermalink}} <a href="{{.ReplyPermalink}}" target="_blank">查看原消息</a>{{end}}</blockquote>
+                    {{end}}
+                    {{if .Parts}}
+                    {{range .Parts}}
+                    <div class="msg-part {{if .IsMention}}mentioned{{end}}" id="m{{.ID}}">
+                        <span class="part-time">{{if .Permalink}}<a href="{{.Permalink}}" target="_blank">{{.Time}}</a>{{else}}{{.Time}}{{end}}</span>
+                        {{if .Content}}<div class="msg-text">{{.Content | formatMsg}}</div>{{end}}
+                        {{if .Images}}
+                        <div class="img-grid">{{range .Images}}<img class="chat-img" src="{{.}}" onclick="viewImg(this.src)">{{end}}</div>
+                        {{end}}
+                    </div>
+                    {{end}}
+                    {{else}}
+                    <div class="msg-text" id="m{{.ID}}">{{.Content | formatMsg}}</div>
                     {{if .Images}}
                     <div class="img-grid">{{range .Images}}<img class="chat-img" src="{{.}}" onclick="viewImg(this.src)">{{end}}</div>
                     {{end}}
+                    {{end}}
                     {{if .Replies}}
+                    {{if $.Prefs.Tree}}
+                    <div class="reply-list reply-tree">{{template "treeReplies" .Replies}}</div>
+                    {{else}}
                     <div class="reply-list">
                         {{range .Replies}}
-                        <div class="reply-item {{if .IsMention}}mentioned{{end}}">
+                        <div class="reply-item {{if .IsMention}}mentioned{{end}}"{{if .HighlightColor}} style="border-left-color: {{.HighlightColor}}"{{end}}>
                             <span class="reply-user">{{.AuthorName}}</span>回复 <span class="reply-at">@{{.ReplyTarget}}</span> : 
                             <span class="reply-content">{{.Content | formatMsg}}</span>
                             {{if .Images}}<span style="color:#00AEEC;cursor:pointer" onclick="viewImg('{{index .Images 0}}')">[图片]</span>{{end}}
@@ -346,6 +502,7 @@ func renderHome(w http.ResponseWriter, data PageData) {
                         {{end}}
                     </div>
                     {{end}}
+                    {{end}}
                 </div>
             </div>
             {{end}}
@@ -356,20 +513,82 @@ func renderHome(w http.ResponseWriter, data PageData) {
     </div>
 </div>
 
+{{define "treeReplies"}}
+{{range .}}
+<details class="tree-node" open>
+    <summary class="reply-item {{if .IsMention}}mentioned{{end}}">
+        <span class="reply-user">{{.AuthorName}}</span>回复 <span class="reply-at">@{{.ReplyTarget}}</span>
+        <span style="color:#999; margin-left:8px; font-size:12px;">{{if .Permalink}}<a href="{{.Permalink}}" target="_blank" style="color:inherit">{{.Time}}</a>{{else}}{{.Time}}{{end}}</span>
+        {{if .Replies}}<span class="tree-count">{{len .Replies}} 条回复</span>{{end}}
+    </summary>
+    {{if .ReplyQuote}}<blockquote class="reply-quote">{{.ReplyQuote}}</blockquote>{{end}}
+    <div class="reply-content tree-content">{{.Content | formatMsg}}</div>
+    {{if .Images}}<div class="img-grid">{{range .Images}}<img class="chat-img" src="{{.}}" onclick="viewImg(this.src)">{{end}}</div>{{end}}
+    {{if .Replies}}<div class="tree-children">{{template "treeReplies" .Replies}}</div>{{end}}
+</details>
+{{end}}
+{{end}}
+
 <script>
 function viewImg(src) { document.getElementById('lb-img').src = src; document.getElementById('lightbox').style.display = 'flex'; }
-function confirmRefresh(file) {
-    if(confirm('抓取最新消息需要使用您的 Token 发送请求。\n\n确定继续吗？')) {
-        document.getElementById('loading').style.display='flex';
-        window.location.href = '/refresh?f=' + file;
-    }
+// 抓取会发起请求并计入刷新次数，通过 POST 表单提交，确认后才发送
+function confirmRefresh(e) {
+    const full = e.submitter && e.submitter.name === 'full';
+    const hint = full ? '回填会从头重新抓取整个月份，请求次数较多。' : '抓取最新消息需要使用您的 Token 发送请求。';
+    if (!confirm(hint + '\n\n确定继续吗？')) return false;
+    document.getElementById('loading').style.display='flex';
+    return true;
+}
+
+// 订阅后台同步任务进度，结束后重新加载当前月份
+const jobID = '{{.JobID}}';
+// 同一月份的刷新可能由多人共享，只有所有等待者都取消后任务才会真正停止
+function cancelJob() {
+    fetch('/jobs/' + jobID + '/cancel', {method: 'POST'}).then(() => {
+        window.location.href = '/?f=' + encodeURIComponent('{{.ActiveFile}}');
+    });
+}
+if (jobID) {
+    const text = document.getElementById('loading-text');
+    document.getElementById('loading').style.display = 'flex';
+    document.getElementById('loading-cancel').style.display = 'inline-block';
+    const es = new EventSource('/jobs/' + jobID + '/events');
+    es.addEventListener('progress', e => {
+        const s = JSON.parse(e.data);
+        text.textContent = '🔄 正在同步 ' + s.file_name + '：第 ' + s.progress.pages + ' 页，已收集 ' + s.progress.messages + ' 条';
+    });
+    es.addEventListener('done', e => {
+        es.close();
+        const s = JSON.parse(e.data);
+        const msg = {done: '✅ 同步完成，新增 ' + s.added + ' 条', partial: '⚠️ 部分同步，新增 ' + s.added + ' 条', failed: '❌ 同步失败: ' + s.error, cancelled: '⏹️ 已取消'};
+        text.textContent = msg[s.state] || s.state;
+        setTimeout(() => { window.location.href = '/?f=' + encodeURIComponent(s.file_name); }, 1000);
+    });
+    es.onerror = () => { es.close(); document.getElementById('loading').style.display = 'none'; };
 }
+
+// 实时模式：当前月份有新消息 / 编辑 / 删除时提示刷新页面
+{{if .Live}}
+(function() {
+    let pending = 0;
+    const banner = document.getElementById('live-banner');
+    const es = new EventSource('/live/events');
+    es.addEventListener('message', e => {
+        const u = JSON.parse(e.data);
+        if (u.file !== '{{.ActiveFile}}') return;
+        pending++;
+        banner.textContent = '📡 有 ' + pending + ' 条更新，点击刷新查看';
+        banner.style.display = 'block';
+    });
+})();
+{{end}}
 </script>
 </body>
 </html>
 `
 	funcMap := template.FuncMap{
 		"index": func(arr []string, i int) string { return arr[i] },
+		"join":  strings.Join,
 		"formatMsg": func(content string) template.HTML {
 			safe := template.HTMLEscapeString(content)
 			return template.HTML(safe)
@@ -379,6 +598,128 @@ function confirmRefresh(file) {
 	t.Execute(w, data)
 }
 
+func renderAdmin(w http.ResponseWriter, data AdminPageData) {
+	tpl := `
+<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<title>管理 - 聊天存档</title>
+<style>
+    body { font-family: "Microsoft YaHei", sans-serif; background: #2f3136; color: #dcddde; margin: 0; padding: 30px; }
+    h1 { color: #fff; font-size: 22px; margin: 0 0 20px; }
+    h2 { color: #fff; font-size: 17px; margin: 30px 0 10px; }
+    a { color: #00aff4; }
+    .top { display: flex; justify-content: space-between; align-items: center; }
+    .message { background: #3ba55c33; border-left: 4px solid #3ba55c; padding: 10px 15px; margin-bottom: 15px; }
+    .error { background: #f0474733; border-left: 4px solid #f04747; padding: 10px 15px; margin-bottom: 15px; white-space: pre-wrap; }
+    .panels { display: flex; gap: 20px; flex-wrap: wrap; }
+    form { flex: 1; min-width: 420px; background: #36393f; padding: 15px; border-radius: 5px; }
+    label { display: block; font-size: 12px; font-weight: bold; color: #b9bbbe; margin-bottom: 8px; }
+    code { color: #faa61a; }
+    textarea { width: 100%; height: 360px; box-sizing: border-box; background: #202225; color: #dcddde; border: 1px solid #202225; border-radius: 3px; font-family: Consolas, monospace; font-size: 12px; padding: 10px; }
+    button { margin-top: 10px; background: #5865f2; color: #fff; padding: 8px 15px; border: none; border-radius: 3px; cursor: pointer; }
+    button:hover { background: #4752c4; }
+</style>
+</head>
+<body>
+<div class="top">
+    <h1>🛠️ 管理</h1>
+    <span>{{.CurrentUser.Username}} · <a href="/admin/audit">审计日志</a> · <a href="/">返回存档</a></span>
+</div>
+{{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+{{if .Error}}<div class="error">❌ {{.Error}}</div>{{end}}
+{{range .Communities}}
+<h2>{{.Name}}</h2>
+<div class="panels">
+    <form method="POST" action="/admin/posts">
+        <input type="hidden" name="community" value="{{.Ref}}">
+        <label>月份列表 <code>{{.PostConfigFile}}</code></label>
+        <textarea name="content" spellcheck="false">{{.PostConfig}}</textarea>
+        <button type="submit">保存月份列表</button>
+    </form>
+    <form method="POST" action="/admin/rules">
+        <input type="hidden" name="community" value="{{.Ref}}">
+        <label>高亮规则 <code>{{.RulesFile}}</code></label>
+        <textarea name="content" spellcheck="false">{{.Rules}}</textarea>
+        <button type="submit">保存高亮规则</button>
+    </form>
+</div>
+{{end}}
+</body>
+</html>
+`
+	t := template.Must(template.New("admin").Parse(tpl))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
+
+func renderAudit(w http.ResponseWriter, data AuditPageData) {
+	tpl := `
+<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<title>审计日志 - 聊天存档</title>
+<style>
+    body { font-family: "Microsoft YaHei", sans-serif; background: #2f3136; color: #dcddde; margin: 0; padding: 30px; }
+    h1 { color: #fff; font-size: 22px; margin: 0 0 20px; }
+    a { color: #00aff4; }
+    .top { display: flex; justify-content: space-between; align-items: center; }
+    .error { background: #f0474733; border-left: 4px solid #f04747; padding: 10px 15px; margin-bottom: 15px; }
+    form { display: flex; gap: 8px; flex-wrap: wrap; align-items: center; background: #36393f; padding: 12px; border-radius: 5px; margin-bottom: 15px; font-size: 13px; }
+    input, select { background: #202225; color: #dcddde; border: 1px solid #202225; border-radius: 3px; padding: 6px 8px; }
+    button { background: #5865f2; color: #fff; padding: 7px 15px; border: none; border-radius: 3px; cursor: pointer; }
+    table { width: 100%; border-collapse: collapse; font-size: 13px; }
+    th { text-align: left; color: #b9bbbe; border-bottom: 1px solid #202225; padding: 8px; }
+    td { border-bottom: 1px solid #40444b; padding: 6px 8px; vertical-align: top; }
+    .muted { color: #72767d; }
+    .r-failed, .r-limited { color: #f04747; }
+    .r-ok, .r-done { color: #3ba55c; }
+    .r-partial, .r-joined { color: #faa61a; }
+</style>
+</head>
+<body>
+<div class="top">
+    <h1>📜 审计日志</h1>
+    <span>{{.CurrentUser.Username}} · <a href="/admin">管理</a> · <a href="/">返回存档</a></span>
+</div>
+{{if .Error}}<div class="error">❌ {{.Error}}</div>{{end}}
+<form method="GET" action="/admin/audit">
+    <input name="user" value="{{.Filter.User}}" placeholder="用户 ID / 用户名">
+    <select name="action"><option value="">全部动作</option>{{$a := .Filter.Action}}{{range .Actions}}<option {{if eq . $a}}selected{{end}}>{{.}}</option>{{end}}</select>
+    <input name="target" value="{{.Filter.Target}}" placeholder="目标（如 2025-12.json）">
+    <select name="result"><option value="">全部结果</option>{{$r := .Filter.Result}}{{range .Results}}<option {{if eq . $r}}selected{{end}}>{{.}}</option>{{end}}</select>
+    从 <input type="date" name="since" value="{{.Filter.Since}}">
+    到 <input type="date" name="until" value="{{.Filter.Until}}">
+    <input type="number" name="limit" value="{{.Filter.Limit}}" min="1" style="width:70px">
+    <button type="submit">筛选</button>
+</form>
+<table>
+    <tr><th>时间</th><th>用户</th><th>动作</th><th>目标</th><th>结果</th><th>消息数</th><th>IP</th><th>详情</th></tr>
+    {{range .Entries}}
+    <tr>
+        <td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+        <td>{{.Username}}{{if .UserID}} <span class="muted">{{.UserID}}</span>{{end}}</td>
+        <td>{{.Action}}</td>
+        <td>{{.Target}}</td>
+        <td class="r-{{.Result}}">{{.Result}}</td>
+        <td>{{if or .Added .Total}}+{{.Added}} / {{.Total}}{{end}}</td>
+        <td class="muted">{{.IP}}</td>
+        <td class="muted">{{.Detail}}</td>
+    </tr>
+    {{else}}
+    <tr><td colspan="8" class="muted" style="text-align:center; padding:30px">没有符合条件的记录</td></tr>
+    {{end}}
+</table>
+</body>
+</html>
+`
+	t := template.Must(template.New("audit").Parse(tpl))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
+
 func renderLimitError(w http.ResponseWriter, waitTime string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	fmt.Fprintf(w, "<h1>🚫 刷新次数限制</h1><p>请等待 %s 后再试。</p><a href='/'>返回</a>", waitTime)